@@ -25,6 +25,8 @@ func main() {
 		optimize = flag.Bool("optimize", false, "Optimize database tables")
 		clean    = flag.Int("clean", 0, "Clean old backup files (keep N days)")
 
+		expirePasswords = flag.Bool("expire-legacy-passwords", false, "Force-expire legacy MD5 password hashes")
+
 		// 备份相关
 		backupPath    = flag.String("backup-path", "", "Backup file path")
 		withTimestamp = flag.Bool("timestamp", false, "Create backup with timestamp")
@@ -57,6 +59,8 @@ func main() {
 		optimizeTables(dm)
 	case *clean > 0:
 		cleanBackups(dm, *clean)
+	case *expirePasswords:
+		expireLegacyPasswords(dm)
 	default:
 		showHelp()
 	}
@@ -198,6 +202,21 @@ func cleanBackups(dm *utils.DatabaseManager, keepDays int) {
 	fmt.Println("✅ Old backup files cleaned!")
 }
 
+func expireLegacyPasswords(dm *utils.DatabaseManager) {
+	fmt.Println("Expiring legacy MD5 password hashes...")
+
+	names, err := dm.ExpireLegacyPasswords()
+	for _, name := range names {
+		fmt.Printf("   expired: %s\n", name)
+	}
+	if err != nil {
+		fmt.Printf("❌ Failed to expire passwords: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("✅ %d legacy password hashes expired!\n", len(names))
+}
+
 func showHelp() {
 	fmt.Println("Lyanna Database Management Tool")
 	fmt.Println("===============================")
@@ -213,6 +232,8 @@ func showHelp() {
 	fmt.Println("  -health            Check database health")
 	fmt.Println("  -optimize          Optimize database tables")
 	fmt.Println("  -clean <days>      Clean old backup files")
+	fmt.Println("  -expire-legacy-passwords")
+	fmt.Println("                     Force-expire legacy MD5 password hashes")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -host <host>       MySQL host (default: 127.0.0.1)")
@@ -230,5 +251,6 @@ func showHelp() {
 	fmt.Println("  db -restore ./backups/lyanna_backup_2023-01-01_12-00-00.sql")
 	fmt.Println("  db -health")
 	fmt.Println("  db -clean 7")
+	fmt.Println("  db -expire-legacy-passwords")
 	fmt.Println()
 }
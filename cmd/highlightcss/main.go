@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+	"lyanna/render"
+	"os"
+)
+
+// highlightcss 生成服务端代码高亮的样式表，修改 render.HighlightStyle 后重新运行
+func main() {
+	output := flag.String("o", "static/css/highlight.css", "Output file, - for stdout")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	buf.WriteString("/* Code generated by cmd/highlightcss. DO NOT EDIT. */\n")
+	if err := render.WriteHighlightCSS(&buf); err != nil {
+		log.Fatal(err)
+	}
+	if *output == "-" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(*output, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"lyanna/media"
+	"net/http"
+)
+
+// s3d 在本地提供内存中的 S3 兼容对象存储（MinIO 风格，path-style 地址），
+// 配合 media.storage=s3 调试上传
+func main() {
+	var (
+		addr      = flag.String("addr", "127.0.0.1:9082", "Listen address")
+		region    = flag.String("region", "us-east-1", "Signing region")
+		accessKey = flag.String("access-key", "lyanna", "Access key")
+		secretKey = flag.String("secret-key", "lyanna-secret", "Secret key")
+	)
+	flag.Parse()
+
+	fmt.Printf("S3 stand-in listening on http://%s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, media.NewS3StandIn(*region, *accessKey, *secretKey)))
+}
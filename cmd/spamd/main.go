@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"lyanna/spam"
+	"net/http"
+)
+
+// spamd 在本地提供 Akismet 风格的垃圾评论检测接口（内存中的朴素贝叶斯），
+// 配合 spam.engine=remote 调试远程检测
+func main() {
+	var (
+		addr      = flag.String("addr", "127.0.0.1:9081", "Listen address")
+		threshold = flag.Float64("threshold", 0.9, "Spam probability threshold")
+		minDocs   = flag.Int("min-docs", 1, "Minimum training samples per class")
+	)
+	flag.Parse()
+
+	checker := spam.NewBayes(spam.NewMemoryStore(), *threshold, *minDocs)
+	fmt.Printf("Spam stand-in listening on http://%s\n", *addr)
+	log.Fatal(http.ListenAndServe(*addr, spam.NewStandInHandler(checker)))
+}
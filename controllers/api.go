@@ -1,27 +1,70 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"lyanna/models"
 	"net/http"
 )
 
+// publishablePost 读取当前用户有权发布的文章
+func publishablePost(c *gin.Context) *models.Post {
+	post, err := models.GetPostByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"r": 1, "msg": "post not found"})
+		return nil
+	}
+	if !currentUser(c).CanPublishPost(post) {
+		c.JSON(http.StatusForbidden, gin.H{"r": 1, "msg": "permission denied"})
+		return nil
+	}
+	return post
+}
+
 func PostPublish(c *gin.Context) {
-	postID := c.Param("postID")
 	var H = gin.H{}
-	post, _ := models.GetPostByID(postID)
+	post := publishablePost(c)
+	if post == nil {
+		return
+	}
 	post.Published = true
+	// 手动发布后取消尚未执行的定时发布
+	post.PublishAt = nil
 	H["r"] = 0
 	post.Update()
 	c.JSON(http.StatusOK,H)
 }
 
 func DeletePublish(c *gin.Context) {
-	postID := c.Param("postID")
 	var H = gin.H{}
-	post, _ := models.GetPostByID(postID)
+	post := publishablePost(c)
+	if post == nil {
+		return
+	}
 	post.Published = false
+	post.UnpublishAt = nil
 	H["r"] = 0
 	post.Update()
 	c.JSON(http.StatusOK,H)
-}
\ No newline at end of file
+}
+
+// DeletePost 把文章移到回收站，删除已发布的文章等同于下线，需要发布权限
+func DeletePost(c *gin.Context) {
+	post, err := models.GetPostByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"r": 1, "msg": "post not found"})
+		return
+	}
+	user := currentUser(c)
+	if !user.CanEditPost(post) || (post.Published && !user.CanPublishPost(post)) {
+		c.JSON(http.StatusForbidden, gin.H{"r": 1, "msg": "permission denied"})
+		return
+	}
+	if err := post.Delete(); err != nil {
+		msg := fmt.Sprintf("delete post err:%v", err)
+		Logger.Error(msg)
+		c.JSON(http.StatusInternalServerError, gin.H{"r": 1, "msg": "delete post failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"r": 0})
+}
@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"lyanna/utils"
+	"lyanna/utils/openapi"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// APIV1Prefix REST API 的路由前缀
+const APIV1Prefix = "/api/v1"
+
+// API 允许的最大每页条数
+const apiMaxPerPage = 100
+
+// API 错误码
+const (
+	apiBadRequest   = "bad_request"
+	apiUnauthorized = "unauthorized"
+	apiForbidden    = "forbidden"
+	apiNotFound     = "not_found"
+	apiConflict     = "conflict"
+	apiInternal     = "internal_error"
+	api2FARequired  = "two_factor_required"
+)
+
+// 接口的认证方式
+const (
+	apiPublic  = iota // 不需要登录
+	apiAdmin          // 需要后台用户登录，并拥有 apiRoute.perm
+	apiGitUser        // 需要 GitHub 登录
+)
+
+type apiRoute struct {
+	openapi.Operation
+	auth    int
+	perm    models.Permission
+	handler gin.HandlerFunc
+}
+
+// apiMeta 列表接口的分页信息
+type apiMeta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+var apiV1Routes = []apiRoute{
+	{Operation: openapi.Operation{Method: "GET", Path: "/posts", Tag: "posts", Summary: "List posts", Response: apiPost{}, List: true,
+		Params: []openapi.Param{
+			{Name: "tag", In: "query", Type: "integer", Description: "Only posts with this tag ID"},
+			{Name: "author", In: "query", Type: "integer", Description: "Only posts of this author ID"},
+			{Name: "q", In: "query", Description: "Keyword in title or summary"},
+			{Name: "published", In: "query", Type: "boolean", Description: "Filter by publish state, drafts are only visible to users who can edit others' posts"},
+		}},
+		handler: APIListPosts},
+	{Operation: openapi.Operation{Method: "GET", Path: "/posts/:id", Tag: "posts", Summary: "Get a post", Response: apiPost{},
+		Description: "Drafts are only visible to users who can edit them."},
+		handler: APIGetPost},
+	{Operation: openapi.Operation{Method: "POST", Path: "/posts", Tag: "posts", Summary: "Create a post", Body: apiPostInput{}, Response: apiPost{}, Status: http.StatusCreated},
+		auth: apiAdmin, perm: models.PermCreatePosts, handler: APICreatePost},
+	{Operation: openapi.Operation{Method: "PATCH", Path: "/posts/:id", Tag: "posts", Summary: "Update a post", Body: apiPostInput{}, Response: apiPost{},
+		Description: "Omitted fields are left unchanged. Changing the publish state requires `posts:publish`."},
+		auth: apiAdmin, perm: models.PermCreatePosts, handler: APIUpdatePost},
+	{Operation: openapi.Operation{Method: "DELETE", Path: "/posts/:id", Tag: "posts", Summary: "Delete a post", Status: http.StatusNoContent},
+		auth: apiAdmin, perm: models.PermCreatePosts, handler: APIDeletePost},
+
+	{Operation: openapi.Operation{Method: "GET", Path: "/search", Tag: "posts", Summary: "Search published posts", Response: apiSearchResult{}, List: true,
+		Params: []openapi.Param{
+			{Name: "q", In: "query", Required: true, Description: "Keywords, Chinese text is matched by adjacent character pairs"},
+		},
+		Description: "All keywords must match. Results are ordered by relevance."},
+		handler: APISearch},
+
+	{Operation: openapi.Operation{Method: "GET", Path: "/tags", Tag: "tags", Summary: "List tags", Response: apiTag{}, List: true},
+		handler: APIListTags},
+	{Operation: openapi.Operation{Method: "GET", Path: "/tags/:id", Tag: "tags", Summary: "Get a tag", Response: apiTag{}},
+		handler: APIGetTag},
+	{Operation: openapi.Operation{Method: "POST", Path: "/tags", Tag: "tags", Summary: "Create a tag", Body: apiTagInput{}, Response: apiTag{}, Status: http.StatusCreated},
+		auth: apiAdmin, perm: models.PermEditOthersPosts, handler: APICreateTag},
+	{Operation: openapi.Operation{Method: "PATCH", Path: "/tags/:id", Tag: "tags", Summary: "Rename a tag", Body: apiTagInput{}, Response: apiTag{}},
+		auth: apiAdmin, perm: models.PermEditOthersPosts, handler: APIUpdateTag},
+	{Operation: openapi.Operation{Method: "DELETE", Path: "/tags/:id", Tag: "tags", Summary: "Delete a tag", Status: http.StatusNoContent},
+		auth: apiAdmin, perm: models.PermEditOthersPosts, handler: APIDeleteTag},
+
+	{Operation: openapi.Operation{Method: "GET", Path: "/comments", Tag: "comments", Summary: "List comments", Response: apiComment{}, List: true,
+		Params: []openapi.Param{
+			{Name: "post_id", In: "query", Type: "integer"},
+			{Name: "status", In: "query", Description: "pending / approved / spam / deleted, only moderators can list other than approved"},
+		}},
+		handler: APIListComments},
+	{Operation: openapi.Operation{Method: "GET", Path: "/comments/:id", Tag: "comments", Summary: "Get a comment", Response: apiComment{}},
+		handler: APIGetComment},
+	{Operation: openapi.Operation{Method: "POST", Path: "/comments", Tag: "comments", Summary: "Create a comment", Body: apiCommentInput{}, Response: apiComment{}, Status: http.StatusCreated,
+		Description: "Requires a GitHub login session. New comments go through spam check and moderation."},
+		auth: apiGitUser, handler: APICreateComment},
+	{Operation: openapi.Operation{Method: "PATCH", Path: "/comments/:id", Tag: "comments", Summary: "Moderate a comment", Body: apiCommentStatusInput{}, Response: apiComment{}},
+		auth: apiAdmin, perm: models.PermModerateComments, handler: APIUpdateComment},
+	{Operation: openapi.Operation{Method: "DELETE", Path: "/comments/:id", Tag: "comments", Summary: "Delete a comment", Status: http.StatusNoContent},
+		auth: apiAdmin, perm: models.PermModerateComments, handler: APIDeleteComment},
+
+	{Operation: openapi.Operation{Method: "GET", Path: "/users", Tag: "users", Summary: "List users", Response: apiUser{}, List: true},
+		auth: apiAdmin, perm: models.PermManageUsers, handler: APIListUsers},
+	{Operation: openapi.Operation{Method: "GET", Path: "/users/:id", Tag: "users", Summary: "Get a user", Response: apiUser{}},
+		auth: apiAdmin, perm: models.PermManageUsers, handler: APIGetUser},
+	{Operation: openapi.Operation{Method: "POST", Path: "/users", Tag: "users", Summary: "Create a user", Body: apiUserInput{}, Response: apiUser{}, Status: http.StatusCreated},
+		auth: apiAdmin, perm: models.PermManageUsers, handler: APICreateUser},
+	{Operation: openapi.Operation{Method: "PATCH", Path: "/users/:id", Tag: "users", Summary: "Update a user", Body: apiUserInput{}, Response: apiUser{},
+		Description: "Omitted fields are left unchanged. Users cannot change their own role or deactivate themselves."},
+		auth: apiAdmin, perm: models.PermManageUsers, handler: APIUpdateUser},
+	{Operation: openapi.Operation{Method: "DELETE", Path: "/users/:id", Tag: "users", Summary: "Delete a user", Status: http.StatusNoContent},
+		auth: apiAdmin, perm: models.PermManageUsers, handler: APIDeleteUser},
+}
+
+// APIV1Operations 返回所有接口的文档描述
+func APIV1Operations() []openapi.Operation {
+	ops := make([]openapi.Operation, 0, len(apiV1Routes))
+	for _, route := range apiV1Routes {
+		op := route.Operation
+		op.Permission = string(route.perm)
+		if route.auth == apiAdmin && op.Permission == "" {
+			op.Permission = "login"
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// RegisterAPIV1 按接口表注册路由，文档由同一张表生成
+func RegisterAPIV1(group *gin.RouterGroup) {
+	for _, route := range apiV1Routes {
+		var handlers []gin.HandlerFunc
+		switch route.auth {
+		case apiAdmin:
+			handlers = append(handlers, apiAdminRequired(route.perm))
+		case apiGitUser:
+			handlers = append(handlers, apiGitUserRequired())
+		}
+		handlers = append(handlers, route.handler)
+		group.Handle(route.Method, route.Path, handlers...)
+	}
+	group.GET("/openapi.json", APIV1Document)
+}
+
+// APIV1Document 输出 OpenAPI 文档
+func APIV1Document(c *gin.Context) {
+	c.JSON(http.StatusOK, openapi.Document(openapi.Info{
+		Title:   "Lyanna API",
+		Version: "1.0.0",
+		BaseURL: APIV1Prefix,
+		SecuritySchemes: map[string]interface{}{
+			"bearerAuth": gin.H{"type": "http", "scheme": "bearer", "description": "Personal API token created in /admin/tokens"},
+			"cookieAuth": gin.H{"type": "apiKey", "in": "cookie", "name": "gin-session", "description": "Login session, write requests also need the X-CSRF-Token header"},
+		},
+	}, APIV1Operations()))
+}
+
+// apiAdminRequired 要求当前后台用户拥有 perm，perm 为空时只要求登录
+func apiAdminRequired(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			apiFail(c, http.StatusUnauthorized, apiUnauthorized, "login required")
+			return
+		}
+		if !user.TOTPEnabled && models.Require2FA() {
+			apiFail(c, http.StatusForbidden, api2FARequired, "two-factor authentication must be enabled first")
+			return
+		}
+		if perm != "" && !user.Can(perm) {
+			apiFail(c, http.StatusForbidden, apiForbidden, "permission denied")
+			return
+		}
+		c.Next()
+	}
+}
+
+func apiGitUserRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentGitUser(c) == nil {
+			apiFail(c, http.StatusUnauthorized, apiUnauthorized, "GitHub login required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// apiFail 输出错误信封并终止后续处理
+func apiFail(c *gin.Context, status int, code, msg string) {
+	c.AbortWithStatusJSON(status, gin.H{"r": 1, "code": code, "msg": msg})
+}
+
+// apiError 记录内部错误，不把错误细节返回给调用方
+func apiError(c *gin.Context, action string, err error) {
+	msg := fmt.Sprintf("api %s err:%v", action, err)
+	Logger.Error(msg)
+	apiFail(c, http.StatusInternalServerError, apiInternal, "internal server error")
+}
+
+// apiNotFoundOr 查询失败时，记录不存在返回 404，其他错误返回 500
+func apiNotFoundOr(c *gin.Context, action string, err error) {
+	if gorm.IsRecordNotFoundError(err) {
+		apiFail(c, http.StatusNotFound, apiNotFound, "not found")
+		return
+	}
+	apiError(c, action, err)
+}
+
+func apiOK(c *gin.Context, status int, data interface{}) {
+	if status == http.StatusNoContent {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, gin.H{"r": 0, "data": data})
+}
+
+func apiList(c *gin.Context, data interface{}, page, perPage, total int) {
+	pagination := utils.Pagination{CurrentPage: page, PerPage: perPage, Total: total}
+	c.JSON(http.StatusOK, gin.H{
+		"r":    0,
+		"data": data,
+		"meta": apiMeta{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: pagination.AllPages(),
+		},
+	})
+}
+
+// apiPaging 读取 page 和 per_page 参数，非法时输出错误并返回 ok=false
+func apiPaging(c *gin.Context) (page, perPage int, ok bool) {
+	perPage = models.Conf.General.PerPage
+	if perPage <= 0 {
+		perPage = 10
+	}
+	page, ok = apiQueryInt(c, "page", 1)
+	if !ok {
+		return
+	}
+	perPage, ok = apiQueryInt(c, "per_page", perPage)
+	if !ok {
+		return
+	}
+	if perPage > apiMaxPerPage {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, fmt.Sprintf("per_page must not exceed %d", apiMaxPerPage))
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// apiQueryInt 读取正整数查询参数，缺省时返回 def
+func apiQueryInt(c *gin.Context, key string, def int) (int, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, key+" must be a positive integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// apiQueryBool 读取布尔查询参数，缺省时返回 nil
+func apiQueryBool(c *gin.Context, key string) (*bool, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, key+" must be true or false")
+		return nil, false
+	}
+	return &b, true
+}
+
+// apiParamID 读取路径中的 id
+func apiParamID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		apiFail(c, http.StatusNotFound, apiNotFound, "not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// apiBind 解析 JSON 请求体
+func apiBind(c *gin.Context, v interface{}) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
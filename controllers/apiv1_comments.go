@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"html/template"
+	"lyanna/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiCommentAuthor struct {
+	GitHubID int64  `json:"github_id"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Avatar   string `json:"avatar"`
+}
+
+type apiComment struct {
+	ID        uint64           `json:"id"`
+	PostID    int64            `json:"post_id"`
+	RefID     int64            `json:"ref_id" doc:"ID of the parent comment, 0 for top level comments"`
+	Content   string           `json:"content" doc:"Markdown source"`
+	HTML      template.HTML    `json:"html" doc:"Sanitized HTML"`
+	Status    string           `json:"status"`
+	Author    apiCommentAuthor `json:"author"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type apiCommentInput struct {
+	PostID  int64  `json:"post_id"`
+	RefID   int64  `json:"ref_id" doc:"Reply to this comment, optional"`
+	Content string `json:"content" doc:"Markdown source"`
+}
+
+type apiCommentStatusInput struct {
+	Status string `json:"status" doc:"pending / approved / spam / deleted"`
+}
+
+func newAPIComment(comment *models.Comment) apiComment {
+	a := apiComment{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		RefID:     comment.RefID,
+		Content:   comment.Content,
+		HTML:      comment.CommentHTML(),
+		Status:    comment.Status,
+		Author:    apiCommentAuthor{GitHubID: comment.GitHubID},
+		CreatedAt: comment.CreatedAt,
+	}
+	if gitUser, err := models.GetGitUserByGid(comment.GitHubID); err == nil {
+		a.Author.Name = gitUser.NickName
+		a.Author.URL = gitUser.Url
+		a.Author.Avatar = gitUser.Picture
+	}
+	return a
+}
+
+func APIListComments(c *gin.Context) {
+	page, perPage, ok := apiPaging(c)
+	if !ok {
+		return
+	}
+	postID, ok := apiQueryInt(c, "post_id", 0)
+	if !ok {
+		return
+	}
+	status := c.DefaultQuery("status", models.CommentApproved)
+	if !models.IsCommentStatus(status) {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "unknown status")
+		return
+	}
+	if status != models.CommentApproved && !currentUser(c).Can(models.PermModerateComments) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "permission denied")
+		return
+	}
+	filter := models.CommentFilter{PostID: uint64(postID), Status: status}
+	comments, total, err := models.ListCommentsByFilter(filter, (page-1)*perPage, perPage)
+	if err != nil {
+		apiError(c, "list comments", err)
+		return
+	}
+	data := make([]apiComment, 0, len(comments))
+	for _, comment := range comments {
+		data = append(data, newAPIComment(comment))
+	}
+	apiList(c, data, page, perPage, total)
+}
+
+// apiCommentByID 读取路径中的评论，未通过审核的评论只对审核员可见
+func apiCommentByID(c *gin.Context) *models.Comment {
+	id, ok := apiParamID(c)
+	if !ok {
+		return nil
+	}
+	comment, err := models.GetCommentByID(id)
+	if err != nil {
+		apiNotFoundOr(c, "get comment", err)
+		return nil
+	}
+	if !comment.Approved() && !currentUser(c).Can(models.PermModerateComments) {
+		apiFail(c, http.StatusNotFound, apiNotFound, "not found")
+		return nil
+	}
+	return comment
+}
+
+func APIGetComment(c *gin.Context) {
+	comment := apiCommentByID(c)
+	if comment == nil {
+		return
+	}
+	apiOK(c, http.StatusOK, newAPIComment(comment))
+}
+
+func APICreateComment(c *gin.Context) {
+	var in apiCommentInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "content is required")
+		return
+	}
+	post, err := models.GetPostByIDAndPublished(in.PostID, true)
+	if err != nil {
+		apiNotFoundOr(c, "get post", err)
+		return
+	}
+	if !post.CanComment {
+		apiFail(c, http.StatusForbidden, apiForbidden, "comments are closed")
+		return
+	}
+	if in.RefID != 0 {
+		parent, err := models.GetCommentByID(in.RefID)
+		if err != nil || parent.PostID != in.PostID || !parent.Approved() {
+			apiFail(c, http.StatusBadRequest, apiBadRequest, "parent comment does not exist")
+			return
+		}
+	}
+	comment := &models.Comment{
+		GitHubID: currentGitUser(c).GID,
+		PostID:   in.PostID,
+		Content:  in.Content,
+		RefID:    in.RefID,
+	}
+	if err := insertComment(c, comment); err != nil {
+		apiError(c, "create comment", err)
+		return
+	}
+	apiOK(c, http.StatusCreated, newAPIComment(comment))
+}
+
+func APIUpdateComment(c *gin.Context) {
+	comment := apiCommentByID(c)
+	if comment == nil {
+		return
+	}
+	var in apiCommentStatusInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if !models.IsCommentStatus(in.Status) {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "unknown status")
+		return
+	}
+	if err := models.UpdateCommentsStatus([]uint64{comment.ID}, in.Status); err != nil {
+		apiError(c, "update comment status", err)
+		return
+	}
+	learnComments([]*models.Comment{comment}, in.Status)
+	comment.Status = in.Status
+	apiOK(c, http.StatusOK, newAPIComment(comment))
+}
+
+func APIDeleteComment(c *gin.Context) {
+	comment := apiCommentByID(c)
+	if comment == nil {
+		return
+	}
+	if err := comment.Delete(); err != nil {
+		apiError(c, "delete comment", err)
+		return
+	}
+	apiOK(c, http.StatusNoContent, nil)
+}
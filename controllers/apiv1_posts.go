@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiAuthor struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiPost struct {
+	ID          uint64     `json:"id"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Summary     string     `json:"summary"`
+	Content     string     `json:"content,omitempty" doc:"Markdown source, only returned when getting a single post"`
+	URL         string     `json:"url"`
+	Author      apiAuthor  `json:"author"`
+	Tags        []string   `json:"tags"`
+	CanComment  bool       `json:"can_comment"`
+	Published   bool       `json:"published"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// apiPostInput 创建或修改文章的请求体，修改时省略的字段保持不变
+type apiPostInput struct {
+	Title       *string    `json:"title" doc:"Required when creating"`
+	Slug        *string    `json:"slug"`
+	Summary     *string    `json:"summary"`
+	Content     *string    `json:"content" doc:"Markdown source, required when creating"`
+	AuthorID    *int       `json:"author_id" doc:"Only users who can edit others' posts may set another author"`
+	Tags        *[]string  `json:"tags" doc:"Tag names, missing tags are created"`
+	CanComment  *bool      `json:"can_comment"`
+	Published   *bool      `json:"published"`
+	PublishAt   *time.Time `json:"publish_at" doc:"Future time schedules the post and keeps it unpublished until then, a past time is ignored"`
+	UnpublishAt *time.Time `json:"unpublish_at" doc:"Future time unpublishes the post then, a past time is ignored"`
+}
+
+func (in *apiPostInput) changesPublishState() bool {
+	return in.Published != nil || in.PublishAt != nil || in.UnpublishAt != nil
+}
+
+func newAPIPost(post *models.Post, withContent bool) apiPost {
+	name := post.GetUserName(post.AuthorID)
+	p := apiPost{
+		ID:          post.ID,
+		Title:       post.Title,
+		Slug:        post.Slug,
+		Summary:     post.Summary,
+		URL:         post.Url(),
+		Author:      apiAuthor{ID: uint64(post.AuthorID), Name: name},
+		Tags:        models.GetTagNames(post.Tags),
+		CanComment:  post.CanComment,
+		Published:   post.Published,
+		PublishAt:   post.PublishAt,
+		UnpublishAt: post.UnpublishAt,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if withContent {
+		p.Content = post.Content
+	}
+	return p
+}
+
+// loadPostRelations 批量填充文章的标签和作者
+func loadPostRelations(posts ...*models.Post) error {
+	return models.LoadPostRelations(posts)
+}
+
+func APIListPosts(c *gin.Context) {
+	page, perPage, ok := apiPaging(c)
+	if !ok {
+		return
+	}
+	tagID, ok := apiQueryInt(c, "tag", 0)
+	if !ok {
+		return
+	}
+	authorID, ok := apiQueryInt(c, "author", 0)
+	if !ok {
+		return
+	}
+	published, ok := apiQueryBool(c, "published")
+	if !ok {
+		return
+	}
+	// 只有可以编辑他人文章的用户才能看到草稿
+	if !currentUser(c).Can(models.PermEditOthersPosts) {
+		published = new(bool)
+		*published = true
+	}
+	filter := models.PostFilter{
+		TagID:     uint64(tagID),
+		AuthorID:  uint64(authorID),
+		Query:     strings.TrimSpace(c.Query("q")),
+		Published: published,
+	}
+	posts, total, err := models.ListPostsByFilter(filter, (page-1)*perPage, perPage)
+	if err != nil {
+		apiError(c, "list posts", err)
+		return
+	}
+	if err := loadPostRelations(posts...); err != nil {
+		apiError(c, "load post relations", err)
+		return
+	}
+	data := make([]apiPost, 0, len(posts))
+	for _, post := range posts {
+		data = append(data, newAPIPost(post, false))
+	}
+	apiList(c, data, page, perPage, total)
+}
+
+// apiPostByID 读取路径中的文章，草稿只对可编辑该文章的用户可见
+func apiPostByID(c *gin.Context) *models.Post {
+	id, ok := apiParamID(c)
+	if !ok {
+		return nil
+	}
+	post, err := models.GetPostByID(id)
+	if err != nil {
+		apiNotFoundOr(c, "get post", err)
+		return nil
+	}
+	if !post.Published && !currentUser(c).CanEditPost(post) {
+		apiFail(c, http.StatusNotFound, apiNotFound, "not found")
+		return nil
+	}
+	if err := loadPostRelations(post); err != nil {
+		apiError(c, "load post relations", err)
+		return nil
+	}
+	return post
+}
+
+// apiEditablePost 读取当前用户可编辑的文章
+func apiEditablePost(c *gin.Context) *models.Post {
+	post := apiPostByID(c)
+	if post == nil {
+		return nil
+	}
+	if !currentUser(c).CanEditPost(post) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "permission denied")
+		return nil
+	}
+	return post
+}
+
+func APIGetPost(c *gin.Context) {
+	post := apiPostByID(c)
+	if post == nil {
+		return
+	}
+	apiOK(c, http.StatusOK, newAPIPost(post, true))
+}
+
+func APICreatePost(c *gin.Context) {
+	var in apiPostInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if in.Title == nil || strings.TrimSpace(*in.Title) == "" || in.Content == nil {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "title and content are required")
+		return
+	}
+	user := currentUser(c)
+	post := &models.Post{AuthorID: int(user.ID), CanComment: true}
+	if !applyPostInput(c, post, &in) {
+		return
+	}
+	if err := models.PostCreatAndGetID(post); err != nil {
+		apiError(c, "create post", err)
+		return
+	}
+	savePostRevision(post, user.ID)
+	if in.Tags != nil {
+		models.UpdateMultiTags([]string{}, *in.Tags, int(post.ID))
+	}
+	if err := loadPostRelations(post); err != nil {
+		apiError(c, "load post relations", err)
+		return
+	}
+	apiOK(c, http.StatusCreated, newAPIPost(post, true))
+}
+
+func APIUpdatePost(c *gin.Context) {
+	post := apiEditablePost(c)
+	if post == nil {
+		return
+	}
+	var in apiPostInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if in.Title != nil && strings.TrimSpace(*in.Title) == "" {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "title must not be empty")
+		return
+	}
+	// 旧文章没有任何历史版本时，先保存修改前的内容
+	if count, _ := models.CountRevisionsByPostID(post.ID); count == 0 {
+		savePostRevision(post, uint64(post.AuthorID))
+	}
+	if !applyPostInput(c, post, &in) {
+		return
+	}
+	post.Update()
+	savePostRevision(post, currentUserID(c))
+	if in.Tags != nil {
+		models.UpdateMultiTags(models.GetTagNames(post.Tags), *in.Tags, int(post.ID))
+		if err := loadPostRelations(post); err != nil {
+			apiError(c, "load post relations", err)
+			return
+		}
+	}
+	apiOK(c, http.StatusOK, newAPIPost(post, true))
+}
+
+// applyPostInput 把请求体中的字段写入文章，权限不足时输出错误并返回 false
+func applyPostInput(c *gin.Context, post *models.Post, in *apiPostInput) bool {
+	user := currentUser(c)
+	if in.AuthorID != nil && uint64(*in.AuthorID) != uint64(post.AuthorID) {
+		if !user.Can(models.PermEditOthersPosts) {
+			apiFail(c, http.StatusForbidden, apiForbidden, "cannot set another author")
+			return false
+		}
+		if _, err := models.GetUserByID(*in.AuthorID); err != nil {
+			apiFail(c, http.StatusBadRequest, apiBadRequest, "author does not exist")
+			return false
+		}
+		post.AuthorID = *in.AuthorID
+	}
+	if in.changesPublishState() && !user.CanPublishPost(post) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "permission denied to publish")
+		return false
+	}
+	if in.Title != nil {
+		post.Title = *in.Title
+	}
+	if in.Slug != nil {
+		post.Slug = *in.Slug
+	}
+	if in.Summary != nil {
+		post.Summary = *in.Summary
+	}
+	if in.Content != nil {
+		post.Content = *in.Content
+	}
+	if in.CanComment != nil {
+		post.CanComment = *in.CanComment
+	}
+	if in.Published != nil {
+		post.Published = *in.Published
+	}
+	if in.PublishAt != nil {
+		post.PublishAt = in.PublishAt
+	}
+	if in.UnpublishAt != nil {
+		post.UnpublishAt = in.UnpublishAt
+	}
+	// 与后台表单一致，未到发布时间的文章先保持未发布，已过去的时间被忽略
+	post.NormalizeSchedule(now())
+	return true
+}
+
+func APIDeletePost(c *gin.Context) {
+	post := apiEditablePost(c)
+	if post == nil {
+		return
+	}
+	// 删除已发布的文章等同于下线，需要发布权限
+	if post.Published && !currentUser(c).CanPublishPost(post) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "permission denied to unpublish")
+		return
+	}
+	if err := post.Delete(); err != nil {
+		apiError(c, "delete post", err)
+		return
+	}
+	apiOK(c, http.StatusNoContent, nil)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiSearchResult struct {
+	Post      apiPost        `json:"post"`
+	Score     float64        `json:"score" doc:"BM25 relevance score"`
+	Title     string         `json:"title" doc:"HTML escaped title, matched keywords are wrapped in <em class=\"search-keyword\">"`
+	Snippet   string         `json:"snippet" doc:"HTML escaped excerpt around the matched keywords, highlighted like title"`
+	Reactions map[string]int `json:"reactions" doc:"Number of each reaction on the post"`
+}
+
+// APISearch 全文搜索已发布的文章
+func APISearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "q is required")
+		return
+	}
+	page, perPage, ok := apiPaging(c)
+	if !ok {
+		return
+	}
+	results, total, err := models.SearchPosts(query, (page-1)*perPage, perPage)
+	if err != nil {
+		apiError(c, "search posts", err)
+		return
+	}
+	posts := make([]*models.Post, 0, len(results))
+	for _, result := range results {
+		posts = append(posts, result.Post)
+	}
+	if err := loadPostRelations(posts...); err != nil {
+		apiError(c, "load post relations", err)
+		return
+	}
+	data := make([]apiSearchResult, 0, len(results))
+	for _, result := range results {
+		reactions, err := models.GetReactionCounts(int64(result.Post.ID))
+		if err != nil {
+			apiError(c, "get reaction counts", err)
+			return
+		}
+		data = append(data, apiSearchResult{
+			Post:      newAPIPost(result.Post, false),
+			Score:     result.Score,
+			Title:     string(result.Title),
+			Snippet:   string(result.Snippet),
+			Reactions: reactions,
+		})
+	}
+	apiList(c, data, page, perPage, total)
+}
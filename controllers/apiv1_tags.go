@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiTag struct {
+	ID        uint64 `json:"id"`
+	Name      string `json:"name"`
+	PostCount int    `json:"post_count" doc:"Number of posts with this tag, including drafts"`
+}
+
+type apiTagInput struct {
+	Name string `json:"name"`
+}
+
+func newAPITag(tag *models.Tag) apiTag {
+	return apiTag{ID: tag.ID, Name: tag.Name, PostCount: tag.Total}
+}
+
+func APIListTags(c *gin.Context) {
+	page, perPage, ok := apiPaging(c)
+	if !ok {
+		return
+	}
+	tags, total, err := models.ListTagsPage((page-1)*perPage, perPage)
+	if err != nil {
+		apiError(c, "list tags", err)
+		return
+	}
+	data := make([]apiTag, 0, len(tags))
+	for _, tag := range tags {
+		data = append(data, newAPITag(tag))
+	}
+	apiList(c, data, page, perPage, total)
+}
+
+func apiTagByID(c *gin.Context) *models.Tag {
+	id, ok := apiParamID(c)
+	if !ok {
+		return nil
+	}
+	tag, err := models.GetTagByID(id)
+	if err != nil {
+		apiNotFoundOr(c, "get tag", err)
+		return nil
+	}
+	return tag
+}
+
+func APIGetTag(c *gin.Context) {
+	tag := apiTagByID(c)
+	if tag == nil {
+		return
+	}
+	apiOK(c, http.StatusOK, newAPITag(tag))
+}
+
+// apiTagName 读取并校验标签名，名称已被其他标签使用时返回冲突
+func apiTagName(c *gin.Context, id uint64) (string, bool) {
+	var in apiTagInput
+	if !apiBind(c, &in) {
+		return "", false
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "name is required")
+		return "", false
+	}
+	if existing := models.GetTagIDByName(name); existing != 0 && uint64(existing) != id {
+		apiFail(c, http.StatusConflict, apiConflict, "tag already exists")
+		return "", false
+	}
+	if models.NameInTrash(models.TrashTags, name, id) {
+		apiFail(c, http.StatusConflict, apiConflict, "name is in the trash")
+		return "", false
+	}
+	return name, true
+}
+
+func APICreateTag(c *gin.Context) {
+	name, ok := apiTagName(c, 0)
+	if !ok {
+		return
+	}
+	tag := &models.Tag{Name: name}
+	if err := tag.Insert(); err != nil {
+		apiError(c, "create tag", err)
+		return
+	}
+	apiOK(c, http.StatusCreated, newAPITag(tag))
+}
+
+func APIUpdateTag(c *gin.Context) {
+	tag := apiTagByID(c)
+	if tag == nil {
+		return
+	}
+	name, ok := apiTagName(c, tag.ID)
+	if !ok {
+		return
+	}
+	tag.Name = name
+	if err := tag.Update(); err != nil {
+		apiError(c, "update tag", err)
+		return
+	}
+	apiOK(c, http.StatusOK, newAPITag(tag))
+}
+
+func APIDeleteTag(c *gin.Context) {
+	tag := apiTagByID(c)
+	if tag == nil {
+		return
+	}
+	if err := tag.Delete(); err != nil {
+		apiError(c, "delete tag", err)
+		return
+	}
+	apiOK(c, http.StatusNoContent, nil)
+}
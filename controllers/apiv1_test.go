@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"lyanna/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// openTestDB 用临时的 SQLite 数据库代替 MySQL，Redis 不可用，返回清理函数
+func openTestDB(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "lyanna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	models.DB = db
+	models.RedisPool = &redis.Pool{Dial: func() (redis.Conn, error) {
+		return nil, errors.New("redis is not available in tests")
+	}}
+	return func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testRouter 以 user 和 gitUser 的身份访问 /api/v1
+func testRouter(user *models.User, gitUser *models.GitHubUser) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if user != nil {
+			c.Set(models.CONTEXT_USER_KEY, user)
+		}
+		if gitUser != nil {
+			c.Set(models.CONTEXT_GIT_USER_KEY, gitUser)
+		}
+	})
+	RegisterAPIV1(router.Group(APIV1Prefix))
+	return router
+}
+
+func doJSON(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPICreatePost(t *testing.T) {
+	defer openTestDB(t)()
+	user := &models.User{Name: "admin", Role: models.RoleAdmin, Active: true}
+	if err := models.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := testRouter(user, nil)
+
+	w := doJSON(router, "POST", "/api/v1/posts", gin.H{"title": "Hello", "content": "# Hello", "tags": []string{"go", "gin"}, "published": true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create post: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data apiPost `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.ID == 0 || resp.Data.Slug != "hello" || len(resp.Data.Tags) != 2 {
+		t.Errorf("unexpected post: %+v", resp.Data)
+	}
+	if count, _ := models.CountRevisionsByPostID(resp.Data.ID); count != 1 {
+		t.Errorf("post has %d revisions, want 1", count)
+	}
+	var posts int
+	models.DB.Model(&models.Post{}).Count(&posts)
+	if posts != 1 {
+		t.Errorf("%d posts saved, want 1", posts)
+	}
+}
+
+func TestAPICreateComment(t *testing.T) {
+	defer openTestDB(t)()
+	post := &models.Post{Title: "Hello", Content: "hi", CanComment: true, Published: true}
+	if err := post.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	router := testRouter(nil, &models.GitHubUser{GID: 42})
+
+	w := doJSON(router, "POST", "/api/v1/comments", gin.H{"post_id": post.ID, "content": "nice"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create comment: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data apiComment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.ID == 0 {
+		t.Errorf("comment ID not returned: %s", w.Body)
+	}
+	var comments int
+	models.DB.Model(&models.Comment{}).Count(&comments)
+	if comments != 1 {
+		t.Errorf("%d comments saved, want 1", comments)
+	}
+}
+
+// TestAPISearchNewPost 新建的文章立即可以搜索到，结果中带有反应数量
+func TestAPISearchNewPost(t *testing.T) {
+	defer openTestDB(t)()
+	user := &models.User{Name: "admin", Role: models.RoleAdmin, Active: true}
+	if err := models.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := testRouter(user, nil)
+	w := doJSON(router, "POST", "/api/v1/posts", gin.H{"title": "Searchable gopher", "content": "text", "published": true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create post: %d %s", w.Code, w.Body)
+	}
+	var created struct {
+		Data apiPost `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	models.AddReaction(int64(created.Data.ID), 42, models.ReactionKinds[0].Type)
+
+	w = doJSON(router, "GET", "/api/v1/search?q=gopher", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []apiSearchResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Post.ID != created.Data.ID {
+		t.Fatalf("new post not found: %s", w.Body)
+	}
+	if got := resp.Data[0].Reactions[models.ReactionKinds[0].Name]; got != 1 {
+		t.Errorf("reaction count = %d, want 1: %s", got, w.Body)
+	}
+}
+
+// TestAPINameInTrash 名称被回收站中的标签或用户占用时返回 409，而不是数据库错误
+func TestAPINameInTrash(t *testing.T) {
+	defer openTestDB(t)()
+	admin := &models.User{Name: "admin", Role: models.RoleAdmin, Active: true}
+	if err := models.DB.Create(admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	tag := &models.Tag{Name: "go"}
+	user := &models.User{Name: "bob", Role: models.RoleAuthor}
+	for _, v := range []interface{}{tag, user} {
+		if err := models.DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tag.Delete()
+	user.Delete()
+	router := testRouter(admin, nil)
+
+	cases := []struct {
+		method, path string
+		body         gin.H
+	}{
+		{"POST", "/api/v1/tags", gin.H{"name": "go"}},
+		{"POST", "/api/v1/users", gin.H{"name": "bob", "password": "secret-password"}},
+		{"PATCH", "/api/v1/users/1", gin.H{"name": "bob"}},
+	}
+	for _, c := range cases {
+		w := doJSON(router, c.method, c.path, c.body)
+		if w.Code != http.StatusConflict || !bytes.Contains(w.Body.Bytes(), []byte("name is in the trash")) {
+			t.Errorf("%s %s: %d %s", c.method, c.path, w.Code, w.Body)
+		}
+	}
+}
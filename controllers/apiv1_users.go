@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiUser struct {
+	ID               uint64    `json:"id"`
+	Name             string    `json:"name"`
+	Email            string    `json:"email"`
+	Intro            string    `json:"intro"`
+	GitHubURL        string    `json:"github_url"`
+	Role             string    `json:"role"`
+	Active           bool      `json:"active"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// apiUserInput 创建或修改用户的请求体，修改时省略的字段保持不变
+type apiUserInput struct {
+	Name     *string `json:"name" doc:"Required when creating"`
+	Email    *string `json:"email"`
+	Password *string `json:"password" doc:"Required when creating, never returned"`
+	Role     *string `json:"role" doc:"admin / editor / author / contributor, defaults to contributor"`
+	Active   *bool   `json:"active" doc:"Defaults to true"`
+}
+
+func newAPIUser(user *models.User) apiUser {
+	return apiUser{
+		ID:               user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		Intro:            user.Intro,
+		GitHubURL:        user.GitHubUrl,
+		Role:             user.Role,
+		Active:           user.Active,
+		TwoFactorEnabled: user.TOTPEnabled,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
+func APIListUsers(c *gin.Context) {
+	page, perPage, ok := apiPaging(c)
+	if !ok {
+		return
+	}
+	users, total, err := models.ListUsersPage((page-1)*perPage, perPage)
+	if err != nil {
+		apiError(c, "list users", err)
+		return
+	}
+	data := make([]apiUser, 0, len(users))
+	for _, user := range users {
+		data = append(data, newAPIUser(user))
+	}
+	apiList(c, data, page, perPage, total)
+}
+
+func apiUserByID(c *gin.Context) *models.User {
+	id, ok := apiParamID(c)
+	if !ok {
+		return nil
+	}
+	user, err := models.GetUserByID(id)
+	if err != nil {
+		apiNotFoundOr(c, "get user", err)
+		return nil
+	}
+	return user
+}
+
+func APIGetUser(c *gin.Context) {
+	user := apiUserByID(c)
+	if user == nil {
+		return
+	}
+	apiOK(c, http.StatusOK, newAPIUser(user))
+}
+
+func APICreateUser(c *gin.Context) {
+	var in apiUserInput
+	if !apiBind(c, &in) {
+		return
+	}
+	if in.Name == nil || strings.TrimSpace(*in.Name) == "" || in.Password == nil {
+		apiFail(c, http.StatusBadRequest, apiBadRequest, "name and password are required")
+		return
+	}
+	user := &models.User{Role: models.RoleContributor, Active: true}
+	if !applyUserInput(c, user, &in) {
+		return
+	}
+	if err := user.Insert(); err != nil {
+		apiError(c, "create user", err)
+		return
+	}
+	apiOK(c, http.StatusCreated, newAPIUser(user))
+}
+
+func APIUpdateUser(c *gin.Context) {
+	user := apiUserByID(c)
+	if user == nil {
+		return
+	}
+	var in apiUserInput
+	if !apiBind(c, &in) {
+		return
+	}
+	// 不能修改自己的角色或停用自己，避免唯一的管理员失去后台管理权限
+	if user.ID == currentUserID(c) &&
+		(in.Role != nil && *in.Role != user.Role || in.Active != nil && !*in.Active) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "cannot change your own role or deactivate yourself")
+		return
+	}
+	if !applyUserInput(c, user, &in) {
+		return
+	}
+	if err := user.Update(); err != nil {
+		apiError(c, "update user", err)
+		return
+	}
+	apiOK(c, http.StatusOK, newAPIUser(user))
+}
+
+// applyUserInput 校验请求体并写入用户，失败时输出错误并返回 false
+func applyUserInput(c *gin.Context, user *models.User, in *apiUserInput) bool {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			apiFail(c, http.StatusBadRequest, apiBadRequest, "name must not be empty")
+			return false
+		}
+		if existing, err := models.GetUserByName(name); err == nil && existing.ID != user.ID {
+			apiFail(c, http.StatusConflict, apiConflict, "user name already exists")
+			return false
+		}
+		if models.NameInTrash(models.TrashUsers, name, user.ID) {
+			apiFail(c, http.StatusConflict, apiConflict, "name is in the trash")
+			return false
+		}
+		user.Name = name
+	}
+	if in.Role != nil {
+		if !models.IsRole(*in.Role) {
+			apiFail(c, http.StatusBadRequest, apiBadRequest, "unknown role")
+			return false
+		}
+		user.Role = *in.Role
+	}
+	if in.Email != nil {
+		user.Email = *in.Email
+	}
+	if in.Active != nil {
+		user.Active = *in.Active
+	}
+	if in.Password != nil {
+		if err := user.SetPassword(*in.Password); err != nil {
+			apiFail(c, http.StatusBadRequest, apiBadRequest, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+func APIDeleteUser(c *gin.Context) {
+	user := apiUserByID(c)
+	if user == nil {
+		return
+	}
+	if user.ID == currentUserID(c) {
+		apiFail(c, http.StatusForbidden, apiForbidden, "cannot delete yourself")
+		return
+	}
+	if err := user.Delete(); err != nil {
+		apiError(c, "delete user", err)
+		return
+	}
+	apiOK(c, http.StatusNoContent, nil)
+}
@@ -2,45 +2,68 @@ package controllers
 
 import (
 	"fmt"
-	"html/template"
 	"lyanna/models"
 	"lyanna/utils"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
 )
 
 func Index(c *gin.Context) {
-	var (
-		posts []*models.Post
-		err   error
-	)
-	posts, err = models.ListPublishedPost("")
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+	listPublishedPosts(c, 1)
+}
+
+func PostPage(c *gin.Context) {
+	page, ok := pageParam(c.Param("page"))
+	if !ok {
+		pageNotFound(c)
 		return
 	}
-	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostID(post.ID)
-	}
+	listPublishedPosts(c, page)
+}
+
+// listPublishedPosts 首页第 page 页的文章
+func listPublishedPosts(c *gin.Context, page int) {
 	pagination := utils.Pagination{
-		CurrentPage: 1,
+		CurrentPage: page,
 		PerPage:     models.Conf.General.PerPage,
-		Total:       len(posts),
 	}
-	var perPosts []*models.Post
-	if models.Conf.General.PerPage > len(posts) {
-		perPosts = posts
-	} else {
-		perPosts = posts[:models.Conf.General.PerPage]
+	published := true
+	posts, total, err := models.ListPostsByFilter(models.PostFilter{Published: &published}, pagination.Offset(), pagination.PerPage)
+	if err != nil {
+		msg := fmt.Sprintf("list published posts err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	pagination.Total = total
+	if pagination.OutOfRange() {
+		pageNotFound(c)
+		return
+	}
+	if err := models.LoadPostRelations(posts); err != nil {
+		msg := fmt.Sprintf("load post relations err:%v", err)
+		Logger.Error(msg)
 	}
-
 	c.HTML(http.StatusOK, "front/index.html", gin.H{
-		"posts":      perPosts,
+		"posts":      posts,
 		"pagination": &pagination,
+		"feeds":      feedLinks("", ""),
+	})
+}
+
+// pageParam 解析页码，页码必须是正整数
+func pageParam(value string) (int, bool) {
+	page, err := strconv.Atoi(value)
+	return page, err == nil && page > 0
+}
+
+// pageNotFound 页码超出范围时返回 404
+func pageNotFound(c *gin.Context) {
+	c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+		"message": "Not Found page!",
 	})
 }
 
@@ -89,76 +112,49 @@ func AboutMe(c *gin.Context) {
 	}
 	tags, _ := models.ListTagByPostID(post.ID)
 	post.Tags = tags
-	content := post.Content
 	gitHubUser, _ := c.Get(models.CONTEXT_USER_KEY)
-	policy := bluemonday.UGCPolicy()
-	unsafe := blackfriday.MarkdownCommon([]byte(content))
-	contentHtml := template.HTML(string(policy.SanitizeBytes(unsafe)))
+	rendered := cachedPost(post)
 	c.HTML(http.StatusOK, "front/post.html", gin.H{
 		"Post":        post,
-		"contentHtml": contentHtml,
+		"contentHtml": rendered.HTML,
+		"toc":         rendered.TOC,
 		"Githubuser":  gitHubUser,
 	})
 
 }
 
+// GetSearch 搜索页，q 为空时只显示搜索框
 func GetSearch(c *gin.Context) {
-	c.HTML(http.StatusOK, "front/search.html", nil)
-}
-
-func PostSearch(c *gin.Context) {
-	var (
-		posts []*models.Post
-		err   error
-	)
-	posts, err = models.ListPublishedPost("")
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+	query := strings.TrimSpace(c.Query("q"))
+	page, ok := pageParam(c.DefaultQuery("page", "1"))
+	if !ok {
+		pageNotFound(c)
 		return
 	}
-	var ret []map[string]interface{}
-	for _, post := range posts {
-		var Posts = make(map[string]interface{}, 1)
-		post.Tags, _ = models.ListTagByPostID(post.ID)
-		Posts["url"] = post.Url()
-		Posts["tags"] = post.GetTagsArray()
-		Posts["title"] = post.Title
-		Posts["content"] = post.Content
-		ret = append(ret, Posts)
+	pagination := utils.Pagination{
+		CurrentPage: page,
+		PerPage:     models.Conf.General.PerPage,
 	}
-	c.JSON(http.StatusOK, ret)
-}
-
-func PostPage(c *gin.Context) {
 	var (
-		posts []*models.Post
-		err   error
+		results []*models.SearchResult
+		err     error
 	)
-	page := c.Param("page")
-	pageInt, _ := strconv.ParseInt(page, 10, 32)
-	posts, err = models.ListPublishedPost("")
-	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
+	if query != "" {
+		results, pagination.Total, err = models.SearchPosts(query, pagination.Offset(), pagination.PerPage)
+		if err != nil {
+			msg := fmt.Sprintf("search posts err:%v", err)
+			Logger.Error(msg)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
 	}
-	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostID(post.ID)
-	}
-	pagination := utils.Pagination{
-		CurrentPage: int(pageInt),
-		PerPage:     models.Conf.General.PerPage,
-		Total:       len(posts),
-	}
-	start := (int(pageInt) - 1) * models.Conf.General.PerPage
-	var end int
-	if start+models.Conf.General.PerPage > len(posts) {
-		end = len(posts)
-	} else {
-		end = start + models.Conf.General.PerPage
+	if pagination.OutOfRange() {
+		pageNotFound(c)
+		return
 	}
-	perPosts := posts[start:end]
-	c.HTML(http.StatusOK, "front/errors.html", gin.H{
-		"posts":      perPosts,
+	c.HTML(http.StatusOK, "front/search.html", gin.H{
+		"query":      query,
+		"results":    results,
 		"pagination": &pagination,
 	})
 }
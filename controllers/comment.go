@@ -1,38 +1,116 @@
 package controllers
 
 import (
-	"html/template"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"lyanna/models"
+	"lyanna/render"
+	"lyanna/spam"
 	"lyanna/utils"
 	"net/http"
+	"net/url"
 	"strconv"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
 )
 
+// SpamChecker 评论保存前调用的垃圾评论检测器，由 main 根据配置设置
+var SpamChecker spam.SpamChecker = spam.Nop{}
+
+// spamComment 把评论转换为垃圾评论检测器的输入
+func spamComment(comment *models.Comment, c *gin.Context) *spam.Comment {
+	sc := &spam.Comment{Content: comment.Content}
+	if gitUser, err := models.GetGitUserByGid(comment.GitHubID); err == nil {
+		sc.Author = gitUser.NickName
+		sc.Email = gitUser.Email
+		sc.AuthorURL = gitUser.Url
+	}
+	if c != nil {
+		sc.IP = c.ClientIP()
+		sc.UserAgent = c.Request.UserAgent()
+		sc.Permalink = c.Request.Referer()
+	}
+	return sc
+}
+
 func CreateComment(c *gin.Context) {
+	postID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	saveComment(c, postID, 0)
+}
+
+// ReplyComment 回复评论，父评论必须属于同一篇文章
+func ReplyComment(c *gin.Context) {
+	postID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	parent, err := models.GetCommentByID(c.PostForm("ref_id"))
+	if err != nil || parent.PostID != postID || !parent.Approved() {
+		c.JSON(http.StatusOK, gin.H{
+			"r":   1,
+			"msg": "Comment not exist",
+		})
+		return
+	}
+	saveComment(c, postID, int64(parent.ID))
+}
+
+func saveComment(c *gin.Context, postID int64, refID int64) {
 	content := c.Request.PostFormValue("content")
-	postIDStr := c.Param("id")
-	postID, _ := strconv.ParseInt(postIDStr, 10, 64)
 	session := sessions.Default(c)
 	gid := session.Get(models.SESSION_KEY)
 	comment := models.Comment{
 		GitHubID: gid.(int64),
 		PostID:   postID,
 		Content:  content,
-		RefID:    0,
+		RefID:    refID,
 	}
-	_ = models.CommentCreatAndGetID(&comment)
+	_ = insertComment(c, &comment)
 	commentHTML, _ := utils.RenderSingleComment(&comment)
 	c.JSON(http.StatusOK, gin.H{
-		"r":    0,
-		"html": commentHTML,
+		"r":       0,
+		"html":    commentHTML,
+		"ref_id":  refID,
+		"pending": !comment.Approved(),
 	})
 }
 
+// insertComment 经过垃圾评论检测和审核策略设置状态后保存新评论
+func insertComment(c *gin.Context, comment *models.Comment) error {
+	isSpam, err := SpamChecker.IsSpam(spamComment(comment, c))
+	if err != nil {
+		msg := fmt.Sprintf("spam check err:%v", err)
+		Logger.Error(msg)
+	}
+	if isSpam {
+		comment.Status = models.CommentSpam
+	} else {
+		models.ModerateComment(comment)
+	}
+	return models.CommentCreatAndGetID(comment)
+}
+
+// commentsPerPage 文章页每页显示的顶层评论数
+const commentsPerPage = 10
+
+var errPageOutOfRange = errors.New("page out of range")
+
+// listCommentPage 按顶层评论分页查询文章的评论，返回本页评论和总页数
+func listCommentPage(postID, page, perPage int) (*models.CommentPage, int, error) {
+	if perPage <= 0 {
+		perPage = commentsPerPage
+	}
+	pagination := utils.Pagination{CurrentPage: page, PerPage: perPage}
+	comments, err := models.ListCommentPageByPostID(postID, pagination.Offset(), perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	pagination.Total = comments.Threads
+	if pagination.OutOfRange() {
+		return nil, 0, errPageOutOfRange
+	}
+	return comments, pagination.AllPages(), nil
+}
+
 func Comments(c *gin.Context) {
 	postIDStr := c.Param("id")
 	postID, _ := strconv.ParseInt(postIDStr, 10, 64)
@@ -44,32 +122,30 @@ func Comments(c *gin.Context) {
 		})
 		return
 	}
-	pageStr := c.DefaultQuery("page", "1")
-	perPageStr := c.DefaultQuery("per_page", "10")
-	page, _ := strconv.ParseInt(pageStr, 10, 64)
-	perPage, _ := strconv.ParseInt(perPageStr, 10, 64)
-	comments, _ := models.ListCommentsByPostID(int(postID))
-	start := (page - 1) * perPage
-	var end int64
-	if (start + perPage) > int64(len(comments))-1 {
-		end = int64(len(comments))
-	} else {
-		end = start + perPage
+	page, ok := pageParam(c.DefaultQuery("page", "1"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"r": 1, "msg": "Page not found"})
+		return
 	}
-	comments = comments[start:end]
-	var pages int
-	if len(comments)%10 == 0 {
-		pages = len(comments) / 10
-	} else {
-		pages = len(comments)/10 + 1
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "10"))
+	comments, pages, err := listCommentPage(int(postID), page, perPage)
+	if err == errPageOutOfRange {
+		c.JSON(http.StatusNotFound, gin.H{"r": 1, "msg": "Page not found"})
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("list comments by postID err:%v", err)
+		Logger.Error(msg)
+		c.JSON(http.StatusInternalServerError, gin.H{"r": 1, "msg": "List comments failed"})
+		return
 	}
-	gitHubUser, _ := c.Get(models.CONTEXT_USER_KEY)
+	gitHubUser, _ := c.Get(models.CONTEXT_GIT_USER_KEY)
 	hh := utils.HH{
-		Comments:   comments,
+		Comments:   comments.Roots,
 		Githubuser: gitHubUser,
 		Post:       post,
 		Pages:      pages,
-		CommentNum: len(comments),
+		CommentNum: comments.Total,
 	}
 	commentsHTML, _ := utils.RenderAllComment(hh)
 	c.JSON(http.StatusOK, gin.H{
@@ -80,11 +156,138 @@ func Comments(c *gin.Context) {
 
 func CommentMarkdown(c *gin.Context) {
 	commentContent := c.Request.PostFormValue("text")
-	policy := bluemonday.UGCPolicy()
-	unsafe := blackfriday.MarkdownCommon([]byte(commentContent))
-	commentHtml := template.HTML(string(policy.SanitizeBytes(unsafe)))
+	commentHtml := render.Comment.HTML(commentContent)
 	c.JSON(http.StatusOK, gin.H{
 		"r":    0,
 		"text": commentHtml,
 	})
 }
+
+// commentActions 后台批量操作对应的评论状态
+var commentActions = map[string]string{
+	"approve": models.CommentApproved,
+	"pending": models.CommentPending,
+	"spam":    models.CommentSpam,
+	"reject":  models.CommentDeleted,
+}
+
+func AdminComments(c *gin.Context) {
+	status := c.DefaultQuery("status", models.CommentPending)
+	if !models.IsCommentStatus(status) {
+		status = models.CommentPending
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := models.Conf.General.PerPage
+	counts, err := models.CountCommentsGroupByStatus()
+	if err != nil {
+		msg := fmt.Sprintf("count comments err:%v", err)
+		Logger.Error(msg)
+	}
+	comments, err := models.ListCommentsByStatus(status, (page-1)*perPage, perPage)
+	if err != nil {
+		msg := fmt.Sprintf("list comments err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	pagination := utils.Pagination{
+		CurrentPage: page,
+		PerPage:     perPage,
+		Total:       counts[status],
+	}
+	c.HTML(http.StatusOK, "admin/list_comment.html", adminH(c, gin.H{
+		"comments":   comments,
+		"status":     status,
+		"statuses":   models.CommentStatuses,
+		"counts":     counts,
+		"pagination": &pagination,
+		"msg":        c.Query("msg"),
+	}))
+}
+
+func AdminCommentsAction(c *gin.Context) {
+	status, ok := commentActions[c.PostForm("action")]
+	var ids []uint64
+	for _, v := range c.PostFormArray("ids") {
+		if id, err := strconv.ParseUint(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	from := c.DefaultPostForm("status", models.CommentPending)
+	if c.PostForm("action") == "trash" && len(ids) > 0 {
+		if err := models.DeleteComments(ids); err != nil {
+			msg := fmt.Sprintf("delete comments err:%v", err)
+			Logger.Error(msg)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		msg := fmt.Sprintf("%d comments were moved to the trash.", len(ids))
+		c.Redirect(http.StatusFound, "/admin/comments?status="+url.QueryEscape(from)+"&msg="+url.QueryEscape(msg))
+		return
+	}
+	if !ok || len(ids) == 0 {
+		c.Redirect(http.StatusFound, "/admin/comments?status="+url.QueryEscape(from))
+		return
+	}
+	comments, err := models.ListCommentsByIDs(ids)
+	if err != nil {
+		msg := fmt.Sprintf("list comments by ids err:%v", err)
+		Logger.Error(msg)
+	}
+	if err := models.UpdateCommentsStatus(ids, status); err != nil {
+		msg := fmt.Sprintf("update comments status err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	learnComments(comments, status)
+	msg := fmt.Sprintf("%d comments were marked as %s.", len(ids), status)
+	c.Redirect(http.StatusFound, "/admin/comments?status="+url.QueryEscape(from)+"&msg="+url.QueryEscape(msg))
+}
+
+// learnComments 用管理员的审核结果训练垃圾评论检测器：标记为 spam 的作为垃圾样本，
+// 从待审核或 spam 改为通过的作为正常样本；已按另一类别训练过的评论先撤销之前的训练
+func learnComments(comments []*models.Comment, status string) {
+	for _, comment := range comments {
+		var class string
+		switch {
+		case status == models.CommentSpam && comment.Status != models.CommentSpam:
+			class = models.TrainedSpam
+		case status == models.CommentApproved && (comment.Status == models.CommentPending || comment.Status == models.CommentSpam):
+			class = models.TrainedHam
+		default:
+			continue
+		}
+		if comment.Trained == class {
+			continue
+		}
+		if comment.Trained != "" {
+			// 按训练时的内容撤销，评论者的昵称和主页可能已经改变
+			var trained spam.Comment
+			if err := json.Unmarshal([]byte(comment.TrainedSample), &trained); err != nil {
+				msg := fmt.Sprintf("spam unlearn err:%v", err)
+				Logger.Error(msg)
+				continue
+			}
+			if err := SpamChecker.Unlearn(&trained, comment.Trained == models.TrainedSpam); err != nil {
+				msg := fmt.Sprintf("spam unlearn err:%v", err)
+				Logger.Error(msg)
+				continue
+			}
+		}
+		sc := spamComment(comment, nil)
+		if err := SpamChecker.Learn(sc, class == models.TrainedSpam); err != nil {
+			msg := fmt.Sprintf("spam learn err:%v", err)
+			Logger.Error(msg)
+			continue
+		}
+		sample, _ := json.Marshal(sc)
+		if err := models.SetCommentTrained(comment.ID, class, string(sample)); err != nil {
+			msg := fmt.Sprintf("set comment trained err:%v", err)
+			Logger.Error(msg)
+		}
+	}
+}
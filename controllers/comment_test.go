@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"lyanna/spam"
+	"testing"
+)
+
+// TestLearnCommentsRelabel 管理员改判评论时撤销之前的训练，统计中只保留最后一次的类别
+func TestLearnCommentsRelabel(t *testing.T) {
+	defer openTestDB(t)()
+	store := spam.NewMemoryStore()
+	defer func(old spam.SpamChecker) { SpamChecker = old }(SpamChecker)
+	SpamChecker = spam.NewBayes(store, 0.9, 1)
+
+	gitUser := &models.GitHubUser{GID: 42, NickName: "spammer", Url: "http://pills.example"}
+	if err := models.DB.Create(gitUser).Error; err != nil {
+		t.Fatal(err)
+	}
+	comment := &models.Comment{GitHubID: 42, PostID: 1, Content: "cheap pills", Status: models.CommentPending}
+	if err := comment.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range []string{models.CommentSpam, models.CommentApproved, models.CommentSpam} {
+		// 评论者修改了昵称和主页，撤销时仍按训练时的内容
+		models.DB.Model(gitUser).Updates(map[string]interface{}{"nick_name": fmt.Sprintf("renamed%d", i), "url": fmt.Sprintf("http://site%d.example", i)})
+		comments, err := models.ListCommentsByIDs([]uint64{comment.ID})
+		if err != nil || len(comments) != 1 {
+			t.Fatalf("list comments: %v", err)
+		}
+		learnComments(comments, status)
+		if err := models.UpdateCommentsStatus([]uint64{comment.ID}, status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, _ := store.Stats([]string{"pills"})
+	if stats.Docs[spam.Ham] != 0 || stats.Docs[spam.Spam] != 1 {
+		t.Errorf("docs = %v, want one spam sample only", stats.Docs)
+	}
+	if stats.Counts["pills"][spam.Ham] != 0 {
+		t.Errorf("pills still counted as ham: %v", stats.Counts["pills"])
+	}
+	// 只剩最后一次训练的内容：评论正文、主页和昵称
+	if stats.Totals[spam.Ham] != 0 || stats.Totals[spam.Spam] != 8 {
+		t.Errorf("totals = %v, want only the last spam sample", stats.Totals)
+	}
+	comments, _ := models.ListCommentsByIDs([]uint64{comment.ID})
+	if comments[0].Trained != models.TrainedSpam {
+		t.Errorf("trained = %q, want %q", comments[0].Trained, models.TrainedSpam)
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"lyanna/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CSRFFormField = "_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		Logger.Fatal("generate csrf token err:" + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// EnsureCSRFToken 返回会话中的 CSRF token，不存在时生成并保存
+func EnsureCSRFToken(c *gin.Context) string {
+	s := sessions.Default(c)
+	if token, ok := s.Get(models.SESSION_CSRF_KEY).(string); ok && token != "" {
+		return token
+	}
+	token := newCSRFToken()
+	s.Set(models.SESSION_CSRF_KEY, token)
+	s.Save()
+	return token
+}
+
+// resetCSRFToken 登录状态变化并清空会话后重新生成 token，本次请求渲染的页面使用新 token
+func resetCSRFToken(c *gin.Context) {
+	token := newCSRFToken()
+	sessions.Default(c).Set(models.SESSION_CSRF_KEY, token)
+	c.Set(models.CONTEXT_CSRF_KEY, token)
+}
+
+// csrfToken 当前请求可用于模板的 token，由 ShareData 放入 context
+func csrfToken(c *gin.Context) string {
+	return c.GetString(models.CONTEXT_CSRF_KEY)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFRequired 校验非安全方法请求中的 token，表单使用 _csrf 字段，AJAX 使用 X-CSRF-Token 请求头；
+// 使用 API token 认证的请求不依赖 cookie，不需要校验
+func CSRFRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSafeMethod(c.Request.Method) || usingAPIToken(c) {
+			c.Next()
+			return
+		}
+		expected, _ := sessions.Default(c).Get(models.SESSION_CSRF_KEY).(string)
+		token := c.GetHeader(CSRFHeader)
+		if token == "" {
+			token = c.PostForm(CSRFFormField)
+		}
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			c.Next()
+			return
+		}
+		csrfFailed(c)
+	}
+}
+
+func csrfFailed(c *gin.Context) {
+	msg := "CSRF token missing or invalid, please reload the page and try again."
+	if c.GetHeader(CSRFHeader) != "" || c.GetHeader("X-Requested-With") == "XMLHttpRequest" ||
+		strings.Contains(c.GetHeader("Accept"), "application/json") || strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"r": 1, "code": "csrf_failed", "msg": msg})
+		return
+	}
+	c.HTML(http.StatusForbidden, "errors/403.html", gin.H{
+		"message": msg,
+		"referer": c.Request.Referer(),
+	})
+	c.Abort()
+}
@@ -1,13 +1,15 @@
 package controllers
 
 import (
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"lyanna/models"
 	"net/http"
+	"strconv"
 )
 
 func AdminLogin(c *gin.Context) {
-	c.HTML(http.StatusOK,"admin/login.html",nil)
+	c.HTML(http.StatusOK, "admin/login.html", adminH(c, nil))
 }
 
 func AdminIndex(c *gin.Context) {
@@ -15,5 +17,66 @@ func AdminIndex(c *gin.Context) {
 	if user == nil {
 		c.Redirect(http.StatusMovedPermanently,"/admin/login")
 	}
-	c.HTML(http.StatusOK, "admin/errors.html",nil)
+	h := gin.H{}
+	if u := currentUser(c); u != nil && u.Can(models.PermManageSettings) {
+		stats, err := models.GetRenderCacheStats()
+		if err != nil {
+			msg := fmt.Sprintf("get render cache stats err:%v", err)
+			Logger.Error(msg)
+		}
+		h["render_cache"] = stats
+	}
+	c.HTML(http.StatusOK, "admin/errors.html", adminH(c, h))
+}
+
+// currentUser 返回当前登录的后台用户，未登录时为 nil
+func currentUser(c *gin.Context) *models.User {
+	if user, ok := c.Get(models.CONTEXT_USER_KEY); ok {
+		if u, ok := user.(*models.User); ok {
+			return u
+		}
+	}
+	return nil
+}
+
+func currentUserID(c *gin.Context) uint64 {
+	if user := currentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// adminH 为后台页面附加当前用户和 CSRF token，模板据此隐藏当前用户无权执行的操作
+func adminH(c *gin.Context, h gin.H) gin.H {
+	if h == nil {
+		h = gin.H{}
+	}
+	h["current_user"] = currentUser(c)
+	h["csrf_token"] = csrfToken(c)
+	return h
+}
+
+// editablePost 读取当前用户可编辑的文章，不存在或无权限时渲染错误页并返回 nil
+func editablePost(c *gin.Context, id string) *models.Post {
+	postID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Not Found post!",
+		})
+		return nil
+	}
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Not Found post!",
+		})
+		return nil
+	}
+	if !currentUser(c).CanEditPost(post) {
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "Forbidden!",
+		})
+		return nil
+	}
+	return post
 }
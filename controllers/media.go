@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"lyanna/media"
+	"lyanna/models"
+	"lyanna/utils"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errMediaTooLarge = errors.New("file is too large")
+
+// uploadMedia 检查并保存一个上传的文件，返回媒体记录、是否为已存在的文件和出错时的 HTTP 状态码
+func uploadMedia(c *gin.Context, header *multipart.FileHeader) (*models.Media, bool, int, error) {
+	maxSize := models.Conf.Media.MaxSize
+	if maxSize > 0 && header.Size > maxSize {
+		return nil, false, http.StatusRequestEntityTooLarge, errMediaTooLarge
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, false, http.StatusBadRequest, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, false, http.StatusBadRequest, err
+	}
+	file, err := media.Process(header.Filename, header.Header.Get("Content-Type"), data)
+	if err == media.ErrUnsupportedType || err == media.ErrTypeMismatch {
+		return nil, false, http.StatusUnsupportedMediaType, err
+	}
+	if err != nil {
+		return nil, false, http.StatusBadRequest, err
+	}
+	m, duplicate, err := models.SaveMedia(file, currentUserID(c))
+	if err != nil {
+		msg := fmt.Sprintf("save media err:%v", err)
+		Logger.Error(msg)
+		return nil, false, http.StatusInternalServerError, err
+	}
+	return m, duplicate, http.StatusOK, nil
+}
+
+// UploadMedia 编辑器上传文件，返回可以直接插入文章的 Markdown
+func UploadMedia(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"r": 1, "msg": "file is required"})
+		return
+	}
+	m, duplicate, status, err := uploadMedia(c, header)
+	if err != nil {
+		c.JSON(status, gin.H{"r": 1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"r":         0,
+		"id":        m.ID,
+		"url":       m.URL(),
+		"markdown":  m.Markdown(),
+		"duplicate": duplicate,
+	})
+}
+
+func AdminMedia(c *gin.Context) {
+	renderMediaList(c, 1, gin.H{"msg": c.Query("msg"), "errors": c.QueryArray("error")})
+}
+
+func AdminMediaPage(c *gin.Context) {
+	page, ok := pageParam(c.Param("page"))
+	if !ok {
+		pageNotFound(c)
+		return
+	}
+	renderMediaList(c, page, gin.H{})
+}
+
+// renderMediaList 媒体库的第 page 页，data 为模板需要的其他数据
+func renderMediaList(c *gin.Context, page int, data gin.H) {
+	pagination := utils.Pagination{
+		CurrentPage: page,
+		PerPage:     models.Conf.General.PerPage,
+	}
+	items, total, err := models.ListMedia(pagination.Offset(), pagination.PerPage)
+	if err != nil {
+		msg := fmt.Sprintf("list media err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	pagination.Total = total
+	if pagination.OutOfRange() {
+		pageNotFound(c)
+		return
+	}
+	data["media"] = items
+	data["pagination"] = &pagination
+	c.HTML(http.StatusOK, "admin/media.html", adminH(c, data))
+}
+
+// PostAdminMedia 媒体库页面一次上传多个文件
+func PostAdminMedia(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		c.Redirect(http.StatusFound, "/admin/media?error="+url.QueryEscape("please choose files to upload"))
+		return
+	}
+	var saved, duplicates int
+	query := url.Values{}
+	for _, header := range form.File["files"] {
+		_, duplicate, _, err := uploadMedia(c, header)
+		switch {
+		case err != nil:
+			query.Add("error", fmt.Sprintf("%s: %v", header.Filename, err))
+		case duplicate:
+			duplicates++
+		default:
+			saved++
+		}
+	}
+	query.Set("msg", fmt.Sprintf("%d files uploaded, %d already in the library.", saved, duplicates))
+	c.Redirect(http.StatusFound, "/admin/media?"+query.Encode())
+}
+
+func DeleteMedia(c *gin.Context) {
+	m, err := models.GetMediaByID(c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Media not found!",
+		})
+		return
+	}
+	if err := m.Delete(); err != nil {
+		msg := fmt.Sprintf("delete media err:%v", err)
+		Logger.Error(msg)
+		c.Redirect(http.StatusFound, "/admin/media?error="+url.QueryEscape(msg))
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/media?msg="+url.QueryEscape(m.Name+" was deleted."))
+}
+
+// MediaDerivative 图片的缩小版本，地址中的签名不正确时返回 403
+func MediaDerivative(c *gin.Context) {
+	width, err := strconv.Atoi(c.Param("width"))
+	if err != nil || models.MediaResizer == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	name, err := models.MediaResizer.Derivative(strings.TrimPrefix(c.Param("key"), "/"), width, c.Query("s"))
+	switch err {
+	case nil:
+	case media.ErrInvalidSignature:
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	case media.ErrNotFound, media.ErrUnsupportedType:
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	default:
+		msg := fmt.Sprintf("resize media err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// 文件按内容哈希命名，同一地址的内容不会变化
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.File(name)
+}
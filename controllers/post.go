@@ -1,119 +1,72 @@
 package controllers
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"lyanna/models"
+	"lyanna/render"
 	"lyanna/utils"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
 )
 
+// Logger 控制器使用的日志，main 在 models.Init 之后替换为配置好的日志
 var Logger = models.Logger
 
-// blackfriday 配置
-const (
-	commonHtmlFlags = 0 |
-		blackfriday.HTML_USE_XHTML |
-		blackfriday.HTML_USE_SMARTYPANTS |
-		blackfriday.HTML_SMARTYPANTS_FRACTIONS |
-		blackfriday.HTML_SMARTYPANTS_DASHES |
-		blackfriday.HTML_SMARTYPANTS_LATEX_DASHES |
-		blackfriday.HTML_NOFOLLOW_LINKS
-
-	commonExtensions = 0 |
-		blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
-		blackfriday.EXTENSION_TABLES |
-		blackfriday.EXTENSION_FENCED_CODE |
-		blackfriday.EXTENSION_AUTOLINK |
-		blackfriday.EXTENSION_STRIKETHROUGH |
-		blackfriday.EXTENSION_SPACE_HEADERS |
-		blackfriday.EXTENSION_HEADER_IDS |
-		blackfriday.EXTENSION_BACKSLASH_LINE_BREAK |
-		blackfriday.EXTENSION_DEFINITION_LISTS
-)
-
 func PostIndex(c *gin.Context) {
-	posts, err := models.ListPosts()
-	if err != nil {
-		msg := fmt.Sprintf("get all posts err:%v", err)
-		Logger.Fatal(msg)
-	}
-	for _, post := range posts {
-		tags, err := models.ListTagByPostID(post.ID)
-		if err != nil {
-			msg := fmt.Sprintf("list tag by postID err:%v", err)
-			Logger.Error(msg)
-			continue
-		}
-		post.Tags = tags
-	}
-	pagination := utils.Pagination{
-		CurrentPage: 1,
-		PerPage:     models.Conf.General.PerPage,
-		Total:       len(posts),
-	}
-	var perPosts []*models.Post
-	if models.Conf.General.PerPage > len(posts) {
-		perPosts = posts
-	} else {
-		perPosts = posts[:models.Conf.General.PerPage]
-	}
-	c.HTML(http.StatusOK, "admin/list_post.html", gin.H{
-		"posts":      perPosts,
-		"post_count": len(posts),
-		"pagination": &pagination,
-	})
+	renderPostList(c, 1, "")
 }
 
 func AdminPostPage(c *gin.Context) {
-	page := c.Param("page")
-	pageInt, _ := strconv.ParseInt(page, 10, 32)
-	posts, _ := models.ListPosts()
-	for _, post := range posts {
-		tags, err := models.ListTagByPostID(post.ID)
-		if err != nil {
-			msg := fmt.Sprintf("list tag by postID err:%v", err)
-			Logger.Error(msg)
-			continue
-		}
-		post.Tags = tags
+	page, ok := pageParam(c.Param("page"))
+	if !ok {
+		pageNotFound(c)
+		return
 	}
+	renderPostList(c, page, "")
+}
+
+// renderPostList 后台文章列表的第 page 页
+func renderPostList(c *gin.Context, page int, msg string) {
 	pagination := utils.Pagination{
-		CurrentPage: int(pageInt),
+		CurrentPage: page,
 		PerPage:     models.Conf.General.PerPage,
-		Total:       len(posts),
 	}
-	start := (int(pageInt) - 1) * models.Conf.General.PerPage
-	var end int
-	if start+models.Conf.General.PerPage > len(posts) {
-		end = len(posts)
-	} else {
-		end = start + models.Conf.General.PerPage
+	posts, total, err := models.ListPostsByFilter(models.PostFilter{}, pagination.Offset(), pagination.PerPage)
+	if err != nil {
+		msg := fmt.Sprintf("list posts err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
-	perPosts := posts[start:end]
-	c.HTML(http.StatusOK, "admin/list_post.html", gin.H{
-		"posts":      perPosts,
-		"post_count": len(posts),
+	pagination.Total = total
+	if pagination.OutOfRange() {
+		pageNotFound(c)
+		return
+	}
+	if err := models.LoadPostRelations(posts); err != nil {
+		msg := fmt.Sprintf("load post relations err:%v", err)
+		Logger.Error(msg)
+	}
+	c.HTML(http.StatusOK, "admin/list_post.html", adminH(c, gin.H{
+		"posts":      posts,
+		"post_count": total,
 		"pagination": &pagination,
-	})
+		"msg":        msg,
+	}))
 }
 
 func GetEditPost(c *gin.Context) {
-	id := c.Param("id")
-	postID, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		msg := fmt.Sprintf("parse uint error:%v", err)
-		Logger.Fatal(msg)
-	}
-	post, err := models.GetPostByID(postID)
-	if err != nil {
-		msg := fmt.Sprintf("get post by ID error:%v", err)
-		Logger.Fatal(msg)
+	post := editablePost(c, c.Param("id"))
+	if post == nil {
+		return
 	}
 	tags, err := models.ListTagByPostID(post.ID)
 	if err != nil {
@@ -135,12 +88,12 @@ func GetEditPost(c *gin.Context) {
 	for _, v := range post.Tags {
 		postTags = append(postTags, v.Name)
 	}
-	c.HTML(http.StatusOK, "admin/post.html", gin.H{
+	c.HTML(http.StatusOK, "admin/post.html", adminH(c, gin.H{
 		"post":     post,
 		"users":    users,
 		"allTags":  allTags,
 		"postTags": postTags,
-	})
+	}))
 }
 
 func GetNewPost(c *gin.Context) {
@@ -154,10 +107,10 @@ func GetNewPost(c *gin.Context) {
 		msg := fmt.Sprintf("list users error:%v", err)
 		Logger.Fatal(msg)
 	}
-	c.HTML(http.StatusOK, "admin/post.html", gin.H{
+	c.HTML(http.StatusOK, "admin/post.html", adminH(c, gin.H{
 		"allTags": allTags,
 		"users":   users,
-	})
+	}))
 }
 
 func AddPost(c *gin.Context) {
@@ -174,6 +127,11 @@ func AddPost(c *gin.Context) {
 	content := c.PostForm("content")
 	canComment := c.PostForm("can_comment") == "on"
 	publish := c.PostForm("publish") == "on"
+	user := currentUser(c)
+	// 不能编辑他人文章的用户只能以自己的名义发文
+	if !user.Can(models.PermEditOthersPosts) {
+		authorID = int64(user.ID)
+	}
 	post := &models.Post{
 		Title:      title,
 		Slug:       slug,
@@ -181,41 +139,29 @@ func AddPost(c *gin.Context) {
 		AuthorID:   int(authorID),
 		Content:    content,
 		CanComment: canComment,
-		Published:  publish,
 	}
-	err = models.PostCreatAndGetID(post)
-	if err != nil {
-		msg := fmt.Sprintf("PostCreatAndGetID error:%v", err)
-		Logger.Fatal(msg)
+	// 没有发布权限时只能保存为草稿
+	if user.CanPublishPost(post) {
+		post.Published = publish
+		setPostSchedule(c, post)
+	}
+	if err := models.PostCreatAndGetID(post); err != nil {
+		msg := fmt.Sprintf("create post err:%v", err)
+		Logger.Error(msg)
+		c.HTML(http.StatusInternalServerError, "errors/error.html", gin.H{
+			"message": "Failed to create the post!",
+		})
+		return
 	}
+	savePostRevision(post, currentUserID(c))
 	models.UpdateMultiTags([]string{}, tags, int(post.ID))
-	posts, err := models.ListPosts()
-	if err != nil {
-		msg := fmt.Sprintf("list posts error:%v", err)
-		Logger.Fatal(msg)
-	}
-	for _, post := range posts {
-		tags, err := models.ListTagByPostID(post.ID)
-		if err != nil {
-			msg := fmt.Sprintf("list tag by postID error:%v", err)
-			Logger.Error(msg)
-			continue
-		}
-		post.Tags = tags
-	}
-	c.HTML(http.StatusOK, "admin/list_post.html", gin.H{
-		"posts":      posts,
-		"post_count": len(posts),
-		"msg":        "Post was successfully created.",
-	})
+	renderPostList(c, 1, "Post was successfully created.")
 }
 
 func UpdatePost(c *gin.Context) {
-	id := c.Param("id")
-	pID, err := strconv.ParseInt(id, 10, 64)
-	if err != nil {
-		msg := fmt.Sprintf("parse int error:%v", err)
-		Logger.Fatal(msg)
+	post := editablePost(c, c.Param("id"))
+	if post == nil {
+		return
 	}
 	title := c.PostForm("title")
 	slug := c.PostForm("slug")
@@ -230,17 +176,26 @@ func UpdatePost(c *gin.Context) {
 	content := c.PostForm("content")
 	canComment := c.PostForm("can_comment") == "on"
 	publish := c.PostForm("publish") == "on"
-	post := &models.Post{
-		Title:      title,
-		Slug:       slug,
-		Summary:    summary,
-		AuthorID:   int(authorID),
-		Content:    content,
-		CanComment: canComment,
-		Published:  publish,
+	user := currentUser(c)
+	// 旧文章没有任何历史版本时，先保存修改前的内容
+	if count, _ := models.CountRevisionsByPostID(post.ID); count == 0 {
+		savePostRevision(post, uint64(post.AuthorID))
+	}
+	post.Title = title
+	post.Slug = slug
+	post.Summary = summary
+	if user.Can(models.PermEditOthersPosts) {
+		post.AuthorID = int(authorID)
+	}
+	post.Content = content
+	post.CanComment = canComment
+	// 没有发布权限时保持原有的发布状态和定时设置
+	if user.CanPublishPost(post) {
+		post.Published = publish
+		setPostSchedule(c, post)
 	}
-	post.ID = uint64(pID)
 	post.Update()
+	savePostRevision(post, currentUserID(c))
 	originPostTags, err := models.ListTagByPostID(post.ID)
 	if err != nil {
 		msg := fmt.Sprintf("list tag by postID error:%v", err)
@@ -248,54 +203,153 @@ func UpdatePost(c *gin.Context) {
 	}
 	originPostTagNames := models.GetTagNames(originPostTags)
 	models.UpdateMultiTags(originPostTagNames, tags, int(post.ID))
-	posts, err := models.ListPosts()
+	renderPostList(c, 1, "Update post successfully.")
+}
+
+func parseFormTime(c *gin.Context, key string) *time.Time {
+	value := c.PostForm(key)
+	if value == "" {
+		return nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04", value, time.Local)
 	if err != nil {
-		msg := fmt.Sprintf("list posts error:%v", err)
-		Logger.Fatal(msg)
+		return nil
 	}
-	for _, post := range posts {
-		tags, err := models.ListTagByPostID(post.ID)
-		if err != nil {
-			msg := fmt.Sprintf("list tag by postID error:%v", err)
-			Logger.Error(msg)
-			continue
+	return &t
+}
+
+// setPostSchedule 读取表单中的定时发布/下线时间，未到发布时间的文章先保持未发布，已过去的时间被忽略
+func setPostSchedule(c *gin.Context, post *models.Post) {
+	post.PublishAt = parseFormTime(c, "publish_at")
+	post.UnpublishAt = parseFormTime(c, "unpublish_at")
+	post.NormalizeSchedule(now())
+}
+
+// renderedPost 文章正文的渲染结果，整体缓存在 Redis 中
+type renderedPost struct {
+	HTML template.HTML     `json:"html"`
+	TOC  []*render.Heading `json:"toc"`
+}
+
+// renderPost 把文章的 Markdown 渲染为经过过滤的 HTML 和目录
+func renderPost(content string) *renderedPost {
+	doc := render.Post.Render(content)
+	return &renderedPost{HTML: template.HTML(doc.HTML), TOC: doc.TOC()}
+}
+
+// postRenderVersion 渲染规则或缓存格式变化时修改，使已缓存的文章全部失效
+const postRenderVersion = "4"
+
+// PostRenderConfig 影响文章渲染结果的配置（图片缩放地址、宽度、sizes 等），由 main 设置；
+// 参与渲染缓存的哈希，配置变化后已缓存的文章自动失效
+var PostRenderConfig string
+
+// postContentHash 文章渲染缓存的内容版本
+func postContentHash(content string) string {
+	sum := sha1.Sum([]byte(postRenderVersion + "\x00" + PostRenderConfig + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedPost 渲染文章正文，结果按文章 ID 和内容哈希缓存在 Redis 中
+func cachedPost(post *models.Post) *renderedPost {
+	hash := postContentHash(post.Content)
+	if cached, ok := models.GetRenderedContent(post.ID, hash); ok {
+		var rendered renderedPost
+		if err := json.Unmarshal([]byte(cached), &rendered); err == nil {
+			return &rendered
 		}
-		post.Tags = tags
 	}
-	c.HTML(http.StatusOK, "admin/list_post.html", gin.H{
-		"posts":      posts,
-		"post_count": len(posts),
-		"msg":        "Update post successfully.",
-	})
+	rendered := renderPost(post.Content)
+	if data, err := json.Marshal(rendered); err == nil {
+		models.SetRenderedContent(post.ID, hash, string(data))
+	}
+	return rendered
 }
 
 func PreviewGetPost(c *gin.Context) {
-	getPost(c, false)
+	postID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	post, err := models.GetPostByID(postID)
+	if err != nil {
+		c.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+	showPost(c, post, false)
 }
 
+// GetPost 文章页。路径按 permalink.pattern 解析，也接受旧的 /post/:id 和 /post/:slug；
+// 路径不是文章当前的链接时 301 跳转到当前链接。同时作为 NoRoute 处理其他未匹配的路径
 func GetPost(c *gin.Context) {
-	getPost(c, true)
+	var post *models.Post
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		post = findPermalinkPost(c.Request.URL.Path)
+	}
+	if post == nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Not Found post!",
+		})
+		return
+	}
+	if url := post.Url(); url != c.Request.URL.Path {
+		if c.Request.URL.RawQuery != "" {
+			url += "?" + c.Request.URL.RawQuery
+		}
+		c.Redirect(http.StatusMovedPermanently, url)
+		return
+	}
+	showPost(c, post, true)
 }
 
-func getPost(c *gin.Context, isPublish bool) {
+// findPermalinkPost 按链接查找已发布的文章，slug 找不到时再按旧 slug 查找
+func findPermalinkPost(path string) *models.Post {
+	if params, ok := models.PostPermalink.Match(path); ok {
+		if post := findPublishedPost(params["id"], params["slug"]); post != nil {
+			return post
+		}
+	}
+	if !strings.HasPrefix(path, "/post/") {
+		return nil
+	}
+	key := strings.TrimPrefix(path, "/post/")
+	if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return findPublishedPost(key, "")
+	}
+	return findPublishedPost("", key)
+}
+
+func findPublishedPost(id, slug string) *models.Post {
 	var (
 		post *models.Post
 		err  error
 	)
-	id := c.Param("id")
-	postID, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		msg := fmt.Sprintf("parse uint error:%v", err)
-		Logger.Fatal(msg)
+	switch {
+	case id != "":
+		var postID uint64
+		if postID, err = strconv.ParseUint(id, 10, 64); err == nil {
+			post, err = models.GetPostByID(postID)
+		}
+	case slug != "":
+		post, err = models.GetPostBySlug(slug)
+		if err != nil {
+			post, err = models.GetPostByOldSlug(slug)
+		}
+	default:
+		return nil
 	}
-	if isPublish {
-		post, err = models.GetPostByIDAndPublished(postID, isPublish)
-	} else {
-		post, err = models.GetPostByID(postID)
+	if err != nil || !post.Published {
+		return nil
 	}
+	return post
+}
 
-	if err != nil {
-		c.AbortWithError(http.StatusNotFound, err)
+func showPost(c *gin.Context, post *models.Post, isPublish bool) {
+	if !isPublish && !currentUser(c).CanEditPost(post) {
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "Forbidden!",
+		})
 		return
 	}
 	tags, err := models.ListTagByPostID(post.ID)
@@ -305,58 +359,68 @@ func getPost(c *gin.Context, isPublish bool) {
 	}
 	post.Tags = tags
 	content := post.Content
-	comments, err := models.ListCommentsByPostID(int(postID))
+	commentPage, pages, err := listCommentPage(int(post.ID), 1, commentsPerPage)
 	if err != nil {
 		msg := fmt.Sprintf("list comments by postID error:%v", err)
 		Logger.Fatal(msg)
 	}
+	comments, commentNum := commentPage.Roots, commentPage.Total
 	gitHubUser, _ := c.Get(models.CONTEXT_GIT_USER_KEY)
-	policy := bluemonday.UGCPolicy()
-	render := blackfriday.HtmlRenderer(commonHtmlFlags, "", "")
-	unsafe := blackfriday.Markdown([]byte(content), render, commonExtensions)
-	contentHtml := template.HTML(policy.Sanitize(string(unsafe)))
-
-	var pages int
-	if len(comments)%10 == 0 {
-		pages = len(comments) / 10
+	// 预览时直接渲染，不读写缓存
+	var rendered *renderedPost
+	if isPublish {
+		rendered = cachedPost(post)
 	} else {
-		pages = len(comments)/10 + 1
+		rendered = renderPost(content)
 	}
+
 	hh := utils.HH{
 		Post:       post,
 		Comments:   comments,
 		Githubuser: gitHubUser,
 		Pages:      pages,
-		CommentNum: len(comments),
+		CommentNum: commentNum,
 	}
 	commentsHTML, _ := utils.RenderAllComment(hh)
 	res := template.HTML(commentsHTML)
 
-	relatePosts := GetPosts(int64(postID))
+	relatePosts := GetPosts(post)
+
+	var gid int64
+	if gitUser := currentGitUser(c); gitUser != nil {
+		gid = gitUser.GID
+	}
+	reactions, err := models.ListPostReactions(int64(post.ID), gid)
+	if err != nil {
+		msg := fmt.Sprintf("list reactions by postID error:%v", err)
+		Logger.Error(msg)
+	}
 
 	c.HTML(http.StatusOK, "front/post.html", gin.H{
 		"Post":         post,
-		"contentHtml":  contentHtml,
+		"contentHtml":  rendered.HTML,
+		"toc":          rendered.TOC,
 		"Comments":     comments,
 		"Githubuser":   gitHubUser,
 		"Pages":        pages,
-		"CommentNum":   len(comments),
+		"CommentNum":   commentNum,
 		"commentsHTML": res,
 		"relatePosts":  relatePosts,
+		"reactions":    reactions,
+		"csrf_token":   csrfToken(c),
 	})
 }
 
-func GetPosts(postID int64) []*models.Post {
-	tags, err := models.ListTagByPostID(postID)
-	if err != nil {
-		msg := fmt.Sprintf("list tag by postID error:%v", err)
-		Logger.Fatal(msg)
+// GetPosts 与文章有相同标签的其他文章，post.Tags 需已填充
+func GetPosts(post *models.Post) []*models.Post {
+	if len(post.Tags) == 0 {
+		return nil
 	}
 	var tagids []int64
-	for _, tag := range tags {
+	for _, tag := range post.Tags {
 		tagids = append(tagids, int64(tag.ID))
 	}
-	posts := models.GetPostsByTags(postID, tagids)
+	posts := models.GetPostsByTags(int64(post.ID), tagids)
 	result := utils.RandomGetArray(posts, 4)
 	return result
 }
@@ -0,0 +1,14 @@
+package controllers
+
+import "testing"
+
+// TestPostContentHashConfig 图片缩放配置变化后文章的渲染缓存失效
+func TestPostContentHashConfig(t *testing.T) {
+	defer func(old string) { PostRenderConfig = old }(PostRenderConfig)
+	PostRenderConfig = ""
+	before := postContentHash("![a](/uploads/a.jpg)")
+	PostRenderConfig = "/media/resize|/uploads/|[320 640]|80|0123456789abcdef|100vw"
+	if postContentHash("![a](/uploads/a.jpg)") == before {
+		t.Error("render config is not part of the content hash")
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func currentGitUser(c *gin.Context) *models.GitHubUser {
+	if user, ok := c.Get(models.CONTEXT_GIT_USER_KEY); ok {
+		if u, ok := user.(*models.GitHubUser); ok {
+			return u
+		}
+	}
+	return nil
+}
+
+func AddReaction(c *gin.Context) {
+	changeReaction(c, models.AddReaction)
+}
+
+func DeleteReaction(c *gin.Context) {
+	changeReaction(c, models.RemoveReaction)
+}
+
+func changeReaction(c *gin.Context, change func(postID, gitHubID, reactionType int64) error) {
+	postID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"r": 1, "msg": "Invalid post id"})
+		return
+	}
+	if _, err := models.GetPostByIDAndPublished(postID, true); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"r": 1, "msg": "Post not exist"})
+		return
+	}
+	reactionType, ok := models.ReactionTypeByName(c.Query("type"))
+	if !ok {
+		reactionType, ok = models.ReactionTypeByName(c.PostForm("type"))
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"r": 1, "msg": "Unknown reaction type"})
+		return
+	}
+	gitUser := currentGitUser(c)
+	if err := change(postID, gitUser.GID, reactionType); err != nil {
+		msg := fmt.Sprintf("change reaction err:%v", err)
+		Logger.Error(msg)
+		c.JSON(http.StatusInternalServerError, gin.H{"r": 1, "msg": "Failed to save reaction"})
+		return
+	}
+	reactions, err := models.ListPostReactions(postID, gitUser.GID)
+	if err != nil {
+		msg := fmt.Sprintf("list reactions err:%v", err)
+		Logger.Error(msg)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"r":         0,
+		"reactions": reactionsJSON(reactions),
+	})
+}
+
+func reactionsJSON(reactions []*models.Reaction) []gin.H {
+	ret := make([]gin.H, 0, len(reactions))
+	for _, reaction := range reactions {
+		ret = append(ret, gin.H{
+			"type":    reaction.Name,
+			"count":   reaction.Count,
+			"reacted": reaction.Reacted,
+		})
+	}
+	return ret
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"lyanna/utils/diff"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// savePostRevision 为文章当前内容保存一个历史版本
+func savePostRevision(post *models.Post, editorID uint64) {
+	rev := models.NewPostRevision(post, editorID)
+	if err := rev.Insert(); err != nil {
+		msg := fmt.Sprintf("save post revision err:%v", err)
+		Logger.Error(msg)
+	}
+}
+
+func findRevision(revisions []*models.PostRevision, id string) *models.PostRevision {
+	revID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	for _, rev := range revisions {
+		if rev.ID == revID {
+			return rev
+		}
+	}
+	return nil
+}
+
+func revisionPost(c *gin.Context) (*models.Post, bool) {
+	post := editablePost(c, c.Param("id"))
+	return post, post != nil
+}
+
+func PostRevisions(c *gin.Context) {
+	post, ok := revisionPost(c)
+	if !ok {
+		return
+	}
+	revisions, err := models.ListRevisionsByPostID(post.ID)
+	if err != nil {
+		msg := fmt.Sprintf("list revisions by postID err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// 默认对比最新的两个版本
+	from, to := findRevision(revisions, c.Query("from")), findRevision(revisions, c.Query("to"))
+	if to == nil && len(revisions) > 0 {
+		to = revisions[0]
+	}
+	if from == nil && len(revisions) > 1 {
+		from = revisions[1]
+	}
+	var oldContent, newContent string
+	if from != nil {
+		oldContent = from.Content
+	}
+	if to != nil {
+		newContent = to.Content
+	}
+	lines := diff.Lines(oldContent, newContent)
+	c.HTML(http.StatusOK, "admin/revisions.html", adminH(c, gin.H{
+		"post":      post,
+		"revisions": revisions,
+		"from":      from,
+		"to":        to,
+		"diff":      lines,
+		"stat":      diff.Summary(lines),
+		"restored":  c.Query("restored"),
+	}))
+}
+
+func RestorePostRevision(c *gin.Context) {
+	post, ok := revisionPost(c)
+	if !ok {
+		return
+	}
+	rev, err := models.GetRevisionByID(c.PostForm("revision"))
+	if err != nil || rev.PostID != post.ID {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Not Found revision!",
+		})
+		return
+	}
+	rev.ApplyTo(post)
+	post.Update()
+	savePostRevision(post, currentUserID(c))
+	c.Redirect(http.StatusFound, fmt.Sprintf("/admin/post/revisions/%d?restored=%d", post.ID, rev.ID))
+}
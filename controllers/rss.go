@@ -2,49 +2,208 @@ package controllers
 
 import (
 	"fmt"
+	"lyanna/feed"
 	"lyanna/models"
-	"lyanna/utils"
-	"regexp"
+	"lyanna/render"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/feeds"
 )
 
-//var Logger = models.Logger
+type feedFormat struct {
+	path        string
+	contentType string
+	title       string
+	encode      func(*feed.Feed) ([]byte, error)
+}
+
+var feedFormats = []feedFormat{
+	{"/rss", feed.RSSContentType, "RSS", (*feed.Feed).RSS},
+	{"/atom.xml", feed.AtomContentType, "Atom", (*feed.Feed).Atom},
+	{"/feed.json", feed.JSONContentType, "JSON Feed", (*feed.Feed).JSON},
+}
+
+// FeedPaths 订阅源各格式的路径后缀，全站订阅源直接使用，标签和作者订阅源加在页面地址之后
+func FeedPaths() []string {
+	paths := make([]string, 0, len(feedFormats))
+	for _, format := range feedFormats {
+		paths = append(paths, format.path)
+	}
+	return paths
+}
+
+// feedFormatOf 根据请求路径的后缀选择订阅源格式
+func feedFormatOf(path string) feedFormat {
+	for _, format := range feedFormats {
+		if strings.HasSuffix(path, format.path) {
+			return format
+		}
+	}
+	return feedFormats[0]
+}
+
+// feedScope 订阅源包含的文章范围
+type feedScope struct {
+	title  string // 附加在站点标题之后
+	page   string // 对应页面的地址，订阅源地址为页面地址加格式后缀
+	filter models.PostFilter
+}
+
+// feedLink 页面 <head> 中用于自动发现订阅源的 <link rel="alternate">
+type feedLink struct {
+	Type  string
+	Title string
+	Href  string
+}
+
+// feedLinks 返回页面 page 的各格式订阅源链接，page 为空表示全站订阅源
+func feedLinks(title, page string) []feedLink {
+	links := make([]feedLink, 0, len(feedFormats))
+	for _, format := range feedFormats {
+		t := format.title
+		if title != "" {
+			t = title + " - " + t
+		}
+		links = append(links, feedLink{
+			Type:  strings.SplitN(format.contentType, ";", 2)[0],
+			Title: t,
+			Href:  page + format.path,
+		})
+	}
+	return links
+}
+
+// GetFeed 全站订阅源
+func GetFeed(c *gin.Context) {
+	serveFeed(c, feedScope{})
+}
+
+// GetTagFeed 标签下的文章订阅源
+func GetTagFeed(c *gin.Context) {
+	tagID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	tag, err := models.GetTagByID(tagID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	serveFeed(c, feedScope{
+		title:  tag.Name,
+		page:   fmt.Sprintf("/tag/%d", tag.ID),
+		filter: models.PostFilter{TagID: tag.ID},
+	})
+}
+
+// GetAuthorFeed 作者的文章订阅源
+func GetAuthorFeed(c *gin.Context) {
+	user, err := models.GetUserByName(c.Param("name"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	serveFeed(c, feedScope{
+		title:  user.Name,
+		page:   authorURL(user.Name),
+		filter: models.PostFilter{AuthorID: user.ID},
+	})
+}
 
-func GetRss(c *gin.Context) {
-	now := utils.GetCurrentTime()
-	feed := &feeds.Feed{
-		Title:       "My Blog",
-		Link:        &feeds.Link{Href: "http://127.0.0.1:9080"},
-		Description: "A modern, beautiful blog powered by GoLyanna",
-		Author:      &feeds.Author{Name: "szbolent", Email: "szbolent@example.com"},
-		Created:     now,
+func authorURL(name string) string {
+	return "/author/" + url.PathEscape(name)
+}
+
+// siteBaseURL 站点的绝对地址，未在设置中配置时根据请求推断
+func siteBaseURL(c *gin.Context, site models.SiteSettings) string {
+	if site.URL != "" {
+		return site.URL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
 	}
-	feed.Items = make([]*feeds.Item, 0)
-	posts, err := models.ListPublishedPost("")
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func serveFeed(c *gin.Context, scope feedScope) {
+	format := feedFormatOf(c.Request.URL.Path)
+	site := models.GetSiteSettings()
+	base := siteBaseURL(c, site)
+	published := true
+	filter := scope.filter
+	filter.Published = &published
+	posts, _, err := models.ListPostsByFilter(filter, 0, models.FeedLimit())
 	if err != nil {
 		msg := fmt.Sprintf("list published posts err:%v", err)
-		Logger.Fatal(msg)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
-	for _, post := range posts {
-		item := &feeds.Item{
-			Id:          fmt.Sprintf("%s/post/%d", "http://127.0.0.1:9080", post.ID),
-			Title:       post.Title,
-			Link:        &feeds.Link{Href: fmt.Sprintf("%s/post/%d", "http://127.0.0.1:9080", post.ID)},
-			Description: post.Summary,
-			Created:     now,
-		}
-		feed.Items = append(feed.Items, item)
+	f := &feed.Feed{
+		Title:       site.Title,
+		Description: site.Description,
+		HomeURL:     base + scope.page + "/",
+		FeedURL:     base + scope.page + format.path,
+		Language:    site.Language,
+	}
+	if scope.title != "" {
+		f.Title = site.Title + " - " + scope.title
+		f.HomeURL = base + scope.page
 	}
-	rss, err := feed.ToRss()
+	if site.Author != "" || site.AuthorEmail != "" {
+		f.Author = &feed.Author{Name: site.Author, Email: site.AuthorEmail, URL: base + "/"}
+	}
+	f.Items = feedItems(posts, base, models.FeedFullContent())
+	body, err := format.encode(f)
 	if err != nil {
-		msg := fmt.Sprintf("feed to rss err:%v", err)
-		Logger.Fatal(msg)
+		msg := fmt.Sprintf("encode feed %s err:%v", c.Request.URL.Path, err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
 	}
-	// 使用正则表达式替换managingEditor信息
-	re := regexp.MustCompile(`<managingEditor>admin@example\.com \(GoLyanna\)</managingEditor>`)
-	rss = re.ReplaceAllString(rss, "<managingEditor>szbolent@example.com (szbolent)</managingEditor>")
-	c.Writer.WriteString(rss)
+	feed.Write(c.Writer, c.Request, format.contentType, body, f.Updated())
+}
 
+// feedItems 把文章转换为订阅源条目，fullContent 为 true 时附带渲染后的全文
+func feedItems(posts []*models.Post, base string, fullContent bool) []*feed.Item {
+	if err := models.LoadPostRelations(posts); err != nil {
+		msg := fmt.Sprintf("load post relations err:%v", err)
+		Logger.Error(msg)
+	}
+	items := make([]*feed.Item, 0, len(posts))
+	for _, post := range posts {
+		var author *feed.Author
+		if post.User.Name != "" {
+			author = &feed.Author{Name: post.User.Name}
+		}
+		// 摘要为纯文本，JSON Feed 原样输出，RSS 和 Atom 由 feed 包转义
+		summary := post.Summary
+		if summary == "" {
+			summary = render.Excerpt.Text(post.Content)
+		}
+		// ID 使用不随链接格式和 slug 变化的 /post/:id，避免修改后阅读器重复推送
+		item := &feed.Item{
+			ID:        fmt.Sprintf("%s/post/%d", base, post.ID),
+			URL:       base + post.Url(),
+			Title:     post.Title,
+			Summary:   summary,
+			Author:    author,
+			Tags:      models.GetTagNames(post.Tags),
+			Published: post.CreatedAt,
+			Updated:   post.UpdatedAt,
+		}
+		if fullContent {
+			item.ContentHTML = string(render.Feed.HTML(post.Content))
+		}
+		items = append(items, item)
+	}
+	return items
 }
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"testing"
+)
+
+// TestFeedItemsSummary 没有填写摘要时用正文生成纯文本摘要，不含 HTML 实体
+func TestFeedItemsSummary(t *testing.T) {
+	defer openTestDB(t)()
+	post := &models.Post{Title: "Tom", Content: "**Tom & Jerry's** <i>show</i>", Published: true}
+	if err := post.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	items := feedItems([]*models.Post{post}, "https://example.com", false)
+	if want := "Tom & Jerry’s show..."; len(items) != 1 || items[0].Summary != want {
+		t.Errorf("summary = %q, want %q", items[0].Summary, want)
+	}
+}
@@ -44,19 +44,43 @@ func Tag(c *gin.Context) {
 	//	return
 	//}
 	//policy = bluemonday.StrictPolicy()
-	for _, post := range posts {
-		post.Tags,err = models.ListTagByPostID(post.ID)
-		if err != nil {
-			msg := fmt.Sprintf("list tag by postID err:%v",err)
-			Logger.Error(msg)
-			continue
-		}
+	if err = models.LoadPostRelations(posts); err != nil {
+		msg := fmt.Sprintf("load post relations err:%v",err)
+		Logger.Error(msg)
 	}
+	page := fmt.Sprintf("/tag/%d", tagID)
 	c.HTML(http.StatusOK, "front/tag.html",gin.H{
 		"posts":posts,
 		"tagName":tagName,
+		"feeds":feedLinks(tagName, page),
+		"feedURL":page + "/rss",
 	})
 
 
 
-}
\ No newline at end of file
+}
+
+// Author 作者已发布的文章
+func Author(c *gin.Context) {
+	user, err := models.GetUserByName(c.Param("name"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "Not Found author!",
+		})
+		return
+	}
+	published := true
+	// limit 为 -1 表示不限制数量，与标签页一致
+	posts, _, err := models.ListPostsByFilter(models.PostFilter{AuthorID: user.ID, Published: &published}, 0, -1)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	page := authorURL(user.Name)
+	c.HTML(http.StatusOK, "front/tag.html", gin.H{
+		"posts":   posts,
+		"tagName": user.Name,
+		"feeds":   feedLinks(user.Name, page),
+		"feedURL": page + "/rss",
+	})
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenAuth 处理 Authorization: Bearer 请求头，token 有效时以 token 所属用户的身份继续处理，
+// 无效时直接返回 401，不会退回到会话认证
+func TokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+			c.Next()
+			return
+		}
+		user, token, err := models.AuthenticateAPIToken(strings.TrimSpace(header[7:]), now())
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			apiFail(c, http.StatusUnauthorized, apiUnauthorized, "invalid api token")
+			return
+		}
+		c.Set(models.CONTEXT_USER_KEY, user)
+		c.Set(models.CONTEXT_API_TOKEN_KEY, token)
+		c.Next()
+	}
+}
+
+// usingAPIToken 当前请求是否使用 API token 认证
+func usingAPIToken(c *gin.Context) bool {
+	_, ok := c.Get(models.CONTEXT_API_TOKEN_KEY)
+	return ok
+}
+
+// SessionRequired 拒绝使用 API token 认证的请求，用于 token 和两步验证等账号安全设置
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if usingAPIToken(c) {
+			apiFail(c, http.StatusForbidden, apiForbidden, "api tokens cannot be used here")
+			return
+		}
+		c.Next()
+	}
+}
+
+func AdminTokens(c *gin.Context) {
+	renderTokens(c, gin.H{})
+}
+
+func PostAdminToken(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		renderTokens(c, gin.H{"msg": "token name is required"})
+		return
+	}
+	_, plain, err := models.CreateAPIToken(currentUserID(c), name, c.PostFormArray("scopes"))
+	if err != nil {
+		msg := fmt.Sprintf("create api token err:%v", err)
+		Logger.Error(msg)
+		renderTokens(c, gin.H{"msg": msg})
+		return
+	}
+	renderTokens(c, gin.H{"token": plain, "name": name})
+}
+
+func RevokeAdminToken(c *gin.Context) {
+	if err := models.RevokeAPIToken(currentUserID(c), c.Param("id")); err != nil {
+		msg := fmt.Sprintf("revoke api token err:%v", err)
+		Logger.Error(msg)
+		renderTokens(c, gin.H{"msg": msg})
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/tokens")
+}
+
+func renderTokens(c *gin.Context, h gin.H) {
+	tokens, err := models.ListAPITokensByUserID(currentUserID(c))
+	if err != nil {
+		msg := fmt.Sprintf("list api tokens err:%v", err)
+		Logger.Error(msg)
+	}
+	h["tokens"] = tokens
+	h["scopes"] = models.TokenScopes
+	c.HTML(http.StatusOK, "admin/tokens.html", adminH(c, h))
+}
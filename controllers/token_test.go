@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"lyanna/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenRouter 与 main 相同的中间件顺序：会话、Bearer 认证、CSRF 检查
+func tokenRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(sessions.Sessions("gin-session", cookie.NewStore([]byte("secret"))))
+	router.Use(TokenAuth(), CSRFRequired())
+	RegisterAPIV1(router.Group(APIV1Prefix))
+	router.GET("/admin/tokens", SessionRequired(), func(c *gin.Context) {
+		c.String(http.StatusOK, "tokens")
+	})
+	return router
+}
+
+func doToken(router *gin.Engine, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// newTokenUser 创建用户及其 token，返回 token 明文
+func newTokenUser(t *testing.T, name string, active bool, scopes ...string) (*models.User, string) {
+	user := &models.User{Name: name, Role: models.RoleAdmin, Active: active}
+	if err := models.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !active {
+		models.DB.Model(user).UpdateColumn("active", false)
+	}
+	_, plain, err := models.CreateAPIToken(user.ID, name, scopes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, plain
+}
+
+func TestTokenAuth(t *testing.T) {
+	defer openTestDB(t)()
+	_, writer := newTokenUser(t, "writer", true, models.ScopePostsWrite)
+	_, moderator := newTokenUser(t, "moderator", true, models.ScopeCommentsModerate)
+	_, inactive := newTokenUser(t, "inactive", false)
+	trashedUser, trashed := newTokenUser(t, "trashed", true)
+	if err := trashedUser.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	comment := &models.Comment{PostID: 1, Content: "hi", Status: models.CommentPending}
+	if err := comment.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	router := tokenRouter()
+
+	cases := []struct {
+		name, method, path, token, body string
+		want                            int
+	}{
+		{"unknown token", "GET", "/api/v1/posts", "lya_unknown", "", http.StatusUnauthorized},
+		{"token without prefix", "GET", "/api/v1/posts", "unknown", "", http.StatusUnauthorized},
+		{"inactive user", "GET", "/api/v1/posts", inactive, "", http.StatusUnauthorized},
+		{"trashed user", "GET", "/api/v1/posts", trashed, "", http.StatusUnauthorized},
+		{"scope does not cover posts", "POST", "/api/v1/posts", moderator, `{"title":"t","content":"c"}`, http.StatusForbidden},
+		// 使用 token 的写请求不需要 CSRF token
+		{"posts:write token", "POST", "/api/v1/posts", writer, `{"title":"t","content":"c"}`, http.StatusCreated},
+		{"comments:moderate token", "PATCH", "/api/v1/comments/1", moderator, `{"status":"approved"}`, http.StatusOK},
+		{"scope does not cover comments", "PATCH", "/api/v1/comments/1", writer, `{"status":"spam"}`, http.StatusForbidden},
+		{"session only page", "GET", "/admin/tokens", writer, "", http.StatusForbidden},
+		{"session write without csrf", "POST", "/api/v1/posts", "", `{"title":"t","content":"c"}`, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		w := doToken(router, c.method, c.path, c.token, c.body)
+		if w.Code != c.want {
+			t.Errorf("%s: %s %s = %d, want %d: %s", c.name, c.method, c.path, w.Code, c.want, w.Body)
+		}
+	}
+}
+
+// TestTokenLastUsed 最近使用时间至多每分钟更新一次
+func TestTokenLastUsed(t *testing.T) {
+	defer openTestDB(t)()
+	defer func(old func() time.Time) { now = old }(now)
+	user, plain := newTokenUser(t, "writer", true)
+	router := tokenRouter()
+	start := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+
+	lastUsed := func() time.Time {
+		tokens, err := models.ListAPITokensByUserID(user.ID)
+		if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+			t.Fatalf("token not used: %v", err)
+		}
+		return tokens[0].LastUsedAt.UTC()
+	}
+	for _, c := range []struct {
+		after time.Duration
+		want  time.Duration
+	}{{0, 0}, {30 * time.Second, 0}, {2 * time.Minute, 2 * time.Minute}} {
+		now = func() time.Time { return start.Add(c.after) }
+		if w := doToken(router, "GET", "/api/v1/posts", plain, ""); w.Code != http.StatusOK {
+			t.Fatalf("request at +%s: %d %s", c.after, w.Code, w.Body)
+		}
+		if got := lastUsed(); !got.Equal(start.Add(c.want)) {
+			t.Errorf("request at +%s: last used %s, want %s", c.after, got, start.Add(c.want))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"fmt"
+	"lyanna/models"
+	"lyanna/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashKinds 当前用户可以管理的回收站记录类型
+func trashKinds(c *gin.Context) []string {
+	user := currentUser(c)
+	var kinds []string
+	for _, kind := range models.TrashKinds {
+		if perm, _ := models.TrashPermission(kind); user.Can(perm) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// trashKind 请求中的记录类型，未指定时使用第一个可管理的类型；没有权限时返回空字符串
+func trashKind(c *gin.Context, kind string) string {
+	kinds := trashKinds(c)
+	if kind == "" && len(kinds) > 0 {
+		return kinds[0]
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return kind
+		}
+	}
+	return ""
+}
+
+func AdminTrash(c *gin.Context) {
+	kind := trashKind(c, c.Query("kind"))
+	if kind == "" {
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "Forbidden!",
+		})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	counts, err := models.CountTrash()
+	if err != nil {
+		msg := fmt.Sprintf("count trash err:%v", err)
+		Logger.Error(msg)
+	}
+	pagination := utils.Pagination{
+		CurrentPage: page,
+		PerPage:     models.Conf.General.PerPage,
+		Total:       counts[kind],
+	}
+	items, err := models.ListTrash(kind, pagination.Offset(), pagination.PerPage)
+	if err != nil {
+		msg := fmt.Sprintf("list trash err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.HTML(http.StatusOK, "admin/trash.html", adminH(c, gin.H{
+		"items":      items,
+		"kind":       kind,
+		"kinds":      trashKinds(c),
+		"counts":     counts,
+		"retention":  models.Conf.Trash.RetentionDays,
+		"pagination": &pagination,
+		"msg":        c.Query("msg"),
+	}))
+}
+
+// AdminTrashAction 恢复或彻底删除选中的记录
+func AdminTrashAction(c *gin.Context) {
+	kind := trashKind(c, c.PostForm("kind"))
+	if kind == "" {
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "Forbidden!",
+		})
+		return
+	}
+	var ids []uint64
+	for _, v := range c.PostFormArray("ids") {
+		if id, err := strconv.ParseUint(v, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	var (
+		err error
+		msg string
+	)
+	switch c.PostForm("action") {
+	case "restore":
+		err = models.RestoreTrash(kind, ids)
+		msg = fmt.Sprintf("%d %s were restored.", len(ids), kind)
+	case "purge":
+		err = models.PurgeTrash(kind, ids)
+		msg = fmt.Sprintf("%d %s were permanently deleted.", len(ids), kind)
+	}
+	if err != nil {
+		msg = fmt.Sprintf("%s trash err:%v", c.PostForm("action"), err)
+		Logger.Error(msg)
+	}
+	query := url.Values{"kind": {kind}}
+	if len(ids) > 0 && msg != "" {
+		query.Set("msg", msg)
+	}
+	c.Redirect(http.StatusFound, "/admin/trash?"+query.Encode())
+}
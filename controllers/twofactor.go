@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"lyanna/models"
+	"lyanna/utils/totp"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TOTPIssuer = "lyanna"
+	// twoFactorTimeout 密码校验通过后完成两步验证的时限
+	twoFactorTimeout = 5 * time.Minute
+)
+
+// now 当前时间，测试时可替换为固定时钟
+var now = time.Now
+
+const twoFactorLockedMsg = "too many failed verification attempts, please try again later"
+
+var errTwoFactorLocked = errors.New(twoFactorLockedMsg)
+
+// checkSecondFactor 校验验证码或恢复码并记录连续失败次数；被锁定时不再校验，返回 errTwoFactorLocked
+func checkSecondFactor(user *models.User, code string) error {
+	if models.TwoFactorLocked(user.ID) {
+		return errTwoFactorLocked
+	}
+	if err := user.VerifySecondFactor(code, now()); err != nil {
+		count, rerr := models.RecordTwoFactorFailure(user.ID)
+		if rerr != nil {
+			msg := fmt.Sprintf("record 2fa failure err:%v", rerr)
+			Logger.Error(msg)
+		}
+		if count >= models.MaxTwoFactorFailures {
+			return errTwoFactorLocked
+		}
+		return err
+	}
+	models.ResetTwoFactorFailures(user.ID)
+	return nil
+}
+
+// secondFactorMsg 验证失败时显示的提示
+func secondFactorMsg(err error) string {
+	if err == errTwoFactorLocked {
+		return twoFactorLockedMsg
+	}
+	return "invalid verification code"
+}
+
+// lockOutTwoFactor 连续失败次数过多，清除待验证状态并回到登录页
+func lockOutTwoFactor(c *gin.Context) {
+	s := sessions.Default(c)
+	s.Delete(models.SESSION_2FA_USER_KEY)
+	s.Delete(models.SESSION_2FA_EXPIRES)
+	s.Save()
+	c.HTML(http.StatusTooManyRequests, "admin/login.html", adminH(c, gin.H{
+		"msg": twoFactorLockedMsg,
+	}))
+}
+
+// startTwoFactor 密码已通过，记录待验证用户并跳转到两步验证页
+func startTwoFactor(c *gin.Context, user *models.User) {
+	s := sessions.Default(c)
+	s.Clear()
+	resetCSRFToken(c)
+	s.Set(models.SESSION_2FA_USER_KEY, user.ID)
+	s.Set(models.SESSION_2FA_EXPIRES, now().Add(twoFactorTimeout).Unix())
+	s.Save()
+	c.Redirect(http.StatusFound, "/admin/login/2fa")
+}
+
+// finishLogin 设置登录态
+func finishLogin(c *gin.Context, user *models.User) {
+	s := sessions.Default(c)
+	s.Clear()
+	resetCSRFToken(c)
+	s.Set(models.SESSION_KEY, user.ID)
+	s.Save()
+}
+
+// pendingUser 返回等待两步验证的用户，不存在或已超时返回 nil
+func pendingUser(c *gin.Context) *models.User {
+	s := sessions.Default(c)
+	uID, ok := s.Get(models.SESSION_2FA_USER_KEY).(uint64)
+	if !ok {
+		return nil
+	}
+	if expires, ok := s.Get(models.SESSION_2FA_EXPIRES).(int64); !ok || now().Unix() > expires {
+		return nil
+	}
+	user, err := models.GetUserByID(uID)
+	if err != nil || !user.Active {
+		return nil
+	}
+	return user
+}
+
+// enrollmentSecret 返回本次绑定使用的密钥，同一会话内保持不变以便用户扫码后确认
+func enrollmentSecret(c *gin.Context) (string, error) {
+	s := sessions.Default(c)
+	if secret, ok := s.Get(models.SESSION_2FA_SECRET_KEY).(string); ok && secret != "" {
+		return secret, nil
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	s.Set(models.SESSION_2FA_SECRET_KEY, secret)
+	return secret, s.Save()
+}
+
+// confirmEnrollment 校验用户输入的验证码并启用两步验证，返回恢复码
+func confirmEnrollment(c *gin.Context, user *models.User) ([]string, error) {
+	s := sessions.Default(c)
+	secret, _ := s.Get(models.SESSION_2FA_SECRET_KEY).(string)
+	if secret == "" {
+		return nil, totp.ErrInvalidSecret
+	}
+	step, err := totp.Validate(secret, c.PostForm("code"), now())
+	if err != nil {
+		return nil, err
+	}
+	codes, err := user.EnableTOTP(secret, step)
+	if err != nil {
+		return nil, err
+	}
+	s.Delete(models.SESSION_2FA_SECRET_KEY)
+	s.Save()
+	return codes, nil
+}
+
+func renderTwoFactor(c *gin.Context, user *models.User, h gin.H) {
+	data := gin.H{
+		"user":     user,
+		"enabled":  user.TOTPEnabled,
+		"required": models.Require2FA(),
+		"action":   "/admin/2fa",
+	}
+	for k, v := range h {
+		data[k] = v
+	}
+	if !user.TOTPEnabled && data["codes"] == nil {
+		secret, err := enrollmentSecret(c)
+		if err != nil {
+			msg := fmt.Sprintf("generate totp secret err:%v", err)
+			Logger.Error(msg)
+			c.HTML(http.StatusInternalServerError, "errors/error.html", gin.H{"message": msg})
+			return
+		}
+		data["secret"] = secret
+		data["uri"] = totp.ProvisioningURI(secret, TOTPIssuer, user.Name)
+	}
+	if user.TOTPEnabled {
+		data["remaining"], _ = models.CountUnusedRecoveryCodes(user.ID)
+	}
+	c.HTML(http.StatusOK, "admin/two_factor.html", adminH(c, data))
+}
+
+// LoginTwoFactor 登录第二步：输入验证码，未绑定且站点要求两步验证时先绑定
+func LoginTwoFactor(c *gin.Context) {
+	user := pendingUser(c)
+	if user == nil {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+	if user.TOTPEnabled {
+		c.HTML(http.StatusOK, "admin/login_2fa.html", adminH(c, gin.H{"user": user}))
+		return
+	}
+	renderTwoFactor(c, user, gin.H{"pending": true, "action": "/admin/login/2fa"})
+}
+
+func PostLoginTwoFactor(c *gin.Context) {
+	user := pendingUser(c)
+	if user == nil {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+	if user.TOTPEnabled {
+		err := checkSecondFactor(user, c.PostForm("code"))
+		if err == errTwoFactorLocked {
+			lockOutTwoFactor(c)
+			return
+		}
+		if err != nil {
+			c.HTML(http.StatusOK, "admin/login_2fa.html", adminH(c, gin.H{
+				"user": user,
+				"msg":  secondFactorMsg(err),
+			}))
+			return
+		}
+		finishLogin(c, user)
+		c.Redirect(http.StatusFound, "/admin")
+		return
+	}
+	codes, err := confirmEnrollment(c, user)
+	if err != nil {
+		renderTwoFactor(c, user, gin.H{"pending": true, "action": "/admin/login/2fa", "msg": "invalid verification code"})
+		return
+	}
+	finishLogin(c, user)
+	renderTwoFactor(c, user, gin.H{"codes": codes})
+}
+
+// TwoFactor 当前用户的两步验证管理页
+func TwoFactor(c *gin.Context) {
+	renderTwoFactor(c, currentUser(c), nil)
+}
+
+// PostTwoFactor 确认绑定
+func PostTwoFactor(c *gin.Context) {
+	user := currentUser(c)
+	if user.TOTPEnabled {
+		c.Redirect(http.StatusFound, "/admin/2fa")
+		return
+	}
+	codes, err := confirmEnrollment(c, user)
+	if err != nil {
+		renderTwoFactor(c, user, gin.H{"msg": "invalid verification code"})
+		return
+	}
+	renderTwoFactor(c, user, gin.H{"codes": codes})
+}
+
+// DisableTwoFactor 关闭两步验证，需要输入当前验证码或恢复码
+func DisableTwoFactor(c *gin.Context) {
+	user := currentUser(c)
+	if models.Require2FA() {
+		renderTwoFactor(c, user, gin.H{"msg": "two-factor authentication is required by site settings"})
+		return
+	}
+	if err := checkSecondFactor(user, c.PostForm("code")); err != nil {
+		renderTwoFactor(c, user, gin.H{"msg": secondFactorMsg(err)})
+		return
+	}
+	if err := user.DisableTOTP(); err != nil {
+		msg := fmt.Sprintf("disable totp err:%v", err)
+		Logger.Error(msg)
+		renderTwoFactor(c, user, gin.H{"msg": msg})
+		return
+	}
+	renderTwoFactor(c, user, gin.H{"msg": "two-factor authentication was disabled"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要输入当前验证码
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user := currentUser(c)
+	if err := checkSecondFactor(user, c.PostForm("code")); err != nil {
+		renderTwoFactor(c, user, gin.H{"msg": secondFactorMsg(err)})
+		return
+	}
+	codes, err := user.RegenerateRecoveryCodes()
+	if err != nil {
+		msg := fmt.Sprintf("regenerate recovery codes err:%v", err)
+		Logger.Error(msg)
+		renderTwoFactor(c, user, gin.H{"msg": msg})
+		return
+	}
+	renderTwoFactor(c, user, gin.H{"codes": codes})
+}
+
+// AdminSettings 站点设置
+func AdminSettings(c *gin.Context) {
+	renderSettings(c, gin.H{"saved": c.Query("saved") != ""})
+}
+
+func renderSettings(c *gin.Context, h gin.H) {
+	h["require2fa"] = models.Require2FA()
+	h["site"] = models.GetSiteSettings()
+	h["feed_limit"] = models.FeedLimit()
+	h["feed_full_content"] = models.FeedFullContent()
+	c.HTML(http.StatusOK, "admin/settings.html", adminH(c, h))
+}
+
+func PostAdminSettings(c *gin.Context) {
+	require2FA := c.PostForm("require_2fa") == "on"
+	fullContent := c.PostForm("feed_full_content") == "on"
+	siteURL := strings.TrimSpace(c.PostForm("site_url"))
+	if siteURL != "" && !strings.HasPrefix(siteURL, "http://") && !strings.HasPrefix(siteURL, "https://") {
+		renderSettings(c, gin.H{"msg": "site URL must start with http:// or https://"})
+		return
+	}
+	limit, err := strconv.Atoi(c.PostForm("feed_limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		renderSettings(c, gin.H{"msg": "feed item limit must be between 1 and 100"})
+		return
+	}
+	settings := [][2]string{
+		{models.SettingRequire2FA, strconv.FormatBool(require2FA)},
+		{models.SettingSiteTitle, strings.TrimSpace(c.PostForm("site_title"))},
+		{models.SettingSiteDescription, strings.TrimSpace(c.PostForm("site_description"))},
+		{models.SettingSiteURL, siteURL},
+		{models.SettingSiteLanguage, strings.TrimSpace(c.PostForm("site_language"))},
+		{models.SettingSiteAuthor, strings.TrimSpace(c.PostForm("site_author"))},
+		{models.SettingSiteEmail, strings.TrimSpace(c.PostForm("site_author_email"))},
+		{models.SettingFeedLimit, strconv.Itoa(limit)},
+		{models.SettingFeedFullContent, strconv.FormatBool(fullContent)},
+	}
+	for _, setting := range settings {
+		if err := models.SetSetting(setting[0], setting[1]); err != nil {
+			msg := fmt.Sprintf("save settings err:%v", err)
+			Logger.Error(msg)
+			renderSettings(c, gin.H{"msg": msg})
+			return
+		}
+	}
+	c.Redirect(http.StatusFound, "/admin/settings?saved=1")
+}
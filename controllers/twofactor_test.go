@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"errors"
+	"html/template"
+	"lyanna/models"
+	"lyanna/utils/totp"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRedis 只支持两步验证失败计数用到的 incr / get / del / pexpire，
+// 其他命令返回错误，与 Redis 不可用时的行为相同
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]int
+}
+
+type fakeRedisConn struct{ *fakeRedis }
+
+func (c fakeRedisConn) Close() error                      { return nil }
+func (c fakeRedisConn) Err() error                        { return nil }
+func (c fakeRedisConn) Send(string, ...interface{}) error { return errors.New("not supported") }
+func (c fakeRedisConn) Flush() error                      { return nil }
+func (c fakeRedisConn) Receive() (interface{}, error)     { return nil, errors.New("not supported") }
+
+func (c fakeRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(args) == 0 {
+		return nil, errors.New("not supported")
+	}
+	key, _ := args[0].(string)
+	switch strings.ToLower(cmd) {
+	case "incr":
+		c.values[key]++
+		return int64(c.values[key]), nil
+	case "get":
+		if v, ok := c.values[key]; ok {
+			return []byte(strconv.Itoa(v)), nil
+		}
+		return nil, nil
+	case "del":
+		delete(c.values, key)
+		return int64(1), nil
+	case "pexpire":
+		return int64(1), nil
+	}
+	return nil, errors.New("not supported")
+}
+
+// twoFactorClient 带 cookie 的测试客户端，使用固定时钟
+type twoFactorClient struct {
+	t       *testing.T
+	router  *gin.Engine
+	cookies map[string]*http.Cookie
+}
+
+func newTwoFactorClient(t *testing.T) *twoFactorClient {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// 用简单的模板代替真实页面，只输出需要检查的内容
+	router.SetHTMLTemplate(template.Must(template.New("").Parse(`
+{{define "admin/login.html"}}login:{{.msg}}{{end}}
+{{define "admin/login_2fa.html"}}2fa:{{.msg}}{{end}}
+{{define "admin/two_factor.html"}}enroll:{{.msg}}|secret={{.secret}}|codes={{if .codes}}{{len .codes}}{{end}}{{end}}
+{{define "errors/error.html"}}error:{{.message}}{{end}}`)))
+	router.Use(sessions.Sessions("gin-session", cookie.NewStore([]byte("secret"))))
+	router.POST("/admin/login", UserLogin)
+	router.GET("/admin/login/2fa", LoginTwoFactor)
+	router.POST("/admin/login/2fa", PostLoginTwoFactor)
+	router.GET("/whoami", func(c *gin.Context) {
+		id, _ := sessions.Default(c).Get(models.SESSION_KEY).(uint64)
+		if id == 0 {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, "user")
+	})
+	return &twoFactorClient{t: t, router: router, cookies: make(map[string]*http.Cookie)}
+}
+
+func (tc *twoFactorClient) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range tc.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	tc.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		tc.cookies[cookie.Name] = cookie
+	}
+	return w
+}
+
+func (tc *twoFactorClient) login(name string) *httptest.ResponseRecorder {
+	return tc.do("POST", "/admin/login", url.Values{"username": {name}, "password": {"secret-password"}})
+}
+
+func (tc *twoFactorClient) verify(code string) *httptest.ResponseRecorder {
+	return tc.do("POST", "/admin/login/2fa", url.Values{"code": {code}})
+}
+
+func (tc *twoFactorClient) loggedIn() bool {
+	return tc.do("GET", "/whoami", nil).Body.String() == "user"
+}
+
+// openTwoFactorTest 准备数据库、失败计数用的 Redis 和固定时钟，返回清理函数
+func openTwoFactorTest(t *testing.T, clock *time.Time) func() {
+	cleanup := openTestDB(t)
+	store := &fakeRedis{values: make(map[string]int)}
+	models.RedisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return fakeRedisConn{store}, nil }}
+	old := now
+	now = func() time.Time { return *clock }
+	return func() {
+		now = old
+		cleanup()
+	}
+}
+
+// newTwoFactorUser 创建用户，secret 不为空时启用两步验证，返回恢复码
+func newTwoFactorUser(t *testing.T, name, secret string) (*models.User, []string) {
+	user := &models.User{Name: name, Role: models.RoleAdmin, Active: true}
+	if err := user.SetPassword("secret-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if secret == "" {
+		return user, nil
+	}
+	codes, err := user.EnableTOTP(secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, codes
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	clock := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	defer openTwoFactorTest(t, &clock)()
+	secret, _ := totp.GenerateSecret()
+	_, recovery := newTwoFactorUser(t, "alice", secret)
+	code, _ := totp.Code(secret, clock)
+
+	tc := newTwoFactorClient(t)
+	if w := tc.login("alice"); w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/login/2fa" {
+		t.Fatalf("password step: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if tc.loggedIn() {
+		t.Fatal("logged in before the second factor")
+	}
+	if w := tc.verify(code); w.Code != http.StatusFound || w.Header().Get("Location") != "/admin" {
+		t.Fatalf("totp step: %d %s", w.Code, w.Body)
+	}
+	if !tc.loggedIn() {
+		t.Fatal("not logged in after the second factor")
+	}
+
+	// 同一时间步的验证码不能再次使用
+	tc = newTwoFactorClient(t)
+	tc.login("alice")
+	if w := tc.verify(code); !strings.Contains(w.Body.String(), "invalid verification code") || tc.loggedIn() {
+		t.Errorf("replayed code accepted: %d %s", w.Code, w.Body)
+	}
+
+	// 恢复码只能使用一次
+	if w := tc.verify(recovery[0]); w.Code != http.StatusFound || !tc.loggedIn() {
+		t.Fatalf("recovery code: %d %s", w.Code, w.Body)
+	}
+	tc = newTwoFactorClient(t)
+	tc.login("alice")
+	if w := tc.verify(recovery[0]); !strings.Contains(w.Body.String(), "invalid verification code") || tc.loggedIn() {
+		t.Errorf("used recovery code accepted: %d %s", w.Code, w.Body)
+	}
+
+	// 下一个时间步的新验证码可以使用
+	clock = clock.Add(totp.Period * time.Second)
+	next, _ := totp.Code(secret, clock)
+	if w := tc.verify(next); w.Code != http.StatusFound || !tc.loggedIn() {
+		t.Errorf("next code: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLoginTwoFactorExpires(t *testing.T) {
+	clock := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	defer openTwoFactorTest(t, &clock)()
+	secret, _ := totp.GenerateSecret()
+	newTwoFactorUser(t, "alice", secret)
+
+	tc := newTwoFactorClient(t)
+	tc.login("alice")
+	clock = clock.Add(twoFactorTimeout + time.Second)
+	code, _ := totp.Code(secret, clock)
+	if w := tc.verify(code); w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/login" || tc.loggedIn() {
+		t.Errorf("expired step: %d %s %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+}
+
+func TestLoginTwoFactorLockout(t *testing.T) {
+	clock := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	defer openTwoFactorTest(t, &clock)()
+	secret, _ := totp.GenerateSecret()
+	newTwoFactorUser(t, "alice", secret)
+
+	tc := newTwoFactorClient(t)
+	tc.login("alice")
+	for i := 1; i < models.MaxTwoFactorFailures; i++ {
+		if w := tc.verify("000000"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "invalid verification code") {
+			t.Fatalf("failure %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	if w := tc.verify("000000"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("failure %d: %d %s", models.MaxTwoFactorFailures, w.Code, w.Body)
+	}
+	// 锁定后待验证状态被清除，重新登录也不能继续尝试，正确的验证码同样被拒绝
+	code, _ := totp.Code(secret, clock)
+	if w := tc.verify(code); w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/login" {
+		t.Errorf("verify after lockout: %d %s", w.Code, w.Body)
+	}
+	if w := tc.login("alice"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("login after lockout: %d %s", w.Code, w.Body)
+	}
+	if tc.loggedIn() {
+		t.Error("logged in while locked out")
+	}
+}
+
+func TestLoginRequire2FAEnrollment(t *testing.T) {
+	clock := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	defer openTwoFactorTest(t, &clock)()
+	if err := models.SetSetting(models.SettingRequire2FA, "true"); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := newTwoFactorUser(t, "bob", "")
+
+	tc := newTwoFactorClient(t)
+	if w := tc.login("bob"); w.Code != http.StatusFound || w.Header().Get("Location") != "/admin/login/2fa" {
+		t.Fatalf("password step: %d %s", w.Code, w.Body)
+	}
+	w := tc.do("GET", "/admin/login/2fa", nil)
+	body := w.Body.String()
+	start := strings.Index(body, "secret=")
+	if !strings.HasPrefix(body, "enroll:") || start < 0 {
+		t.Fatalf("enrollment page: %s", body)
+	}
+	secret := strings.SplitN(body[start+len("secret="):], "|", 2)[0]
+	if tc.verify("000000"); tc.loggedIn() {
+		t.Fatal("logged in with a wrong enrollment code")
+	}
+	code, _ := totp.Code(secret, clock)
+	w = tc.verify(code)
+	if !strings.Contains(w.Body.String(), "codes=10") || !tc.loggedIn() {
+		t.Fatalf("confirm enrollment: %d %s", w.Code, w.Body)
+	}
+	enrolled, _ := models.GetUserByID(user.ID)
+	if !enrolled.TOTPEnabled || enrolled.TOTPSecret != secret {
+		t.Errorf("totp not enabled after enrollment")
+	}
+}
@@ -1,14 +1,16 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"lyanna/models"
 	"lyanna/utils"
+	"lyanna/utils/password"
 	"net/http"
+	"net/url"
 	"strconv"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,91 +20,87 @@ func UserLogin(c *gin.Context) {
 		user *models.User
 	)
 	username := c.PostForm("username")
-	password := c.PostForm("password")
-	if username == "" || password == "" {
-		c.HTML(http.StatusOK, "admin/login.html", gin.H{
+	plain := c.PostForm("password")
+	if username == "" || plain == "" {
+		c.HTML(http.StatusOK, "admin/login.html", adminH(c, gin.H{
 			"msg": "username or password not null",
-		})
+		}))
 		return
 	}
 	user, err = models.GetUserByName(username)
-	if err != nil || user.PassWord != utils.Md5(username+password) {
-		c.HTML(http.StatusOK, "admin/login.html", gin.H{
+	if err == nil {
+		err = user.CheckPassword(plain)
+	}
+	if err == password.ErrExpired {
+		c.HTML(http.StatusOK, "admin/login.html", adminH(c, gin.H{
+			"msg": "password is expired, please ask an administrator to reset it",
+		}))
+		return
+	}
+	if err != nil {
+		c.HTML(http.StatusOK, "admin/login.html", adminH(c, gin.H{
 			"msg": "invalid username or passwrod",
-		})
+		}))
 		return
 	}
 	if !user.Active {
-		c.HTML(http.StatusOK, "admin/login.html", gin.H{
+		c.HTML(http.StatusOK, "admin/login.html", adminH(c, gin.H{
 			"msg": "user is not active",
-		})
+		}))
+		return
+	}
+	// 两步验证被锁定期间不再开始新的验证，避免重新登录绕过失败次数限制
+	if user.TOTPEnabled && models.TwoFactorLocked(user.ID) {
+		c.HTML(http.StatusTooManyRequests, "admin/login.html", adminH(c, gin.H{
+			"msg": twoFactorLockedMsg,
+		}))
+		return
+	}
+	if user.TOTPEnabled || models.Require2FA() {
+		startTwoFactor(c, user)
 		return
 	}
-	s := sessions.Default(c)
-	s.Clear()
-	s.Set(models.SESSION_KEY, user.ID)
-	s.Save()
+	finishLogin(c, user)
 	c.Redirect(http.StatusMovedPermanently, "/admin")
 }
 
 func UserList(c *gin.Context) {
-	users, err := models.ListUsers()
-	if err != nil {
-		msg := fmt.Sprintf("list users err:%v", err)
-		Logger.Fatal(msg)
-	}
 	user, _ := c.Get(models.CONTEXT_USER_KEY)
-	pagination := utils.Pagination{
-		CurrentPage: 1,
-		PerPage:     models.Conf.General.PerPage,
-		Total:       len(users),
-	}
-	var perUsers []*models.User
-	if models.Conf.General.PerPage > len(users) {
-		perUsers = users
-	} else {
-		perUsers = users[:models.Conf.General.PerPage]
-	}
-	c.HTML(http.StatusOK, "admin/list_user.html", gin.H{
-		"users":      perUsers,
-		"user":       user,
-		"user_count": len(users),
-		"pagination": &pagination,
-	})
+	renderUserList(c, 1, gin.H{"user": user, "msg": c.Query("msg")})
 }
 
 func AdminUserPage(c *gin.Context) {
-	page := c.Param("page")
-	pageInt, err := strconv.ParseInt(page, 10, 32)
-	if err != nil {
-		msg := fmt.Sprintf("parse int err:%v", err)
-		Logger.Fatal(msg)
-	}
-	users, err := models.ListUsers()
-	if err != nil {
-		msg := fmt.Sprintf("list users err:%v", err)
-		Logger.Fatal(msg)
+	page, ok := pageParam(c.Param("page"))
+	if !ok {
+		pageNotFound(c)
+		return
 	}
 	user, _ := c.Get(models.CONTEXT_USER_KEY)
+	renderUserList(c, page, gin.H{"user": user})
+}
+
+// renderUserList 后台用户列表的第 page 页，data 为模板需要的其他数据
+func renderUserList(c *gin.Context, page int, data gin.H) {
 	pagination := utils.Pagination{
-		CurrentPage: int(pageInt),
+		CurrentPage: page,
 		PerPage:     models.Conf.General.PerPage,
-		Total:       len(users),
-	}
-	start := (int(pageInt) - 1) * models.Conf.General.PerPage
-	var end int
-	if start+models.Conf.General.PerPage > len(users) {
-		end = len(users)
-	} else {
-		end = start + models.Conf.General.PerPage
-	}
-	perUsers := users[start:end]
-	c.HTML(http.StatusOK, "admin/list_user.html", gin.H{
-		"users":      perUsers,
-		"user":       user,
-		"user_count": len(users),
-		"pagination": &pagination,
-	})
+	}
+	users, total, err := models.ListUsersPage(pagination.Offset(), pagination.PerPage)
+	if err != nil {
+		msg := fmt.Sprintf("list users err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	pagination.Total = total
+	if pagination.OutOfRange() {
+		pageNotFound(c)
+		return
+	}
+	data["users"] = users
+	data["user_count"] = total
+	data["pagination"] = &pagination
+	c.HTML(http.StatusOK, "admin/list_user.html", adminH(c, data))
 }
 
 func PostUserEdit(c *gin.Context) {
@@ -114,29 +112,39 @@ func PostUserEdit(c *gin.Context) {
 	}
 	name := c.PostForm("username")
 	email := c.PostForm("email")
-	password := c.PostForm("password")
+	plain := c.PostForm("password")
 	active := c.PostForm("active") == "on"
 
 	user := &models.User{
-		Name:     name,
-		Email:    email,
-		PassWord: password,
-		Active:   active,
+		Name:   name,
+		Email:  email,
+		Active: active,
+		Role:   formRole(c),
 	}
 	user.ID = uID
-	err = user.Update()
+	// 不能修改自己的角色，避免唯一的管理员失去后台管理权限
+	if uID == currentUserID(c) {
+		user.Role = ""
+		user.Active = true
+	}
+	err = trashedUserName(name, uID)
+	if err == nil && plain != "" {
+		err = user.SetPassword(plain)
+	}
+	if err == nil {
+		err = user.Update()
+	}
 	if err != nil {
-		c.HTML(http.StatusOK, "admin/list_user.html", gin.H{
-			"user": user,
-			"msg":  err.Error(),
-		})
+		c.HTML(http.StatusOK, "admin/user.html", adminH(c, gin.H{
+			"user":  user,
+			"roles": models.Roles,
+			"msg":   err.Error(),
+		}))
+		return
 	}
-	users, _ := models.ListUsers()
-	c.HTML(http.StatusOK, "admin/list_user.html", gin.H{
-		"users":      users,
-		"user":       user,
-		"user_count": len(users),
-		"msg":        "User was successfully updated.",
+	renderUserList(c, 1, gin.H{
+		"user": user,
+		"msg":  "User was successfully updated.",
 	})
 }
 
@@ -151,36 +159,87 @@ func GetEditUser(c *gin.Context) {
 	if user == nil {
 		c.Redirect(http.StatusMovedPermanently, "/admin/users")
 	}
-	c.HTML(http.StatusOK, "admin/user.html", gin.H{
-		"user": user,
-	})
+	c.HTML(http.StatusOK, "admin/user.html", adminH(c, gin.H{
+		"user":  user,
+		"roles": models.Roles,
+	}))
 }
 
 func GetCreateUser(c *gin.Context) {
-	c.HTML(http.StatusOK, "admin/user.html", nil)
+	c.HTML(http.StatusOK, "admin/user.html", adminH(c, gin.H{"roles": models.Roles}))
 }
 
 func PostCreateUser(c *gin.Context) {
 	name := c.PostForm("username")
 	email := c.PostForm("email")
-	password := c.PostForm("password")
+	plain := c.PostForm("password")
 	active := c.PostForm("active") == "on"
-	md5Password := utils.Md5(name + password)
 	user := &models.User{
-		Name:     name,
-		Email:    email,
-		PassWord: md5Password,
-		Active:   active,
+		Name:   name,
+		Email:  email,
+		Active: active,
+		Role:   formRole(c),
+	}
+	if user.Role == "" {
+		user.Role = models.RoleContributor
+	}
+	err := trashedUserName(name, 0)
+	if err == nil {
+		err = user.SetPassword(plain)
+	}
+	if err == nil {
+		err = user.Insert()
 	}
-	err := user.Insert()
 	if err != nil {
+		c.HTML(http.StatusOK, "admin/user.html", adminH(c, gin.H{
+			"roles": models.Roles,
+			"msg":   err.Error(),
+		}))
 		return
 	}
-	users, _ := models.ListUsers()
-	c.HTML(http.StatusOK, "admin/list_user.html", gin.H{
-		"users":      users,
-		"user":       user,
-		"user_count": len(users),
-		"msg":        "User was successfully created.",
+	renderUserList(c, 1, gin.H{
+		"user": user,
+		"msg":  "User was successfully created.",
 	})
 }
+
+// trashedUserName 用户名被回收站中的用户占用时返回错误
+func trashedUserName(name string, id uint64) error {
+	if models.NameInTrash(models.TrashUsers, name, id) {
+		return errors.New("user name is in the trash, restore or permanently delete that user first")
+	}
+	return nil
+}
+
+// formRole 读取表单中的角色，非法值返回空字符串
+func formRole(c *gin.Context) string {
+	role := c.PostForm("role")
+	if !models.IsRole(role) {
+		return ""
+	}
+	return role
+}
+
+// DeleteUser 把用户移到回收站，不能删除自己
+func DeleteUser(c *gin.Context) {
+	user, err := models.GetUserByID(c.Param("id"))
+	if err != nil {
+		c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
+			"message": "User not found!",
+		})
+		return
+	}
+	if user.ID == currentUserID(c) {
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "You cannot delete yourself!",
+		})
+		return
+	}
+	if err := user.Delete(); err != nil {
+		msg := fmt.Sprintf("delete user err:%v", err)
+		Logger.Error(msg)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/users?msg="+url.QueryEscape(user.Name+" was moved to the trash."))
+}
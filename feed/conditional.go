@@ -0,0 +1,57 @@
+package feed
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag 根据内容生成强校验的 ETag
+func ETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// NotModified 按 If-None-Match 和 If-Modified-Since 判断客户端缓存是否仍然有效，
+// 两者同时存在时以 If-None-Match 为准
+func NotModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		// HTTP 日期只精确到秒
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// Write 输出订阅源，设置 ETag 和 Last-Modified，客户端缓存有效时返回 304
+func Write(w http.ResponseWriter, r *http.Request, contentType string, body []byte, modified time.Time) {
+	etag := ETag(body)
+	h := w.Header()
+	h.Set("ETag", etag)
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	h.Set("Cache-Control", "public, max-age=300")
+	if NotModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", contentType)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,186 @@
+// Package feed 把文章列表输出为 RSS 2.0、Atom 1.0 和 JSON Feed 1.1，并处理条件请求
+package feed
+
+import (
+	"encoding/json"
+	"html"
+	"time"
+
+	"github.com/gorilla/feeds"
+)
+
+// 各格式的 Content-Type
+const (
+	RSSContentType  = "application/rss+xml; charset=utf-8"
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	JSONContentType = "application/feed+json; charset=utf-8"
+)
+
+// JSONFeedVersion JSON Feed 规范版本
+const JSONFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// Author 作者
+type Author struct {
+	Name  string
+	Email string
+	URL   string
+}
+
+// Item 订阅源中的一篇文章
+type Item struct {
+	ID          string // 全局唯一标识，通常为文章的绝对地址
+	URL         string
+	Title       string
+	Summary     string // 纯文本，RSS 和 Atom 中转义后作为 HTML 输出
+	ContentHTML string // 为空时只输出摘要
+	Author      *Author
+	Tags        []string
+	Published   time.Time
+	Updated     time.Time
+}
+
+// Feed 订阅源
+type Feed struct {
+	Title       string
+	Description string
+	HomeURL     string
+	FeedURL     string // 当前格式订阅源自身的地址
+	Language    string
+	Author      *Author
+	Items       []*Item
+}
+
+// Updated 订阅源的最后修改时间，即所有文章中最新的修改时间
+func (f *Feed) Updated() time.Time {
+	var updated time.Time
+	for _, item := range f.Items {
+		if t := item.lastModified(); t.After(updated) {
+			updated = t
+		}
+	}
+	return updated
+}
+
+func (item *Item) lastModified() time.Time {
+	if item.Updated.After(item.Published) {
+		return item.Updated
+	}
+	return item.Published
+}
+
+func (f *Feed) gorilla() *feeds.Feed {
+	g := &feeds.Feed{
+		Title:       f.Title,
+		Link:        &feeds.Link{Href: f.HomeURL},
+		Description: f.Description,
+		Id:          f.HomeURL,
+		Updated:     f.Updated(),
+	}
+	if f.Author != nil {
+		g.Author = &feeds.Author{Name: f.Author.Name, Email: f.Author.Email}
+	}
+	for _, item := range f.Items {
+		gi := &feeds.Item{
+			Id:          item.ID,
+			Title:       item.Title,
+			Link:        &feeds.Link{Href: item.URL},
+			Description: html.EscapeString(item.Summary),
+			Content:     item.ContentHTML,
+			Created:     item.Published,
+			Updated:     item.Updated,
+		}
+		if item.Author != nil {
+			gi.Author = &feeds.Author{Name: item.Author.Name, Email: item.Author.Email}
+		}
+		g.Items = append(g.Items, gi)
+	}
+	return g
+}
+
+// RSS 输出 RSS 2.0
+func (f *Feed) RSS() ([]byte, error) {
+	s, err := f.gorilla().ToRss()
+	return []byte(s), err
+}
+
+// Atom 输出 Atom 1.0
+func (f *Feed) Atom() ([]byte, error) {
+	s, err := f.gorilla().ToAtom()
+	return []byte(s), err
+}
+
+type jsonAuthor struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url,omitempty"`
+	Title         string       `json:"title,omitempty"`
+	ContentHTML   string       `json:"content_html,omitempty"`
+	ContentText   string       `json:"content_text,omitempty"`
+	Summary       string       `json:"summary,omitempty"`
+	DatePublished string       `json:"date_published,omitempty"`
+	DateModified  string       `json:"date_modified,omitempty"`
+	Authors       []jsonAuthor `json:"authors,omitempty"`
+	Tags          []string     `json:"tags,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url,omitempty"`
+	FeedURL     string       `json:"feed_url,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Language    string       `json:"language,omitempty"`
+	Authors     []jsonAuthor `json:"authors,omitempty"`
+	Items       []jsonItem   `json:"items"`
+}
+
+func jsonAuthors(author *Author) []jsonAuthor {
+	if author == nil || author.Name == "" {
+		return nil
+	}
+	return []jsonAuthor{{Name: author.Name, URL: author.URL}}
+}
+
+func jsonTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// JSON 输出 JSON Feed 1.1，没有全文时用摘要作为 content_text
+func (f *Feed) JSON() ([]byte, error) {
+	out := jsonFeed{
+		Version:     JSONFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Language:    f.Language,
+		Authors:     jsonAuthors(f.Author),
+		Items:       make([]jsonItem, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		ji := jsonItem{
+			ID:            item.ID,
+			URL:           item.URL,
+			Title:         item.Title,
+			Summary:       item.Summary,
+			DatePublished: jsonTime(item.Published),
+			DateModified:  jsonTime(item.Updated),
+			Authors:       jsonAuthors(item.Author),
+			Tags:          item.Tags,
+		}
+		if item.ContentHTML != "" {
+			ji.ContentHTML = item.ContentHTML
+		} else {
+			ji.ContentText = item.Summary
+		}
+		out.Items = append(out.Items, ji)
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
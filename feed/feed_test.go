@@ -0,0 +1,169 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	published := time.Date(2019, 6, 1, 8, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title:       "Blog",
+		Description: "Notes",
+		HomeURL:     "https://example.com",
+		FeedURL:     "https://example.com/feed.json",
+		Author:      &Author{Name: "alice", Email: "alice@example.com"},
+		Items: []*Item{
+			{
+				ID: "https://example.com/post/2", URL: "https://example.com/post/2", Title: "Second",
+				Summary: "second summary", ContentHTML: "<p>full</p>", Tags: []string{"go"},
+				Author: &Author{Name: "bob"}, Published: published.Add(48 * time.Hour), Updated: published.Add(72 * time.Hour),
+			},
+			{
+				ID: "https://example.com/post/1", URL: "https://example.com/post/1", Title: "First",
+				Summary: "first summary", Published: published, Updated: published,
+			},
+		},
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	want := time.Date(2019, 6, 4, 8, 0, 0, 0, time.UTC)
+	if got := testFeed().Updated(); !got.Equal(want) {
+		t.Fatalf("Updated() = %v, want %v", got, want)
+	}
+}
+
+func TestRSSAndAtom(t *testing.T) {
+	f := testFeed()
+	rss, err := f.RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<managingEditor>alice@example.com (alice)</managingEditor>",
+		"<pubDate>Mon, 03 Jun 2019 08:00:00 +0000</pubDate>",
+		"<content:encoded><![CDATA[<p>full</p>]]></content:encoded>",
+	} {
+		if !strings.Contains(string(rss), want) {
+			t.Errorf("rss missing %s:\n%s", want, rss)
+		}
+	}
+	atom, err := f.Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<updated>2019-06-04T08:00:00Z</updated>", `<id>https://example.com/post/1</id>`} {
+		if !strings.Contains(string(atom), want) {
+			t.Errorf("atom missing %s:\n%s", want, atom)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	b, err := testFeed().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["version"] != JSONFeedVersion {
+		t.Errorf("version = %v", out["version"])
+	}
+	items := out["items"].([]interface{})
+	first, second := items[0].(map[string]interface{}), items[1].(map[string]interface{})
+	if first["content_html"] != "<p>full</p>" || first["date_modified"] != "2019-06-04T08:00:00Z" {
+		t.Errorf("first item = %v", first)
+	}
+	if second["content_text"] != "first summary" || second["content_html"] != nil {
+		t.Errorf("item without content should fall back to content_text: %v", second)
+	}
+	if authors := first["authors"].([]interface{}); authors[0].(map[string]interface{})["name"] != "bob" {
+		t.Errorf("authors = %v", authors)
+	}
+}
+
+func TestWriteConditional(t *testing.T) {
+	body := []byte("<rss/>")
+	modified := time.Date(2019, 6, 4, 8, 0, 0, 500, time.UTC)
+	etag := ETag(body)
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"plain", nil, http.StatusOK},
+		{"etag match", map[string]string{"If-None-Match": `"x", ` + etag}, http.StatusNotModified},
+		{"weak etag match", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"etag mismatch wins over date", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": "Tue, 04 Jun 2019 08:00:00 GMT"}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": "Tue, 04 Jun 2019 08:00:00 GMT"}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Tue, 04 Jun 2019 07:59:59 GMT"}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/rss", nil)
+		for k, v := range tc.header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		Write(w, r, RSSContentType, body, modified)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, tc.want)
+		}
+		if w.Header().Get("ETag") != etag || w.Header().Get("Last-Modified") != "Tue, 04 Jun 2019 08:00:00 GMT" {
+			t.Errorf("%s: headers = %v", tc.name, w.Header())
+		}
+		if tc.want == http.StatusOK && w.Body.String() != string(body) {
+			t.Errorf("%s: body = %q", tc.name, w.Body.String())
+		}
+		if tc.want == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 should not have a body", tc.name)
+		}
+	}
+}
+
+// TestSummaryText 摘要为纯文本：JSON Feed 原样输出，RSS 中转义为 HTML
+func TestSummaryText(t *testing.T) {
+	f := testFeed()
+	summary := `Tom & Jerry's <b> "show"`
+	f.Items[1].Summary = summary
+	b, err := f.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Items []struct {
+			Summary     string `json:"summary"`
+			ContentText string `json:"content_text"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Items[1].Summary != summary || out.Items[1].ContentText != summary {
+		t.Errorf("json summary %q, content_text %q, want %q", out.Items[1].Summary, out.Items[1].ContentText, summary)
+	}
+	rss, err := f.RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Items []struct {
+			Description string `xml:"description"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(rss, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := html.EscapeString(summary); doc.Items[1].Description != want {
+		t.Errorf("rss description %q, want %q", doc.Items[1].Description, want)
+	}
+}
@@ -3,6 +3,7 @@ module lyanna
 go 1.12
 
 require (
+	github.com/alecthomas/chroma v0.10.0
 	github.com/alimoeeny/gooauth2 v0.0.0-20140214171402-62c620a8c7eb
 	github.com/garyburd/redigo v1.6.0
 	github.com/gin-contrib/sessions v0.0.1
@@ -11,6 +12,7 @@ require (
 	github.com/gorilla/feeds v1.1.1
 	github.com/jinzhu/gorm v1.9.10
 	github.com/microcosm-cc/bluemonday v1.0.2
+	github.com/mozillazg/go-pinyin v0.15.0
 	github.com/pkg/errors v0.8.0
 	github.com/russross/blackfriday v1.5.2
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
@@ -18,6 +20,8 @@ require (
 	go.uber.org/atomic v1.4.0 // indirect
 	go.uber.org/multierr v1.2.0 // indirect
 	go.uber.org/zap v1.10.0
+	golang.org/x/crypto v0.0.0-20190325154230-a5d413f7728c
+	golang.org/x/image v0.0.0-20190802002840-cff245a6509b
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/yaml.v2 v2.2.2
 )
@@ -4,12 +4,19 @@ import (
 	"html/template"
 	"log"
 	"lyanna/controllers"
+	"lyanna/media"
 	"lyanna/models"
+	"lyanna/permalink"
+	"lyanna/render"
+	"lyanna/spam"
 	"lyanna/utils"
+	"lyanna/utils/openapi"
+	"lyanna/utils/password"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -17,17 +24,27 @@ import (
 )
 
 func main() {
+	if err := models.Init(); err != nil {
+		log.Fatal(err)
+	}
+	controllers.Logger = models.Logger
 	gin.SetMode(models.Conf.RunMode)
 	router := gin.Default()
 	setTemplate(router)
 	setSessions(router)
-	router.Use(ShareData())
+	setSpamChecker()
+	setPasswordHasher()
+	setMediaStorage(router)
+	setPermalink()
+	router.Use(ShareData(), controllers.TokenAuth(), controllers.CSRFRequired())
 	router.Static("/static", filepath.Join(getCurrentDirectory(), "./static"))
 
 	router.GET("/", controllers.Index)
 	router.GET("/tags", controllers.Tags)
 	router.GET("/tag/:id", controllers.Tag)
+	// 其他格式的文章链接由 NoRoute 按 permalink.pattern 解析
 	router.GET("/post/:id", controllers.GetPost)
+	router.NoRoute(controllers.GetPost)
 
 	router.GET("/archives", controllers.Archives)
 	router.GET("/archives/:year", controllers.ArchivesByYear)
@@ -37,47 +54,119 @@ func main() {
 	router.GET("/oauth2/auth/post/:id", controllers.AuthGet)
 	router.GET("/admin/login", controllers.AdminLogin)
 	router.POST("/admin/login", controllers.UserLogin)
-	router.POST("/api/publish/:id", controllers.PostPublish)
-	router.DELETE("/api/publish/:id", controllers.DeletePublish)
+	router.GET("/admin/login/2fa", controllers.LoginTwoFactor)
+	router.POST("/admin/login/2fa", controllers.PostLoginTwoFactor)
 
 	router.GET("/comments/post/:id", controllers.Comments)
-	router.GET("/rss", controllers.GetRss)
+	router.GET("/author/:name", controllers.Author)
+	for _, path := range controllers.FeedPaths() {
+		router.GET(path, controllers.GetFeed)
+		router.HEAD(path, controllers.GetFeed)
+		router.GET("/tag/:id"+path, controllers.GetTagFeed)
+		router.HEAD("/tag/:id"+path, controllers.GetTagFeed)
+		router.GET("/author/:name"+path, controllers.GetAuthorFeed)
+		router.HEAD("/author/:name"+path, controllers.GetAuthorFeed)
+	}
 	router.GET("/page/:aboutme", controllers.AboutMe)
 	router.GET("/search", controllers.GetSearch)
-	router.GET("/json/search", controllers.PostSearch)
 	router.GET("/pages/:page", controllers.PostPage)
 
+	publish := router.Group("/api/publish")
+	publish.Use(AdminRequired(), PermissionRequired(models.PermPublishPosts))
+	{
+		publish.POST("/:id", controllers.PostPublish)
+		publish.DELETE("/:id", controllers.DeletePublish)
+	}
+
+	controllers.RegisterAPIV1(router.Group(controllers.APIV1Prefix))
+	checkAPIV1(router)
+
 	admin := router.Group("/admin")
 	admin.Use(AdminRequired())
 	{
-		admin.GET("/posts", controllers.PostIndex)
+		// 文章的归属和发布权限在 controller 中按文章检查
+		posts := PermissionRequired(models.PermCreatePosts)
+		admin.GET("/posts", posts, controllers.PostIndex)
 
-		admin.GET("/post/edit/:id", controllers.GetEditPost)
-		admin.POST("/post/edit/:id", controllers.UpdatePost)
+		admin.GET("/post/edit/:id", posts, controllers.GetEditPost)
+		admin.POST("/post/edit/:id", posts, controllers.UpdatePost)
 
-		admin.GET("/post/new", controllers.GetNewPost)
-		admin.POST("/post/new", controllers.AddPost)
+		admin.GET("/post/new", posts, controllers.GetNewPost)
+		admin.POST("/post/new", posts, controllers.AddPost)
 
-		admin.GET("/posts/page/:page", controllers.AdminPostPage)
-		admin.GET("/users/page/:page", controllers.AdminUserPage)
+		admin.GET("/posts/page/:page", posts, controllers.AdminPostPage)
+		admin.DELETE("/post/delete/:id", posts, controllers.DeletePost)
 
-		admin.GET("/post/preview/:id", controllers.PreviewGetPost)
+		admin.GET("/post/preview/:id", posts, controllers.PreviewGetPost)
+		admin.GET("/post/revisions/:id", posts, controllers.PostRevisions)
+		admin.POST("/post/revisions/:id", posts, controllers.RestorePostRevision)
 		admin.GET("/", controllers.AdminIndex)
 
-		admin.GET("/users", controllers.UserList)
-		admin.GET("/user/edit/:id", controllers.GetEditUser)
-		admin.POST("/user/edit/:id", controllers.PostUserEdit)
-		admin.GET("/user/new", controllers.GetCreateUser)
-		admin.POST("/user/new", controllers.PostCreateUser)
+		comments := PermissionRequired(models.PermModerateComments)
+		admin.GET("/comments", comments, controllers.AdminComments)
+		admin.POST("/comments", comments, controllers.AdminCommentsAction)
+
+		users := PermissionRequired(models.PermManageUsers)
+		admin.GET("/users", users, controllers.UserList)
+		admin.GET("/users/page/:page", users, controllers.AdminUserPage)
+		admin.GET("/user/edit/:id", users, controllers.GetEditUser)
+		admin.POST("/user/edit/:id", users, controllers.PostUserEdit)
+		admin.GET("/user/new", users, controllers.GetCreateUser)
+		admin.POST("/user/new", users, controllers.PostCreateUser)
+		admin.POST("/user/delete/:id", users, controllers.DeleteUser)
+
+		// 回收站按记录类型在 controller 中检查权限
+		admin.GET("/trash", controllers.AdminTrash)
+		admin.POST("/trash", controllers.AdminTrashAction)
+
+		// 账号安全设置只能在登录会话中修改
+		session := controllers.SessionRequired()
+		admin.GET("/2fa", session, controllers.TwoFactor)
+		admin.POST("/2fa", session, controllers.PostTwoFactor)
+		admin.POST("/2fa/disable", session, controllers.DisableTwoFactor)
+		admin.POST("/2fa/recovery", session, controllers.RegenerateRecoveryCodes)
+
+		admin.GET("/tokens", session, controllers.AdminTokens)
+		admin.POST("/tokens", session, controllers.PostAdminToken)
+		admin.POST("/token/revoke/:id", session, controllers.RevokeAdminToken)
+
+		upload := PermissionRequired(models.PermUploadMedia)
+		admin.GET("/media", upload, controllers.AdminMedia)
+		admin.GET("/media/page/:page", upload, controllers.AdminMediaPage)
+		admin.POST("/media", upload, controllers.PostAdminMedia)
+		admin.POST("/media/upload", upload, controllers.UploadMedia)
+		admin.POST("/media/delete/:id", PermissionRequired(models.PermManageMedia), controllers.DeleteMedia)
+
+		settings := PermissionRequired(models.PermManageSettings)
+		admin.GET("/settings", settings, controllers.AdminSettings)
+		admin.POST("/settings", settings, controllers.PostAdminSettings)
+	}
+
+	reactions := router.Group("/api/post")
+	reactions.Use(AuthRequired())
+	{
+		reactions.POST("/:id/reactions", controllers.AddReaction)
+		reactions.DELETE("/:id/reactions", controllers.DeleteReaction)
 	}
 
 	auth := router.Group("/comment")
 	auth.Use(AuthRequired())
 	{
 		auth.POST("/post/:id", controllers.CreateComment)
+		auth.POST("/post/:id/reply", controllers.ReplyComment)
 		auth.POST("/markdown", controllers.CommentMarkdown)
 	}
 
+	if err := models.EnsurePostSlugs(); err != nil {
+		log.Fatal(err)
+	}
+	if err := models.RebuildSearchIndex(); err != nil {
+		log.Fatal(err)
+	}
+	models.StartPostScheduler(time.Duration(models.Conf.Scheduler.Interval) * time.Second)
+	models.StartSearchSync(time.Duration(models.Conf.Scheduler.Interval) * time.Second)
+	models.StartTrashCleaner(time.Duration(models.Conf.Trash.RetentionDays) * 24 * time.Hour)
+
 	err := router.Run(models.Conf.General.Addr)
 	if err != nil {
 		log.Fatal(err)
@@ -110,9 +199,75 @@ func setSessions(router *gin.Engine) {
 	router.Use(sessions.Sessions("gin-session", store))
 }
 
+// checkAPIV1 启动时检查 /api/v1 下的路由与 OpenAPI 文档一致，避免绕过接口表直接注册路由
+func checkAPIV1(router *gin.Engine) {
+	var routes []openapi.Route
+	for _, r := range router.Routes() {
+		routes = append(routes, openapi.Route{Method: r.Method, Path: r.Path})
+	}
+	err := openapi.Check(controllers.APIV1Prefix, controllers.APIV1Operations(), routes, controllers.APIV1Prefix+"/openapi.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func setSpamChecker() {
+	conf := models.Conf.Spam
+	switch conf.Engine {
+	case "bayes":
+		controllers.SpamChecker = spam.NewBayes(spam.NewRedisStore(models.RedisPool), conf.Threshold, conf.MinDocs)
+	case "remote":
+		controllers.SpamChecker = spam.NewHTTPChecker(conf.Endpoint, conf.Key, conf.Blog)
+	}
+}
+
+// setMediaStorage 按配置选择上传文件的存储，本地存储时同时提供文件的访问路径；
+// 配置了预设宽度时为文章中的图片生成缩小版本
+func setMediaStorage(router *gin.Engine) {
+	conf := models.Conf.Media
+	switch conf.Storage {
+	case "s3":
+		models.MediaStorage = media.NewS3(conf.Endpoint, conf.Bucket, conf.Region, conf.AccessKey, conf.SecretKey, conf.PublicURL)
+	default:
+		dir := conf.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(getCurrentDirectory(), dir)
+		}
+		models.MediaStorage = media.NewLocal(dir, conf.URL)
+		router.Static(conf.URL, dir)
+	}
+	if len(conf.Widths) > 0 {
+		secret := conf.SignKey
+		if secret == "" {
+			secret = models.Conf.General.SessionSecret
+		}
+		models.MediaResizer = media.NewResizer(models.MediaStorage, conf.CacheDir, "/media/resize", secret, conf.Widths, conf.Quality)
+		router.GET("/media/resize/:width/*key", controllers.MediaDerivative)
+		render.Post.Use(render.ResponsiveImages(models.MediaSrcset, conf.Sizes))
+		controllers.PostRenderConfig = models.MediaResizer.Fingerprint() + "|" + conf.Sizes
+	}
+}
+
+// setPermalink 按配置设置文章链接格式，未配置时使用 /post/:id
+func setPermalink() {
+	if pattern := models.Conf.Permalink.Pattern; pattern != "" {
+		p, err := permalink.Parse(pattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		models.PostPermalink = p
+	}
+}
+
+func setPasswordHasher() {
+	conf := models.Conf.Password
+	password.Default = password.NewHasher(conf.Algorithm, conf.BcryptCost)
+}
+
 func ShareData() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
+		c.Set(models.CONTEXT_CSRF_KEY, controllers.EnsureCSRFToken(c))
 		if uID := session.Get(models.SESSION_KEY); uID != nil {
 			user, err := models.GetUserByID(uID)
 			if err == nil {
@@ -133,7 +288,29 @@ func ShareData() gin.HandlerFunc {
 func AdminRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if user, _ := c.Get(models.CONTEXT_USER_KEY); user != nil {
-			if _, ok := user.(*models.User); ok {
+			if u, ok := user.(*models.User); ok {
+				// 站点要求两步验证后，已登录但未绑定的用户只能访问绑定页
+				if !u.TOTPEnabled && !strings.HasPrefix(c.Request.URL.Path, "/admin/2fa") && models.Require2FA() {
+					c.Redirect(http.StatusFound, "/admin/2fa")
+					c.Abort()
+					return
+				}
+				c.Next()
+				return
+			}
+		}
+		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+			"message": "Forbidden!",
+		})
+		c.Abort()
+	}
+}
+
+// PermissionRequired 要求当前后台用户拥有指定权限，需在 AdminRequired 之后使用
+func PermissionRequired(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, _ := c.Get(models.CONTEXT_USER_KEY); user != nil {
+			if u, ok := user.(*models.User); ok && u.Can(perm) {
 				c.Next()
 				return
 			}
@@ -156,5 +333,6 @@ func AuthRequired() gin.HandlerFunc {
 		c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
 			"message": "Forbidden!",
 		})
+		c.Abort()
 	}
 }
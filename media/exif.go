@@ -0,0 +1,193 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("media: malformed image")
+
+// JPEG 中需要去掉的段：APP1（EXIF、XMP）、APP13（IPTC）和注释，ICC 色彩配置（APP2）等保留
+var jpegDropped = map[byte]bool{0xE1: true, 0xED: true, 0xFE: true}
+
+// stripJPEG 去掉 JPEG 的元数据段；原图带有旋转方向时写回只包含方向的 EXIF，
+// 避免手机拍摄的照片显示时方向错误
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errMalformed
+	}
+	var out bytes.Buffer
+	out.Write(data[:2])
+	orientation := 0
+	insertAt := out.Len()
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, errMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // 填充字节
+			i++
+			continue
+		}
+		if marker == 0xDA { // SOS 之后是图像数据，原样保留
+			out.Write(data[i:])
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, errMalformed
+		}
+		segment := data[i:end]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")):
+			if o := exifOrientation(segment[10:]); o > 1 {
+				orientation = o
+			}
+		case jpegDropped[marker]:
+		default:
+			out.Write(segment)
+			if marker == 0xE0 && insertAt == 2 { // EXIF 放在 JFIF 之后
+				insertAt = out.Len()
+			}
+		}
+		i = end
+	}
+	result := out.Bytes()
+	if orientation > 1 {
+		exif := orientationExif(orientation)
+		result = append(result[:insertAt:insertAt], append(exif, result[insertAt:]...)...)
+	}
+	return result, nil
+}
+
+// exifOrientation 读取 TIFF 结构中 IFD0 的 Orientation（0x0112），没有时返回 0
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) || offset < 8 {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// jpegOrientation 读取 JPEG 中 EXIF 记录的旋转方向，没有时返回 0
+func jpegOrientation(data []byte) int {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			break
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return exifOrientation(data[i+10 : end])
+		}
+		i = end
+	}
+	return 0
+}
+
+// orientationExif 只包含 Orientation 一项的 APP1 段
+func orientationExif(orientation int) []byte {
+	segment := []byte{
+		0xFF, 0xE1, 0x00, 0x22,
+		'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // TIFF 头，IFD0 紧随其后
+		0x00, 0x01, // 一项
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // 没有下一个 IFD
+	}
+	return segment
+}
+
+// PNG 中去掉的元数据块
+var pngDropped = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errMalformed
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i+12 {
+			return nil, errMalformed
+		}
+		kind := string(data[i+4 : i+8])
+		if !pngDropped[kind] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if kind == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebP 去掉 WebP 的 EXIF 和 XMP 块，并清除 VP8X 中对应的标志位
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i+8 {
+			return nil, errMalformed
+		}
+		chunk := append([]byte(nil), data[i:end]...)
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(chunk)
+		}
+		i = end
+	}
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
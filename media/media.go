@@ -0,0 +1,123 @@
+// Package media 处理后台上传的图片和媒体文件：检查类型、去掉 EXIF 等元数据、按内容哈希命名，
+// 并通过 Storage 保存到本地目录或兼容 S3 的对象存储
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrNotFound        = errors.New("media: object not found")
+	ErrUnsupportedType = errors.New("media: unsupported content type")
+	ErrTypeMismatch    = errors.New("media: content does not match the declared type")
+)
+
+// Storage 媒体文件的存储后端，key 为 File.Key 生成的相对路径
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+	URL(key string) string
+}
+
+// contentTypes 允许上传的类型及保存时使用的扩展名
+var contentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"application/pdf": ".pdf",
+}
+
+// File 处理后待保存的文件
+type File struct {
+	Name        string // 上传时的文件名
+	Data        []byte
+	ContentType string
+	Ext         string
+	Hash        string // 处理后内容的 SHA-256，相同内容只保存一份
+	Width       int    // 图片尺寸，其他类型为 0
+	Height      int
+}
+
+// Key 文件在存储中的路径，按哈希前两位分目录
+func (f *File) Key() string {
+	return f.Hash[:2] + "/" + f.Hash + f.Ext
+}
+
+// IsImage 是否为图片
+func (f *File) IsImage() bool {
+	return strings.HasPrefix(f.ContentType, "image/")
+}
+
+// Process 根据内容判断文件类型，只接受允许的类型，并且与上传时声明的类型一致；
+// 图片会去掉 EXIF、XMP 等元数据，JPEG 保留旋转方向
+func Process(name, declared string, data []byte) (*File, error) {
+	contentType := sniff(data)
+	ext, ok := contentTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	if declared := declaredType(declared); declared != "" && declared != contentType {
+		return nil, ErrTypeMismatch
+	}
+	file := &File{Name: name, ContentType: contentType, Ext: ext}
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		data, err = stripJPEG(data)
+	case "image/png":
+		data, err = stripPNG(data)
+	case "image/webp":
+		data, err = stripWebP(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.IsImage() {
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrUnsupportedType
+		}
+		file.Width, file.Height = config.Width, config.Height
+		if contentType == "image/jpeg" && jpegOrientation(data) >= 5 { // 记录转正后显示的尺寸
+			file.Width, file.Height = config.Height, config.Width
+		}
+	}
+	sum := sha256.Sum256(data)
+	file.Data = data
+	file.Hash = hex.EncodeToString(sum[:])
+	return file, nil
+}
+
+// declaredType 上传时声明的类型，未声明或为通用的二进制类型时返回空字符串
+func declaredType(declared string) string {
+	contentType, _, err := mime.ParseMediaType(declared)
+	if err != nil || contentType == "application/octet-stream" {
+		return ""
+	}
+	if contentType == "image/jpg" || contentType == "image/pjpeg" {
+		return "image/jpeg"
+	}
+	return contentType
+}
+
+func sniff(data []byte) string {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return contentType
+}
@@ -0,0 +1,270 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	return img
+}
+
+// exifSegment 带有方向和一段“隐私”文本的 APP1 段，文本放在 IFD 之后
+func exifSegment(orientation int) []byte {
+	tiff := []byte{'I', 'I', 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00, 0x01, 0x00,
+		0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, byte(orientation), 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00}
+	tiff = append(tiff, "GPS 31.2304N 121.4737E"...)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func jpegWithExif(t *testing.T, orientation int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	return append(append(append([]byte(nil), data[:2]...), exifSegment(orientation)...), data[2:]...)
+}
+
+func pngWithText(t *testing.T, text string) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	chunk := make([]byte, 8, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(chunk, text...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+	iend := len(data) - 12
+	return append(append(append([]byte(nil), data[:iend]...), chunk...), data[iend:]...)
+}
+
+func TestProcessJPEG(t *testing.T) {
+	file, err := Process("photo.JPG", "image/jpeg", jpegWithExif(t, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.ContentType != "image/jpeg" || file.Ext != ".jpg" || file.Width != 3 || file.Height != 4 {
+		t.Errorf("unexpected file: %+v", file)
+	}
+	if bytes.Contains(file.Data, []byte("GPS")) {
+		t.Error("EXIF data was not removed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(file.Data)); err != nil {
+		t.Errorf("stripped JPEG does not decode: %v", err)
+	}
+	exif := bytes.Index(file.Data, []byte("Exif\x00\x00"))
+	if exif < 0 || exifOrientation(file.Data[exif+6:]) != 6 {
+		t.Error("orientation should be kept")
+	}
+	// 只有元数据不同的图片内容相同
+	other, err := Process("copy.jpg", "", jpegWithExif(t, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash != file.Hash || file.Key() != file.Hash[:2]+"/"+file.Hash+".jpg" {
+		t.Errorf("hash %s != %s", other.Hash, file.Hash)
+	}
+	// 方向为默认值时不写回 EXIF
+	plain, _ := Process("a.jpg", "", jpegWithExif(t, 1))
+	if bytes.Contains(plain.Data, []byte("Exif")) {
+		t.Error("default orientation should not be written")
+	}
+}
+
+func TestProcessPNG(t *testing.T) {
+	file, err := Process("a.png", "application/octet-stream", pngWithText(t, "Author\x00alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(file.Data, []byte("alice")) {
+		t.Error("tEXt chunk was not removed")
+	}
+	if _, err := png.Decode(bytes.NewReader(file.Data)); err != nil {
+		t.Errorf("stripped PNG does not decode: %v", err)
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	cases := []struct {
+		declared string
+		data     []byte
+		err      error
+	}{
+		{"image/png", []byte("<html><script>alert(1)</script></html>"), ErrUnsupportedType},
+		{"image/jpeg", pngWithText(t, "x\x00y"), ErrTypeMismatch},
+		{"image/jpeg", []byte("\xFF\xD8\xFF\xE0garbage"), errMalformed},
+	}
+	for _, c := range cases {
+		if _, err := Process("x", c.declared, c.data); err != c.err {
+			t.Errorf("Process(%q) err = %v, want %v", c.data[:4], err, c.err)
+		}
+	}
+}
+
+func testStorage(t *testing.T, storage Storage, fetch func(url string) []byte) {
+	key := "ab/abcdef.png"
+	if err := storage.Put(key, []byte("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := storage.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "image" {
+		t.Errorf("Open = %q", data)
+	}
+	if got := fetch(storage.URL(key)); string(got) != "image" {
+		t.Errorf("GET %s = %q", storage.URL(key), got)
+	}
+	if err := storage.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Open(key); err != ErrNotFound {
+		t.Errorf("Open after Delete err = %v", err)
+	}
+	if err := storage.Delete(key); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage := NewLocal(dir, "/media/")
+	testStorage(t, storage, func(url string) []byte {
+		data, _ := ioutil.ReadFile(dir + strings.TrimPrefix(url, "/media"))
+		return data
+	})
+	// key 不能跳出存储目录
+	if path := storage.path("../../etc/passwd"); !strings.HasPrefix(path, dir) {
+		t.Errorf("path escaped the storage dir: %s", path)
+	}
+}
+
+func TestS3(t *testing.T) {
+	server := httptest.NewServer(NewS3StandIn("us-east-1", "minio", "minio-secret"))
+	defer server.Close()
+	storage := NewS3(server.URL, "blog", "us-east-1", "minio", "minio-secret", "")
+	testStorage(t, storage, func(url string) []byte {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return data
+	})
+
+	// 签名错误的写入会被拒绝
+	wrong := NewS3(server.URL, "blog", "us-east-1", "minio", "wrong", "")
+	if err := wrong.Put("a.png", []byte("x"), "image/png"); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret err = %v", err)
+	}
+	resp, err := http.Post(server.URL+"/blog/a.png", "image/png", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned write status = %d", resp.StatusCode)
+	}
+}
+
+func TestResizer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage := NewLocal(dir+"/files", "/uploads")
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// 方向为 6 的照片缩小后应转正
+	data = append(append(append([]byte(nil), data[:2]...), orientationExif(6)...), data[2:]...)
+	if err := storage.Put("ab/photo.jpg", data, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	resizer := NewResizer(storage, dir+"/cache", "/media/resize/", "secret", []int{640, 320, 1280}, 80)
+
+	srcset := resizer.Srcset("ab/photo.jpg", 800)
+	if strings.Contains(srcset, "1280w") || !strings.HasPrefix(srcset, "/media/resize/320/ab/photo.jpg?s=") || !strings.Contains(srcset, " 640w") {
+		t.Errorf("Srcset = %q", srcset)
+	}
+	sig := resizer.sign("ab/photo.jpg", 320)
+	for _, c := range []struct {
+		width int
+		sig   string
+	}{{320, "forged"}, {321, sig}, {640, sig}} {
+		if _, err := resizer.Derivative("ab/photo.jpg", c.width, c.sig); err != ErrInvalidSignature {
+			t.Errorf("Derivative(%d, %q) err = %v", c.width, c.sig, err)
+		}
+	}
+	name, err := resizer.Derivative("ab/photo.jpg", 320, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(f)
+	f.Close()
+	if err != nil || config.Width != 320 || config.Height != 640 {
+		t.Errorf("derivative is %dx%d, err %v", config.Width, config.Height, err)
+	}
+	// 第二次直接使用缓存
+	if again, err := resizer.Derivative("ab/photo.jpg", 320, sig); err != nil || again != name {
+		t.Errorf("cached derivative %q, %v", again, err)
+	}
+	fingerprint := resizer.Fingerprint()
+	if strings.Contains(fingerprint, "secret") {
+		t.Errorf("Fingerprint exposes the secret: %q", fingerprint)
+	}
+	for _, other := range []*Resizer{
+		NewResizer(storage, dir+"/cache", "/media/resize", "other", []int{320, 640, 1280}, 80),
+		NewResizer(storage, dir+"/cache", "/media/resize", "secret", []int{320, 640}, 80),
+		NewResizer(storage, dir+"/cache", "/media/resize", "secret", []int{320, 640, 1280}, 90),
+		NewResizer(storage, dir+"/cache", "/media/small", "secret", []int{320, 640, 1280}, 80),
+	} {
+		if other.Fingerprint() == fingerprint {
+			t.Errorf("Fingerprint unchanged for %s", other.Fingerprint())
+		}
+	}
+	if err := resizer.Purge("ab/photo.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("derivative was not purged: %v", err)
+	}
+}
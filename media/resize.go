@@ -0,0 +1,249 @@
+package media
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// maxPixels 允许缩放的最大像素数，避免解码超大图片耗尽内存
+const maxPixels = 50 * 1000 * 1000
+
+var ErrInvalidSignature = errors.New("media: invalid derivative signature")
+
+// Resizer 按预设宽度生成图片的缩小版本并缓存在本地目录；地址带有签名，
+// 只有服务端生成的地址才能触发缩放，不能任意指定尺寸消耗 CPU
+type Resizer struct {
+	Storage  Storage
+	CacheDir string
+	BaseURL  string // 缩放图片的路由前缀，例如 /media/resize
+	Widths   []int  // 从小到大的预设宽度
+	Quality  int    // JPEG 质量
+	secret   []byte
+
+	mu      sync.Mutex
+	pending map[string]*sync.WaitGroup
+}
+
+func NewResizer(storage Storage, cacheDir, baseURL, secret string, widths []int, quality int) *Resizer {
+	widths = append([]int(nil), widths...)
+	sort.Ints(widths)
+	if quality <= 0 || quality > 100 {
+		quality = jpeg.DefaultQuality
+	}
+	return &Resizer{
+		Storage:  storage,
+		CacheDir: cacheDir,
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		Widths:   widths,
+		Quality:  quality,
+		secret:   []byte(secret),
+		pending:  make(map[string]*sync.WaitGroup),
+	}
+}
+
+// Resizable 是否为可以缩放的图片类型，GIF 可能是动图，不生成缩小版本
+func Resizable(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png" || contentType == "image/webp"
+}
+
+func (r *Resizer) sign(key string, width int) string {
+	mac := hmac.New(sha256.New, r.secret)
+	mac.Write([]byte(strconv.Itoa(width) + "/" + key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Fingerprint 影响生成地址的配置摘要：地址前缀、预设宽度、质量和密钥的哈希，
+// 配置变化时用来使缓存的渲染结果失效；不包含密钥本身
+func (r *Resizer) Fingerprint() string {
+	secret := sha256.Sum256(r.secret)
+	return fmt.Sprintf("%s|%s|%v|%d|%x", r.BaseURL, r.Storage.URL(""), r.Widths, r.Quality, secret[:8])
+}
+
+// URL 宽度为 width 的缩小版本的签名地址
+func (r *Resizer) URL(key string, width int) string {
+	return r.BaseURL + "/" + strconv.Itoa(width) + "/" + key + "?s=" + r.sign(key, width)
+}
+
+// Srcset 原图宽度为 original 时的 srcset，只包含小于原图的预设宽度，没有时返回空字符串
+func (r *Resizer) Srcset(key string, original int) string {
+	var items []string
+	for _, width := range r.Widths {
+		if width >= original {
+			break
+		}
+		items = append(items, r.URL(key, width)+" "+strconv.Itoa(width)+"w")
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return strings.Join(items, ", ")
+}
+
+func (r *Resizer) isPreset(width int) bool {
+	for _, w := range r.Widths {
+		if w == width {
+			return true
+		}
+	}
+	return false
+}
+
+// Derivative 校验签名并返回缩小版本在缓存目录中的路径，不存在时先生成
+func (r *Resizer) Derivative(key string, width int, signature string) (string, error) {
+	if !r.isPreset(width) || !hmac.Equal([]byte(signature), []byte(r.sign(key, width))) {
+		return "", ErrInvalidSignature
+	}
+	name, ext := r.cachePath(key, width)
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+
+	// 同一个文件同时只生成一次，其他请求等待结果
+	r.mu.Lock()
+	if wg, ok := r.pending[name]; ok {
+		r.mu.Unlock()
+		wg.Wait()
+		if _, err := os.Stat(name); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	r.pending[name] = wg
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, name)
+		r.mu.Unlock()
+		wg.Done()
+	}()
+
+	data, err := r.resize(key, width, ext)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(name, data); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// cachePath 缩小版本在缓存目录中的路径和扩展名
+func (r *Resizer) cachePath(key string, width int) (string, string) {
+	ext := path.Ext(key)
+	if ext == ".webp" { // 没有纯 Go 的 WebP 编码器，改存为 PNG
+		ext = ".png"
+	}
+	name := path.Clean("/" + strings.TrimSuffix(key, path.Ext(key)) + ext)
+	return filepath.Join(r.CacheDir, strconv.Itoa(width), filepath.FromSlash(name)), ext
+}
+
+// Purge 删除文件的全部缩小版本
+func (r *Resizer) Purge(key string) error {
+	for _, width := range r.Widths {
+		name, _ := r.cachePath(key, width)
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Resizer) resize(key string, width int, ext string) ([]byte, error) {
+	f, err := r.Storage.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	original, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(original))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrUnsupportedType
+	}
+	src, format, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, ErrUnsupportedType
+	}
+	if format == "jpeg" { // 缩小后的图片不带 EXIF，先按原图记录的方向转正
+		src = orient(src, jpegOrientation(original))
+	}
+	bounds := src.Bounds()
+	if width > bounds.Dx() { // 不放大
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if ext == ".png" {
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: r.Quality})
+	}
+	return buf.Bytes(), err
+}
+
+// orient 按 EXIF Orientation（2～8）翻转或旋转图片
+func orient(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 { // 5～8 需要交换宽高
+		w, h = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = w-1-y, x
+			case 7:
+				dx, dy = w-1-y, h-1-x
+			case 8:
+				dx, dy = y, h-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
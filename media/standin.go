@@ -0,0 +1,135 @@
+package media
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type standInObject struct {
+	data        []byte
+	contentType string
+}
+
+// s3StandIn 在内存中实现 S3 对象的 PUT、GET、HEAD、DELETE，行为与设置为公开读的 MinIO 存储桶一致：
+// 读取可以不签名，写入和删除必须带有正确的 Signature V4 签名
+type s3StandIn struct {
+	signer  signer
+	mu      sync.RWMutex
+	objects map[string]standInObject
+}
+
+// NewS3StandIn 返回本地的 S3 替身服务，便于调试和测试 S3 存储
+func NewS3StandIn(region, accessKey, secretKey string) http.Handler {
+	return &s3StandIn{
+		signer:  signer{accessKey: accessKey, secretKey: secretKey, region: region},
+		objects: make(map[string]standInObject),
+	}
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if i := strings.Index(path, "/"); i <= 0 || i == len(path)-1 {
+		s3Error(w, http.StatusBadRequest, "InvalidRequest", "path must be /bucket/key")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	public := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if r.Header.Get("Authorization") != "" || !public {
+		if code, msg := s.verify(r, body); code != "" {
+			s3Error(w, http.StatusForbidden, code, msg)
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodPut:
+		s.mu.Lock()
+		s.objects[path] = standInObject{data: body, contentType: r.Header.Get("Content-Type")}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		s.mu.RLock()
+		object, ok := s.objects[path]
+		s.mu.RUnlock()
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object.data)
+		}
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, path)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+// verify 校验签名，失败时返回 S3 的错误码
+func (s *s3StandIn) verify(r *http.Request, body []byte) (string, string) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, signAlgorithm+" ") {
+		return "AccessDenied", "missing Signature V4 authorization"
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, signAlgorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	credential := strings.SplitN(fields["Credential"], "/", 2)
+	if len(credential) != 2 || credential[0] != s.signer.accessKey {
+		return "InvalidAccessKeyId", "unknown access key"
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		return "AccessDenied", "invalid X-Amz-Date"
+	}
+	if skew := time.Since(signedAt); skew > maxClockSkew || skew < -maxClockSkew {
+		return "RequestTimeTooSkewed", "request time too skewed"
+	}
+	if credential[1] != s.signer.scope(amzDate[:8]) {
+		return "AuthorizationHeaderMalformed", "invalid credential scope"
+	}
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return "XAmzContentSHA256Mismatch", "payload hash does not match"
+	}
+	if !strings.Contains(";"+fields["SignedHeaders"]+";", ";host;") {
+		return "AccessDenied", "host must be signed"
+	}
+	expected := s.signer.signature(r, fields["SignedHeaders"], amzDate)
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return "SignatureDoesNotMatch", "signature does not match"
+	}
+	return "", ""
+}
+
+func s3Error(w http.ResponseWriter, status int, code, message string) {
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>" + code + "</Code><Message>")
+	_ = xml.EscapeText(&b, []byte(message))
+	b.WriteString("</Message></Error>")
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(b.Bytes())
+}
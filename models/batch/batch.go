@@ -0,0 +1,53 @@
+// Package batch 用一次查询取出一组文章的标签和作者，避免在列表中逐篇查询
+package batch
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// TagRow 文章的一个标签
+type TagRow struct {
+	PostID uint64
+	ID     uint64
+	Name   string
+}
+
+// Unique 去掉重复的和为 0 的 ID，保持原有顺序
+func Unique(ids []uint64) []uint64 {
+	seen := make(map[uint64]bool, len(ids))
+	out := make([]uint64, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Tags 查询 postIDs 的全部标签并按文章分组，组内按标签 ID 排序
+func Tags(db *gorm.DB, postIDs []uint64) (map[uint64][]TagRow, error) {
+	byPost := make(map[uint64][]TagRow)
+	postIDs = Unique(postIDs)
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+	var rows []TagRow
+	err := db.Raw("select pt.post_id, t.id, t.name from post_tags pt inner join tags t on t.id = pt.tag_id where pt.post_id in (?) and t.deleted_at is null order by pt.post_id, t.id", postIDs).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		byPost[row.PostID] = append(byPost[row.PostID], row)
+	}
+	return byPost, nil
+}
+
+// ByID 按主键查询 ids 对应的记录，dest 与 db.Find 的参数相同
+func ByID(db *gorm.DB, dest interface{}, ids []uint64) error {
+	ids = Unique(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Where("id in (?)", ids).Find(dest).Error
+}
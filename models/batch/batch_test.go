@@ -0,0 +1,132 @@
+package batch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// batch 不能依赖 models，这里只建测试需要的列
+type user struct {
+	ID   uint64
+	Name string
+}
+
+type tag struct {
+	ID        uint64
+	Name      string
+	DeletedAt *time.Time
+}
+
+type postTag struct {
+	PostID uint64
+	TagID  uint64
+}
+
+// queryCounter 统计 gorm 执行的 SQL 语句
+type queryCounter struct {
+	queries []string
+}
+
+func (q *queryCounter) Print(v ...interface{}) {
+	if len(v) > 3 && v[0] == "sql" {
+		if sql, ok := v[3].(string); ok {
+			q.queries = append(q.queries, sql)
+		}
+	}
+}
+
+func openTestDB(t *testing.T) (*gorm.DB, func()) {
+	dir, err := ioutil.TempDir("", "lyanna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&user{}, &tag{}, &postTag{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	if got := Unique([]uint64{3, 0, 1, 3, 2, 1}); !reflect.DeepEqual(got, []uint64{3, 1, 2}) {
+		t.Errorf("Unique = %v", got)
+	}
+}
+
+// TestPageQueries 一页文章无论多少篇，标签和作者各只查询一次
+func TestPageQueries(t *testing.T) {
+	db, closeDB := openTestDB(t)
+	defer closeDB()
+	deleted := time.Now()
+	rows := []interface{}{
+		&user{ID: 7, Name: "alice"}, &user{ID: 8, Name: "bob"}, &user{ID: 9, Name: "carol"},
+		&tag{ID: 1, Name: "go"}, &tag{ID: 2, Name: "gin"}, &tag{ID: 3, Name: "old", DeletedAt: &deleted},
+		&postTag{PostID: 1, TagID: 2}, &postTag{PostID: 1, TagID: 1}, &postTag{PostID: 3, TagID: 1},
+		&postTag{PostID: 3, TagID: 3}, &postTag{PostID: 20, TagID: 1},
+	}
+	for _, v := range rows {
+		if err := db.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var postIDs, authorIDs []uint64
+	for id := uint64(1); id <= 10; id++ {
+		postIDs = append(postIDs, id)
+		authorIDs = append(authorIDs, 7+id%2)
+	}
+
+	counter := &queryCounter{}
+	db.SetLogger(counter)
+	db.LogMode(true)
+	tags, err := Tags(db, postIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []user
+	if err := ByID(db, &users, authorIDs); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(counter.queries); n != 2 {
+		t.Fatalf("a page of 10 posts made %d queries, want 2: %q", n, counter.queries)
+	}
+	// 已删除的标签和不在本页的文章都不返回
+	want := map[uint64][]TagRow{
+		1: {{1, 1, "go"}, {1, 2, "gin"}},
+		3: {{3, 1, "go"}},
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Tags = %v, want %v", tags, want)
+	}
+	if !reflect.DeepEqual(users, []user{{7, "alice"}, {8, "bob"}}) {
+		t.Errorf("users = %v", users)
+	}
+	if !strings.Contains(counter.queries[1], "id in (?,?)") {
+		t.Errorf("author IDs should be deduplicated: %s", counter.queries[1])
+	}
+
+	// 空页面不查询数据库
+	counter.queries = nil
+	if _, err := Tags(db, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ByID(db, &users, []uint64{0}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(counter.queries); n != 0 {
+		t.Errorf("empty page made %d queries: %q", n, counter.queries)
+	}
+}
@@ -1,19 +1,171 @@
 package models
 
 import (
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
 	"html/template"
+	"lyanna/render"
+	"sort"
+	"time"
 )
 
 var RedisCommentKey string = "comments/%d/props/content"
 
+// MaxCommentDepth 评论树最大嵌套层数，更深的回复会挂到该层的祖先下
+const MaxCommentDepth = 3
+
+// 评论审核状态
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentSpam     = "spam"
+	CommentDeleted  = "deleted"
+)
+
+var CommentStatuses = []string{CommentPending, CommentApproved, CommentSpam, CommentDeleted}
+
+// 评论作为垃圾评论检测器训练样本时的类别
+const (
+	TrainedHam  = "ham"
+	TrainedSpam = "spam"
+)
+
+// 评论审核策略，对应配置 comment.moderation
+const (
+	ModerationNone  = "none"  // 全部直接通过
+	ModerationFirst = "first" // 首次评论的 GitHub 用户需要审核
+	ModerationAll   = "all"   // 全部需要审核
+)
+
 type Comment struct {
 	BaseModel
 	GitHubID int64
 	PostID int64
 	Content string `gorm:"type:longtext"`
-	RefID int64
+	RefID int64 `gorm:"index"`
+	Status string `gorm:"type:varchar(16);default:'approved';index"`
+	Trained string `gorm:"type:varchar(8)"` // 训练垃圾评论检测器时使用的类别：空 / ham / spam
+	TrainedSample string `gorm:"type:text"` // 训练时提交的内容（JSON），改判时按原样撤销
+	DeletedAt *time.Time `sql:"index"` // 不为空时在回收站中
+	Replies []*Comment `gorm:"-"`
+	Depth int `gorm:"-"`
+}
+
+func IsCommentStatus(status string) bool {
+	for _, s := range CommentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (comment *Comment) Pending() bool {
+	return comment.Status == CommentPending
+}
+
+func (comment *Comment) Approved() bool {
+	return comment.Status == CommentApproved
+}
+
+// ModerateComment 根据审核策略决定新评论的状态
+func ModerateComment(comment *Comment) {
+	switch Conf.Comment.Moderation {
+	case ModerationAll:
+		comment.Status = CommentPending
+	case ModerationNone:
+		comment.Status = CommentApproved
+	default:
+		// 已有通过审核评论的 GitHub 用户视为老用户，自动通过
+		var count int
+		DB.Model(&Comment{}).Where(&Comment{GitHubID: comment.GitHubID, Status: CommentApproved}).Count(&count)
+		if count > 0 {
+			comment.Status = CommentApproved
+		} else {
+			comment.Status = CommentPending
+		}
+	}
+}
+
+// Post 评论所属的文章，文章不存在时返回 nil
+func (comment *Comment) Post() *Post {
+	post, err := GetPostByID(comment.PostID)
+	if err != nil {
+		return nil
+	}
+	return post
+}
+
+func ListCommentsByStatus(status string, offset, limit int) ([]*Comment, error) {
+	var comments []*Comment
+	err := DB.Where("status = ?", status).Order("id desc").Offset(offset).Limit(limit).Find(&comments).Error
+	return comments, err
+}
+
+// CountCommentsGroupByStatus 返回各状态的评论数量
+func CountCommentsGroupByStatus() (map[string]int, error) {
+	counts := make(map[string]int)
+	rows, err := DB.Model(&Comment{}).Select("status, count(*)").Group("status").Rows()
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return counts, err
+		}
+		counts[status] = count
+	}
+	return counts, nil
+}
+
+// CommentFilter 评论列表的筛选条件，零值表示不筛选该项
+type CommentFilter struct {
+	PostID   uint64
+	GitHubID int64
+	Status   string
+}
+
+// ListCommentsByFilter 按条件分页查询评论，同时返回符合条件的评论总数
+func ListCommentsByFilter(filter CommentFilter, offset, limit int) ([]*Comment, int, error) {
+	var (
+		comments []*Comment
+		total    int
+	)
+	query := DB.Model(&Comment{}).Where(&Comment{PostID: int64(filter.PostID), GitHubID: filter.GitHubID, Status: filter.Status})
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id desc").Offset(offset).Limit(limit).Find(&comments).Error
+	return comments, total, err
+}
+
+// Delete 把评论移到回收站，回复的 RefID 保持不变，组装评论树时会作为顶层评论显示
+func (comment *Comment) Delete() error {
+	return DB.Delete(comment).Error
+}
+
+// DeleteComments 把一组评论移到回收站
+func DeleteComments(ids []uint64) error {
+	return DB.Where("id in (?)", ids).Delete(&Comment{}).Error
+}
+
+func ListCommentsByIDs(ids []uint64) ([]*Comment, error) {
+	var comments []*Comment
+	err := DB.Where("id in (?)", ids).Find(&comments).Error
+	return comments, err
+}
+
+func UpdateCommentsStatus(ids []uint64, status string) error {
+	return DB.Model(&Comment{}).Where("id in (?)", ids).Update("status", status).Error
+}
+
+// SetCommentTrained 记录评论训练垃圾评论检测器时使用的类别和内容，改判时据此撤销之前的训练
+func SetCommentTrained(id uint64, class, sample string) error {
+	return DB.Model(&Comment{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"trained":        class,
+		"trained_sample": sample,
+	}).Error
 }
 
 func (comment *Comment) Insert()error{
@@ -23,20 +175,143 @@ func (comment *Comment) Insert()error{
 
 func ListCommentsByPostID(postid int)([]*Comment, error){
 	var comments []*Comment
-	err := DB.Model(&Comment{}).Order("id desc").Find(&comments,"post_id=?",postid).Error
+	err := DB.Model(&Comment{}).Order("id desc").Find(&comments,"post_id=? and status=?",postid,CommentApproved).Error
 	return comments,err
 }
 
+func GetCommentByID(id interface{}) (*Comment, error) {
+	var comment Comment
+	err := DB.First(&comment, id).Error
+	return &comment, err
+}
+
+// ListCommentTreeByPostID 返回文章的顶层评论，回复挂在 Replies 中
+func ListCommentTreeByPostID(postid int) ([]*Comment, error) {
+	comments, err := ListCommentsByPostID(postid)
+	if err != nil {
+		return nil, err
+	}
+	return BuildCommentTree(comments, MaxCommentDepth), nil
+}
+
+// CommentPage 文章的一页评论
+type CommentPage struct {
+	Roots   []*Comment // 本页的顶层评论，回复挂在 Replies 中
+	Threads int        // 顶层评论总数
+	Total   int        // 已通过审核的评论总数
+}
+
+// ListCommentPageByPostID 按顶层评论分页查询文章已通过审核的评论，回复跟随所属的顶层评论；
+// 与 BuildCommentTree 一致，父评论不在已通过审核评论中的回复也算作顶层评论
+func ListCommentPageByPostID(postid, offset, limit int) (*CommentPage, error) {
+	page := &CommentPage{}
+	approved := DB.Model(&Comment{}).Where("post_id = ? and status = ?", postid, CommentApproved)
+	if err := approved.Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+	roots := approved.Where("ref_id = 0 or ref_id not in (select id from comments where post_id = ? and status = ? and deleted_at is null)", postid, CommentApproved)
+	if err := roots.Count(&page.Threads).Error; err != nil {
+		return nil, err
+	}
+	var comments []*Comment
+	if err := roots.Order("id desc").Offset(offset).Limit(limit).Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	// 逐层加载回复
+	seen := make(map[uint64]bool, len(comments))
+	var parents []uint64
+	for _, comment := range comments {
+		seen[comment.ID] = true
+		parents = append(parents, comment.ID)
+	}
+	for len(parents) > 0 {
+		var replies []*Comment
+		if err := approved.Where("ref_id in (?)", parents).Find(&replies).Error; err != nil {
+			return nil, err
+		}
+		parents = parents[:0]
+		for _, reply := range replies {
+			if !seen[reply.ID] {
+				seen[reply.ID] = true
+				parents = append(parents, reply.ID)
+				comments = append(comments, reply)
+			}
+		}
+	}
+	page.Roots = BuildCommentTree(comments, MaxCommentDepth)
+	return page, nil
+}
+
+// BuildCommentTree 按 RefID 把评论组装成树，顶层评论保持传入的顺序，回复按时间正序；
+// 父评论不存在的回复视为顶层评论，超过 maxDepth 的回复挂到第 maxDepth-1 层的祖先下
+func BuildCommentTree(comments []*Comment, maxDepth int) []*Comment {
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+	byID := make(map[int64]*Comment, len(comments))
+	for _, comment := range comments {
+		comment.Replies = nil
+		comment.Depth = 0
+		byID[int64(comment.ID)] = comment
+	}
+	var roots []*Comment
+	for _, comment := range comments {
+		chain := commentAncestors(comment, byID)
+		if len(chain) == 0 {
+			roots = append(roots, comment)
+			continue
+		}
+		parent := chain[0]
+		if len(chain) > maxDepth {
+			parent = chain[len(chain)-maxDepth]
+		}
+		parent.Replies = append(parent.Replies, comment)
+	}
+	var setDepth func(list []*Comment, depth int)
+	setDepth = func(list []*Comment, depth int) {
+		for _, comment := range list {
+			comment.Depth = depth
+			sort.Slice(comment.Replies, func(i, j int) bool {
+				return comment.Replies[i].ID < comment.Replies[j].ID
+			})
+			setDepth(comment.Replies, depth+1)
+		}
+	}
+	setDepth(roots, 0)
+	return roots
+}
+
+// commentAncestors 返回从直接父评论到顶层评论的祖先链
+func commentAncestors(comment *Comment, byID map[int64]*Comment) []*Comment {
+	var chain []*Comment
+	current := comment
+	for len(chain) <= len(byID) {
+		parent, ok := byID[current.RefID]
+		if current.RefID == 0 || !ok || parent == comment {
+			break
+		}
+		chain = append(chain, parent)
+		current = parent
+	}
+	return chain
+}
+
+// CountThread 统计评论及其所有回复的数量
+func (comment *Comment) CountThread() int {
+	count := 1
+	for _, reply := range comment.Replies {
+		count += reply.CountThread()
+	}
+	return count
+}
+
 func (comment *Comment) GitUser() *GitHubUser{
 	gitUser,_ := GetGitUserByGid(comment.GitHubID)
 	return gitUser
 }
 
 func (comment *Comment) CommentHTML() template.HTML {
-	policy := bluemonday.UGCPolicy()
-	unsafe := blackfriday.MarkdownCommon([]byte(comment.Content))
-	contentHtml:=template.HTML(string(policy.SanitizeBytes(unsafe)))
-	return contentHtml
+	return render.Comment.HTML(comment.Content)
 }
 
 func (comment *Comment) GetComment(commentID interface{})string {
@@ -45,7 +320,6 @@ func (comment *Comment) GetComment(commentID interface{})string {
 }
 
 func CommentCreatAndGetID(comment *Comment)error {
-	err := DB.Create(comment).Row().Scan(comment)
-	return err
+	return DB.Create(comment).Error
 }
 
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// commentTree 把评论树写成 "1(2 3) 4" 的形式，并检查每条评论的 Depth
+func commentTree(t *testing.T, list []*Comment, depth int) string {
+	parts := make([]string, 0, len(list))
+	for _, comment := range list {
+		if comment.Depth != depth {
+			t.Errorf("comment %d depth = %d, want %d", comment.ID, comment.Depth, depth)
+		}
+		s := fmt.Sprint(comment.ID)
+		if len(comment.Replies) > 0 {
+			s += "(" + commentTree(t, comment.Replies, depth+1) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildCommentTree(t *testing.T) {
+	cases := []struct {
+		name     string
+		refs     [][2]int64 // 按传入顺序的 {ID, RefID}
+		maxDepth int
+		want     string
+	}{
+		{"top level keeps input order", [][2]int64{{3, 0}, {1, 0}, {2, 0}}, MaxCommentDepth, "3 1 2"},
+		{"replies in id order", [][2]int64{{1, 0}, {5, 1}, {3, 1}, {4, 3}, {2, 0}}, MaxCommentDepth, "1(3(4) 5) 2"},
+		{"orphan reply becomes top level", [][2]int64{{2, 99}, {1, 0}, {3, 2}}, MaxCommentDepth, "2(3) 1"},
+		{"deep replies clamped to max depth", [][2]int64{{1, 0}, {2, 1}, {3, 2}, {4, 3}, {5, 4}, {6, 5}}, MaxCommentDepth, "1(2(3(4 5 6)))"},
+		{"max depth one", [][2]int64{{1, 0}, {2, 1}, {3, 2}, {4, 3}}, 1, "1(2 3 4)"},
+		{"max depth below one", [][2]int64{{1, 0}, {2, 1}, {3, 2}}, 0, "1(2 3)"},
+		{"clamped replies sorted with siblings", [][2]int64{{1, 0}, {2, 1}, {5, 4}, {3, 2}, {4, 3}, {6, 3}}, MaxCommentDepth, "1(2(3(4 5 6)))"},
+	}
+	for _, c := range cases {
+		comments := make([]*Comment, 0, len(c.refs))
+		for _, ref := range c.refs {
+			comment := &Comment{RefID: ref[1]}
+			comment.ID = uint64(ref[0])
+			comments = append(comments, comment)
+		}
+		roots := BuildCommentTree(comments, c.maxDepth)
+		if got := commentTree(t, roots, 0); got != c.want {
+			t.Errorf("%s: tree = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// TestBuildCommentTreeRebuild 同一批评论再次组装时不保留上一次的回复
+func TestBuildCommentTreeRebuild(t *testing.T) {
+	root := &Comment{}
+	root.ID = 1
+	reply := &Comment{RefID: 1}
+	reply.ID = 2
+	BuildCommentTree([]*Comment{root, reply}, MaxCommentDepth)
+	roots := BuildCommentTree([]*Comment{root, reply}, MaxCommentDepth)
+	if got := commentTree(t, roots, 0); got != "1(2)" {
+		t.Errorf("tree = %q, want %q", got, "1(2)")
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"lyanna/media"
+	"lyanna/models/batch"
+	"path"
+	"strings"
+)
+
+var (
+	// MediaStorage 媒体文件的存储后端，启动时按配置设置
+	MediaStorage media.Storage
+	// MediaResizer 生成图片的缩小版本，未设置时不使用 srcset 和缩略图
+	MediaResizer *media.Resizer
+)
+
+// Media 媒体库中的一个文件，相同内容（按处理后的哈希）只保存一份
+type Media struct {
+	BaseModel
+	Hash        string `gorm:"type:char(64);unique_index"`
+	StorageKey  string `gorm:"size:128;index"`
+	Name        string `gorm:"size:255"` // 上传时的文件名
+	ContentType string `gorm:"size:64"`
+	Size        int64
+	Width       int
+	Height      int
+	UploaderID  uint64 `gorm:"index"`
+	Uploader    *User  `gorm:"-"`
+}
+
+func (m *Media) URL() string {
+	return MediaStorage.URL(m.StorageKey)
+}
+
+func (m *Media) IsImage() bool {
+	return strings.HasPrefix(m.ContentType, "image/")
+}
+
+// Resizable 是否可以生成缩小版本
+func (m *Media) Resizable() bool {
+	return MediaResizer != nil && media.Resizable(m.ContentType)
+}
+
+// ThumbURL 媒体库中显示的缩略图地址，使用最小的预设宽度
+func (m *Media) ThumbURL() string {
+	if !m.Resizable() || len(MediaResizer.Widths) == 0 || m.Width <= MediaResizer.Widths[0] {
+		return m.URL()
+	}
+	return MediaResizer.URL(m.StorageKey, MediaResizer.Widths[0])
+}
+
+// Markdown 插入文章的 Markdown 片段，图片为 ![名称](地址)，其他文件为链接
+func (m *Media) Markdown() string {
+	name := strings.TrimSuffix(m.Name, path.Ext(m.Name))
+	if name == "" {
+		name = m.Hash[:8]
+	}
+	name = markdownEscaper.Replace(name)
+	if m.IsImage() {
+		return "![" + name + "](" + m.URL() + ")"
+	}
+	return "[" + name + "](" + m.URL() + ")"
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, "\n", " ", "\r", " ")
+
+func GetMediaByHash(hash string) (*Media, error) {
+	var m Media
+	err := DB.First(&m, "hash = ?", hash).Error
+	return &m, err
+}
+
+// MediaSrcset 文章中图片地址对应的 srcset，不是媒体库中可缩放的图片时返回空字符串
+func MediaSrcset(src string) string {
+	if MediaResizer == nil {
+		return ""
+	}
+	prefix := MediaStorage.URL("")
+	if !strings.HasPrefix(src, prefix) {
+		return ""
+	}
+	var m Media
+	if err := DB.First(&m, "storage_key = ?", strings.TrimPrefix(src, prefix)).Error; err != nil || !m.Resizable() {
+		return ""
+	}
+	return MediaResizer.Srcset(m.StorageKey, m.Width)
+}
+
+func GetMediaByID(id interface{}) (*Media, error) {
+	var m Media
+	err := DB.First(&m, id).Error
+	return &m, err
+}
+
+// SaveMedia 保存处理后的文件，内容已存在时直接返回已有的记录，第二个返回值表示是否为重复文件
+func SaveMedia(file *media.File, uploaderID uint64) (*Media, bool, error) {
+	if m, err := GetMediaByHash(file.Hash); err == nil {
+		return m, true, nil
+	}
+	if err := MediaStorage.Put(file.Key(), file.Data, file.ContentType); err != nil {
+		return nil, false, err
+	}
+	m := &Media{
+		Hash:        file.Hash,
+		StorageKey:  file.Key(),
+		Name:        file.Name,
+		ContentType: file.ContentType,
+		Size:        int64(len(file.Data)),
+		Width:       file.Width,
+		Height:      file.Height,
+		UploaderID:  uploaderID,
+	}
+	if err := DB.Create(m).Error; err != nil {
+		// 同时上传了相同的文件，唯一索引冲突时使用先保存的记录
+		if existing, e := GetMediaByHash(file.Hash); e == nil {
+			return existing, true, nil
+		}
+		return nil, false, err
+	}
+	return m, false, nil
+}
+
+// ListMedia 按上传时间倒序分页列出媒体文件，并填充上传者
+func ListMedia(offset, limit int) ([]*Media, int, error) {
+	var (
+		items []*Media
+		total int
+	)
+	if err := DB.Model(&Media{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := DB.Order("id desc").Offset(offset).Limit(limit).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	uploaderIDs := make([]uint64, 0, len(items))
+	for _, m := range items {
+		uploaderIDs = append(uploaderIDs, m.UploaderID)
+	}
+	var users []*User
+	if err := batch.ByID(DB, &users, uploaderIDs); err != nil {
+		return nil, 0, err
+	}
+	usersByID := make(map[uint64]*User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	for _, m := range items {
+		m.Uploader = usersByID[m.UploaderID]
+	}
+	return items, total, nil
+}
+
+// Delete 删除记录和存储中的文件及其缩小版本，已经引用该文件的文章会显示为失效链接
+func (m *Media) Delete() error {
+	if err := DB.Delete(m).Error; err != nil {
+		return err
+	}
+	if MediaResizer != nil {
+		if err := MediaResizer.Purge(m.StorageKey); err != nil {
+			return err
+		}
+	}
+	return MediaStorage.Delete(m.StorageKey)
+}
@@ -3,9 +3,12 @@ package models
 import (
 	"database/sql"
 	"fmt"
-	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
 	"html/template"
+	"lyanna/models/batch"
+	"lyanna/permalink"
+	"lyanna/render"
 	"strconv"
 	"time"
 )
@@ -22,12 +25,23 @@ type Post struct {
 	Content string `gorm:"type:longtext"`
 	CanComment bool
 	Published bool
+	PublishAt *time.Time `gorm:"index"`
+	UnpublishAt *time.Time `gorm:"index"`
+	DeletedAt *time.Time `sql:"index"` // 不为空时在回收站中
 	Tags []*Tag `gorm:"-"`
 }
 
+// Url 按 PostPermalink 生成文章链接，还没有 slug 的文章使用 /post/:id
 func (post *Post) Url() string{
-	url := fmt.Sprintf("/post/%d",post.ID)
-	return url
+	if post.Slug == "" && PostPermalink.UsesSlug() {
+		return fmt.Sprintf("/post/%d",post.ID)
+	}
+	return PostPermalink.Build(permalink.Fields{ID: post.ID, Slug: post.Slug, Time: post.CreatedAt})
+}
+
+// Scheduled 文章是否在等待定时发布
+func (post *Post) Scheduled() bool {
+	return !post.Published && post.PublishAt != nil
 }
 
 func (post *Post) GetTagsArray()[]string {
@@ -39,34 +53,122 @@ func (post *Post) GetTagsArray()[]string {
 }
 
 func(post *Post) Insert() error {
+	post.prepareSlug()
 	return 	DB.Create(post).Error
 }
 
+// Update 保存文章，slug 改变时记录旧 slug 以便旧链接跳转
 func (post *Post) Update() {
-	DB.Save(post)
+	var old Post
+	DB.Unscoped().Select("slug").First(&old, post.ID)
+	post.prepareSlug()
+	if DB.Save(post).Error == nil {
+		if err := post.recordOldSlug(old.Slug); err != nil {
+			Logger.Error("Failed to record old slug", zap.Error(err))
+		}
+		IndexPost(post)
+		DeleteContent(int(post.ID))
+	}
+}
+
+// Delete 把文章移到回收站，标签关联保留，恢复后原样显示
+func (post *Post) Delete() error {
+	if err := DB.Delete(post).Error; err != nil {
+		return err
+	}
+	SearchIndex.Remove(post.ID)
+	DeleteContent(int(post.ID))
+	return nil
 }
 
 func (post *Post) GetUserName(userID int)string {
+	// 已由 LoadPostRelations 填充作者时不再查询
+	if post.User.ID != 0 && post.User.ID == uint64(userID) {
+		return post.User.Name
+	}
 	Name, _ := post.User.GetUserName(userID)
 	return Name
 }
 
 func (post *Post) Excerpt() template.HTML {
-	//content :=GetContent(int(post.ID))
-	policy := bluemonday.StrictPolicy() //remove all html tags
-	sanitized := policy.Sanitize(string(blackfriday.MarkdownCommon([]byte(post.Content))))
-	runes := []rune(sanitized)
-	if len(runes) > 300 {
-		sanitized = string(runes[:300])
+	return render.Excerpt.HTML(post.Content)
+}
+
+// PostFilter 文章列表的筛选条件，零值表示不筛选该项
+type PostFilter struct {
+	TagID     uint64
+	AuthorID  uint64
+	Query     string // 标题或摘要包含的关键字
+	Published *bool
+}
+
+func (filter PostFilter) apply(db *gorm.DB) *gorm.DB {
+	if filter.TagID > 0 {
+		db = db.Where("id in (select post_id from post_tags where tag_id = ?)", filter.TagID)
+	}
+	if filter.AuthorID > 0 {
+		db = db.Where("author_id = ?", filter.AuthorID)
+	}
+	if filter.Query != "" {
+		like := "%" + filter.Query + "%"
+		db = db.Where("title like ? or summary like ?", like, like)
 	}
-	excerpt := template.HTML(sanitized + "...")
-	return excerpt
+	if filter.Published != nil {
+		db = db.Where("published = ?", *filter.Published)
+	}
+	return db
 }
 
-func ListPosts()([]*Post, error) {
-	var posts []*Post
-	err := DB.Order("id desc").Find(&posts).Error
-	return posts,err
+// ListPostsByFilter 按条件分页查询文章，同时返回符合条件的文章总数
+func ListPostsByFilter(filter PostFilter, offset, limit int) ([]*Post, int, error) {
+	var (
+		posts []*Post
+		total int
+	)
+	query := filter.apply(DB.Model(&Post{}))
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("created_at desc").Order("id desc").Offset(offset).Limit(limit).Find(&posts).Error
+	return posts, total, err
+}
+
+// LoadPostRelations 批量填充文章的标签和作者（Post.User），无论多少篇文章都只查询两次
+func LoadPostRelations(posts []*Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIDs := make([]uint64, 0, len(posts))
+	authorIDs := make([]uint64, 0, len(posts))
+	for _, post := range posts {
+		postIDs = append(postIDs, post.ID)
+		authorIDs = append(authorIDs, uint64(post.AuthorID))
+	}
+	tags, err := batch.Tags(DB, postIDs)
+	if err != nil {
+		return err
+	}
+	// 作者在回收站中时仍然显示作者名
+	var users []*User
+	if err := batch.ByID(DB.Unscoped(), &users, authorIDs); err != nil {
+		return err
+	}
+	usersByID := make(map[uint64]*User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+	for _, post := range posts {
+		post.Tags = make([]*Tag, 0, len(tags[post.ID]))
+		for _, row := range tags[post.ID] {
+			tag := &Tag{Name: row.Name}
+			tag.ID = row.ID
+			post.Tags = append(post.Tags, tag)
+		}
+		if user, ok := usersByID[uint64(post.AuthorID)]; ok {
+			post.User = *user
+		}
+	}
+	return nil
 }
 
 func GetPostByID(postID interface{})(*Post,error) {
@@ -106,9 +208,9 @@ func _listPost(tag string, published bool) ([]*Post, error){
 		}
 		var rows *sql.Rows
 		if published {
-			rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id=? and p.published = ? order by created_at desc",tagID,true).Rows()
+			rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id=? and p.published = ? and p.deleted_at is null order by created_at desc",tagID,true).Rows()
 		} else {
-			rows , err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id=pt.post_id where pt.tag_id=? order by created_at desc",tagID).Rows()
+			rows , err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id=pt.post_id where pt.tag_id=? and p.deleted_at is null order by created_at desc",tagID).Rows()
 		}
 		if err != nil {
 			return nil,err
@@ -140,15 +242,18 @@ func CountPostByTag(tag string)(count int, err error) {
 		if err != nil {
 			return
 		}
-		err = DB.Raw("select count(*) from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id=? and p.published=?",tagID,true).Row().Scan(&count)
+		err = DB.Raw("select count(*) from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id=? and p.published=? and p.deleted_at is null",tagID,true).Row().Scan(&count)
 	} else {
-		err = DB.Raw("select count(*) from posts p where p where p.published=?",true).Row().Scan(&count)
+		err = DB.Raw("select count(*) from posts p where p.published=? and p.deleted_at is null",true).Row().Scan(&count)
 	}
 	return
 }
 
 func PostCreatAndGetID(post *Post)error {
-	err := DB.Create(post).Row().Scan(post)
+	err := post.Insert()
+	if err == nil {
+		IndexPost(post)
+	}
 	return err
 }
 
@@ -160,7 +265,7 @@ type Archive struct {
 
 func ListPostArchives()([]*Archive, error) {
 	var archives []*Archive
-	rows, _ := DB.Raw("select DATE_FORMAT(created_at,'%Y') as year, count(*) as total from posts where published = ? group by year order by year desc",true).Rows()
+	rows, _ := DB.Raw("select DATE_FORMAT(created_at,'%Y') as year, count(*) as total from posts where published = ? and deleted_at is null group by year order by year desc",true).Rows()
 	defer rows.Close()
 	for rows.Next() {
 		var archive Archive
@@ -173,7 +278,7 @@ func ListPostArchives()([]*Archive, error) {
 
 func ListPostByArchive(year string)[]*Post {
 	//condition := fmt.Sprintf("%s",year)
-	rows, _ := DB.Raw("select * from posts where date_format(created_at,'%Y')=? and published = ? order by created_at desc",year,true).Rows()
+	rows, _ := DB.Raw("select * from posts where date_format(created_at,'%Y')=? and published = ? and deleted_at is null order by created_at desc",year,true).Rows()
 	defer rows.Close()
 	posts := make([]*Post,0)
 	for rows.Next() {
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"lyanna/permalink"
+)
+
+// PostPermalink 文章链接格式，由 main 按 permalink.pattern 配置设置
+var PostPermalink = permalink.MustParse(permalink.PostID)
+
+// PostSlug 文章用过的旧 slug，访问旧链接时 301 跳转到文章当前的链接
+type PostSlug struct {
+	BaseModel
+	PostID uint64 `gorm:"index"`
+	Slug   string `gorm:"unique_index"`
+}
+
+// slugTaken slug 是否已被其他文章使用，回收站中的文章和其他文章的旧 slug 也算在内
+func slugTaken(slug string, postID uint64) bool {
+	var count int
+	DB.Unscoped().Model(&Post{}).Where("slug = ? and id <> ?", slug, postID).Count(&count)
+	if count > 0 {
+		return true
+	}
+	DB.Model(&PostSlug{}).Where("slug = ? and post_id <> ?", slug, postID).Count(&count)
+	return count > 0
+}
+
+// UniquePostSlug 把 slug 规范化并加上数字后缀保证唯一，slug 为空时由标题生成
+func UniquePostSlug(slug, title string, postID uint64) string {
+	base := permalink.Slugify(slug)
+	if base == "" {
+		base = permalink.Slugify(title)
+	}
+	if base == "" {
+		base = "post"
+	}
+	candidate := base
+	for i := 2; slugTaken(candidate, postID); i++ {
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+	return candidate
+}
+
+// prepareSlug 保存文章前生成唯一的 slug
+func (post *Post) prepareSlug() {
+	post.Slug = UniquePostSlug(post.Slug, post.Title, post.ID)
+}
+
+// recordOldSlug 文章的 slug 改变时记录旧 slug；改回用过的 slug 时删除对应的记录
+func (post *Post) recordOldSlug(old string) error {
+	if old == post.Slug {
+		return nil
+	}
+	if err := DB.Delete(&PostSlug{}, "post_id = ? and slug = ?", post.ID, post.Slug).Error; err != nil {
+		return err
+	}
+	if old == "" {
+		return nil
+	}
+	return DB.Create(&PostSlug{PostID: post.ID, Slug: old}).Error
+}
+
+// GetPostByOldSlug 按旧 slug 查找文章
+func GetPostByOldSlug(slug string) (*Post, error) {
+	var old PostSlug
+	if err := DB.First(&old, "slug = ?", slug).Error; err != nil {
+		return nil, err
+	}
+	return GetPostByID(old.PostID)
+}
+
+// EnsurePostSlugs 为没有 slug 的旧文章生成 slug，启动时执行
+func EnsurePostSlugs() error {
+	var posts []*Post
+	if err := DB.Unscoped().Where("slug is null or slug = ''").Find(&posts).Error; err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.prepareSlug()
+		if err := DB.Unscoped().Model(post).UpdateColumn("slug", post.Slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -24,13 +24,13 @@ func InsertPostTag(postID, TagID int64) {
 
 func GetPostsByTags(postID int64,tagids []int64)[]*Post {
 	var posts []*Post
-	_ = DB.Raw("select p.* from post_tags pt inner join posts p on p.id= pt.post_id where p.id != ? and pt.tag_id in (?)",postID,tagids).Find(&posts).Error
+	_ = DB.Raw("select p.* from post_tags pt inner join posts p on p.id= pt.post_id where p.id != ? and pt.tag_id in (?) and p.deleted_at is null",postID,tagids).Find(&posts).Error
 	return posts
 }
 
 func ListTagByPostID (id interface{}) ([]*Tag,error) {
 	var tags []*Tag
-	rows,err := DB.Raw("select t.* from tags t inner join post_tags pt on t.id = pt.tag_id where pt.post_id = ?",id).Rows()
+	rows,err := DB.Raw("select t.* from tags t inner join post_tags pt on t.id = pt.tag_id where pt.post_id = ? and t.deleted_at is null",id).Rows()
 	if err != nil {
 		return nil,err
 	}
@@ -62,7 +62,9 @@ func UpdateMultiTags(originTags []string, newTags []string, postID int) {
 		tagID := GetTagIDByName(v)
 		needToDelTagID = append(needToDelTagID, tagID)
 	}
-	DB.Delete(&PostTag{},"tag_id in ( ? )",needToDelTagID)
+	if len(needToDelTagID) > 0 {
+		DB.Delete(&PostTag{},"post_id = ? and tag_id in ( ? )",postID,needToDelTagID)
+	}
 
 	needToAddTags := GetTagArray(newTags, originTags)
 	var needAddTagID []int
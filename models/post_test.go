@@ -0,0 +1,72 @@
+package models
+
+import "testing"
+
+// queryCounter 统计 gorm 执行的 SQL 语句
+type queryCounter struct {
+	queries []string
+}
+
+func (q *queryCounter) Print(v ...interface{}) {
+	if len(v) > 3 && v[0] == "sql" {
+		if sql, ok := v[3].(string); ok {
+			q.queries = append(q.queries, sql)
+		}
+	}
+}
+
+// TestLoadPostRelationsQueries 一页文章无论多少篇，标签和作者各只查询一次
+func TestLoadPostRelationsQueries(t *testing.T) {
+	defer openTestDB(t, true)()
+	alice := &User{Name: "alice"}
+	bob := &User{Name: "bob"}
+	goTag := &Tag{Name: "go"}
+	ginTag := &Tag{Name: "gin"}
+	for _, v := range []interface{}{alice, bob, goTag, ginTag} {
+		if err := DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 作者在回收站中时仍然显示作者名
+	bob.Delete()
+	var posts []*Post
+	for i := 0; i < 10; i++ {
+		post := &Post{Title: "post", AuthorID: int(alice.ID)}
+		if i%2 == 1 {
+			post.AuthorID = int(bob.ID)
+		}
+		if err := DB.Create(post).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range []*Tag{goTag, ginTag}[:i%3] {
+			if err := DB.Create(&PostTag{PostID: int64(post.ID), TagID: int64(tag.ID)}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		posts = append(posts, post)
+	}
+
+	counter := &queryCounter{}
+	DB.SetLogger(counter)
+	DB.LogMode(true)
+	err := LoadPostRelations(posts)
+	DB.LogMode(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(counter.queries); n != 2 {
+		t.Fatalf("a page of 10 posts made %d queries, want 2: %q", n, counter.queries)
+	}
+	for i, post := range posts {
+		want := "alice"
+		if i%2 == 1 {
+			want = "bob"
+		}
+		if post.User.Name != want {
+			t.Errorf("post %d author = %q, want %q", i, post.User.Name, want)
+		}
+		if len(post.Tags) != i%3 {
+			t.Errorf("post %d has %d tags, want %d", i, len(post.Tags), i%3)
+		}
+	}
+}
@@ -1,7 +1,144 @@
 package models
 
+import (
+	"fmt"
+)
+
+var RedisReactionKey string = "posts/%d/props/reactions"
+
+// 文章的反应类型
+const (
+	ReactUpvote int64 = iota
+	ReactFunny
+	ReactLove
+	ReactSurprised
+	ReactSad
+	ReactAngry
+)
+
+type ReactionKind struct {
+	Type  int64
+	Name  string
+	Emoji string
+}
+
+var ReactionKinds = []ReactionKind{
+	{ReactUpvote, "upvote", "👍"},
+	{ReactFunny, "funny", "😄"},
+	{ReactLove, "love", "❤️"},
+	{ReactSurprised, "surprised", "😮"},
+	{ReactSad, "sad", "😢"},
+	{ReactAngry, "angry", "😡"},
+}
+
+// ReactItem 一个 GitHub 用户对文章的一种反应，同一用户对同一文章每种反应只有一条
 type ReactItem struct {
 	BaseModel
-	PostID int64
-	ReactionType int64
-}
\ No newline at end of file
+	PostID int64 `gorm:"unique_index:idx_post_user_reaction"`
+	GitHubID int64 `gorm:"unique_index:idx_post_user_reaction"`
+	ReactionType int64 `gorm:"unique_index:idx_post_user_reaction"`
+}
+
+// Reaction 文章页展示用的反应统计
+type Reaction struct {
+	ReactionKind
+	Count   int
+	Reacted bool
+}
+
+func ReactionTypeByName(name string) (int64, bool) {
+	for _, kind := range ReactionKinds {
+		if kind.Name == name {
+			return kind.Type, true
+		}
+	}
+	return 0, false
+}
+
+func AddReaction(postID, gitHubID, reactionType int64) error {
+	item := ReactItem{PostID: postID, GitHubID: gitHubID, ReactionType: reactionType}
+	err := DB.FirstOrCreate(&item, "post_id = ? and git_hub_id = ? and reaction_type = ?", postID, gitHubID, reactionType).Error
+	if err == nil {
+		DeleteReactionCounts(postID)
+	}
+	return err
+}
+
+func RemoveReaction(postID, gitHubID, reactionType int64) error {
+	err := DB.Delete(&ReactItem{}, "post_id = ? and git_hub_id = ? and reaction_type = ?", postID, gitHubID, reactionType).Error
+	if err == nil {
+		DeleteReactionCounts(postID)
+	}
+	return err
+}
+
+func countReactions(postID int64) (map[string]int, error) {
+	counts := make(map[string]int, len(ReactionKinds))
+	for _, kind := range ReactionKinds {
+		counts[kind.Name] = 0
+	}
+	rows, err := DB.Model(&ReactItem{}).Select("reaction_type, count(*)").
+		Where("post_id = ?", postID).Group("reaction_type").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reactionType int64
+		var count int
+		if err := rows.Scan(&reactionType, &count); err != nil {
+			return nil, err
+		}
+		for _, kind := range ReactionKinds {
+			if kind.Type == reactionType {
+				counts[kind.Name] = count
+			}
+		}
+	}
+	return counts, nil
+}
+
+// GetReactionCounts 返回文章各反应的数量，优先读取 Redis 缓存
+func GetReactionCounts(postID int64) (map[string]int, error) {
+	if counts, ok := GetCachedReactionCounts(postID); ok {
+		return counts, nil
+	}
+	counts, err := countReactions(postID)
+	if err != nil {
+		return nil, err
+	}
+	SetReactionCounts(postID, counts)
+	return counts, nil
+}
+
+// ListPostReactions 返回文章页展示用的反应列表，gitHubID 为 0 表示未登录
+func ListPostReactions(postID, gitHubID int64) ([]*Reaction, error) {
+	counts, err := GetReactionCounts(postID)
+	if err != nil {
+		return nil, err
+	}
+	reacted := make(map[int64]bool)
+	if gitHubID != 0 {
+		var items []*ReactItem
+		err = DB.Find(&items, "post_id = ? and git_hub_id = ?", postID, gitHubID).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			reacted[item.ReactionType] = true
+		}
+	}
+	reactions := make([]*Reaction, 0, len(ReactionKinds))
+	for _, kind := range ReactionKinds {
+		reactions = append(reactions, &Reaction{
+			ReactionKind: kind,
+			Count:        counts[kind.Name],
+			Reacted:      reacted[kind.Type],
+		})
+	}
+	return reactions, nil
+}
+
+func getReactionKey(postID int64) string {
+	return fmt.Sprintf(RedisReactionKey, postID)
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"fmt"
 	"github.com/garyburd/redigo/redis"
+	"strings"
+	"time"
 )
 
 func getKey(postID int) string {
@@ -12,16 +14,76 @@ func getKey(postID int) string {
 func SetContent(postID int, value string) {
 	key := getKey(postID)
 	conn := RedisPool.Get()
+	defer conn.Close()
 	_,_ = conn.Do("set",key,value)
 }
 
 func GetContent(postID int) string {
 	key := getKey(postID)
 	conn := RedisPool.Get()
+	defer conn.Close()
 	value, _ := redis.String(conn.Do("get",key))
 	return value
 }
 
+func DeleteContent(postID int) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, _ = conn.Do("del", getKey(postID))
+}
+
+// 文章渲染缓存的命中和未命中次数，多个实例共用
+const (
+	renderCacheHitsKey   = "posts/render_cache/hits"
+	renderCacheMissesKey = "posts/render_cache/misses"
+)
+
+// GetRenderedContent 读取缓存的文章渲染结果，缓存按 hash 区分内容版本，不一致时视为未命中
+func GetRenderedContent(postID uint64, hash string) (string, bool) {
+	value := GetContent(int(postID))
+	hit := strings.HasPrefix(value, hash+"\n")
+	counter := renderCacheMissesKey
+	if hit {
+		counter = renderCacheHitsKey
+	}
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, _ = conn.Do("incr", counter)
+	if !hit {
+		return "", false
+	}
+	return value[len(hash)+1:], true
+}
+
+// SetRenderedContent 缓存文章的渲染结果，hash 写在内容之前
+func SetRenderedContent(postID uint64, hash, content string) {
+	SetContent(int(postID), hash+"\n"+content)
+}
+
+// RenderCacheStats 渲染缓存的累计命中情况
+type RenderCacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// HitRate 命中率百分比
+func (stats RenderCacheStats) HitRate() float64 {
+	if stats.Hits+stats.Misses == 0 {
+		return 0
+	}
+	return float64(stats.Hits) * 100 / float64(stats.Hits+stats.Misses)
+}
+
+func GetRenderCacheStats() (RenderCacheStats, error) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	values, err := redis.Int64s(conn.Do("mget", renderCacheHitsKey, renderCacheMissesKey))
+	if err != nil {
+		return RenderCacheStats{}, err
+	}
+	return RenderCacheStats{Hits: values[0], Misses: values[1]}, nil
+}
+
 func getCommentKey(commentID interface{}) string {
 	return fmt.Sprintf(RedisCommentKey, commentID)
 }
@@ -38,3 +100,85 @@ func GetCommentContent(commentID interface{}) string {
 	value, _ := redis.String(conn.Do("get",key))
 	return value
 }
+
+var releaseLockScript = redis.NewScript(1, `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// AcquireLock 使用 SET NX PX 获取分布式锁，token 用于释放时校验持有者
+func AcquireLock(key, token string, ttl time.Duration) bool {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, err := redis.String(conn.Do("set", key, token, "nx", "px", int64(ttl/time.Millisecond)))
+	return err == nil
+}
+
+func ReleaseLock(key, token string) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, _ = releaseLockScript.Do(conn, key, token)
+}
+
+// 反应数量缓存为 hash，"_" 字段用于区分“已缓存且全为 0”和“未缓存”
+const reactionCachedField = "_"
+
+func GetCachedReactionCounts(postID int64) (map[string]int, bool) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	values, err := redis.IntMap(conn.Do("hgetall", getReactionKey(postID)))
+	if err != nil || len(values) == 0 {
+		return nil, false
+	}
+	delete(values, reactionCachedField)
+	return values, true
+}
+
+func SetReactionCounts(postID int64, counts map[string]int) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	args := redis.Args{}.Add(getReactionKey(postID), reactionCachedField, 1).AddFlat(counts)
+	_, _ = conn.Do("hmset", args...)
+}
+
+func DeleteReactionCounts(postID int64) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, _ = conn.Do("del", getReactionKey(postID))
+}
+
+// 两步验证连续失败达到 MaxTwoFactorFailures 次后，在 TwoFactorLockout 内拒绝该用户的验证
+const (
+	MaxTwoFactorFailures = 5
+	TwoFactorLockout     = 15 * time.Minute
+	twoFactorFailuresKey = "users/%d/2fa/failures"
+)
+
+// RecordTwoFactorFailure 记录一次验证失败并重新计算锁定时间，返回连续失败的次数
+func RecordTwoFactorFailure(userID uint64) (int, error) {
+	key := fmt.Sprintf(twoFactorFailuresKey, userID)
+	conn := RedisPool.Get()
+	defer conn.Close()
+	count, err := redis.Int(conn.Do("incr", key))
+	if err != nil {
+		return 0, err
+	}
+	_, err = conn.Do("pexpire", key, int64(TwoFactorLockout/time.Millisecond))
+	return count, err
+}
+
+// TwoFactorLocked 用户的两步验证是否因连续失败被锁定
+func TwoFactorLocked(userID uint64) bool {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	count, _ := redis.Int(conn.Do("get", fmt.Sprintf(twoFactorFailuresKey, userID)))
+	return count >= MaxTwoFactorFailures
+}
+
+// ResetTwoFactorFailures 验证成功后清除失败次数
+func ResetTwoFactorFailures(userID uint64) {
+	conn := RedisPool.Get()
+	defer conn.Close()
+	_, _ = conn.Do("del", fmt.Sprintf(twoFactorFailuresKey, userID))
+}
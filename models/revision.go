@@ -0,0 +1,57 @@
+package models
+
+type PostRevision struct {
+	BaseModel
+	PostID   uint64 `gorm:"index"`
+	EditorID uint64
+	Title    string
+	Slug     string
+	Summary  string
+	Content  string `gorm:"type:longtext"`
+}
+
+// NewPostRevision 生成文章当前内容的快照
+func NewPostRevision(post *Post, editorID uint64) *PostRevision {
+	return &PostRevision{
+		PostID:   post.ID,
+		EditorID: editorID,
+		Title:    post.Title,
+		Slug:     post.Slug,
+		Summary:  post.Summary,
+		Content:  post.Content,
+	}
+}
+
+func (rev *PostRevision) Insert() error {
+	return DB.Create(rev).Error
+}
+
+// ApplyTo 将快照内容写回文章
+func (rev *PostRevision) ApplyTo(post *Post) {
+	post.Title = rev.Title
+	post.Slug = rev.Slug
+	post.Summary = rev.Summary
+	post.Content = rev.Content
+}
+
+func (rev *PostRevision) EditorName() string {
+	name, _ := GetUserNameByID(int(rev.EditorID))
+	return name
+}
+
+func ListRevisionsByPostID(postID interface{}) ([]*PostRevision, error) {
+	var revisions []*PostRevision
+	err := DB.Order("id desc").Find(&revisions, "post_id=?", postID).Error
+	return revisions, err
+}
+
+func CountRevisionsByPostID(postID interface{}) (count int, err error) {
+	err = DB.Model(&PostRevision{}).Where("post_id=?", postID).Count(&count).Error
+	return
+}
+
+func GetRevisionByID(id interface{}) (*PostRevision, error) {
+	var rev PostRevision
+	err := DB.First(&rev, id).Error
+	return &rev, err
+}
@@ -0,0 +1,69 @@
+package models
+
+// 后台用户角色
+const (
+	RoleAdmin       = "admin"
+	RoleEditor      = "editor"
+	RoleAuthor      = "author"
+	RoleContributor = "contributor"
+)
+
+var Roles = []string{RoleAdmin, RoleEditor, RoleAuthor, RoleContributor}
+
+type Permission string
+
+const (
+	PermCreatePosts      Permission = "posts:create"      // 新建文章、编辑自己的文章（草稿）
+	PermPublishPosts     Permission = "posts:publish"     // 发布/下线可编辑的文章
+	PermEditOthersPosts  Permission = "posts:edit_others" // 编辑其他人的文章
+	PermModerateComments Permission = "comments:moderate"
+	PermManageUsers      Permission = "users:manage"
+	PermManageSettings   Permission = "settings:manage"
+	PermUploadMedia      Permission = "media:upload" // 上传文件、浏览媒体库
+	PermManageMedia      Permission = "media:manage" // 删除媒体库中的文件
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin:       {PermCreatePosts, PermPublishPosts, PermEditOthersPosts, PermModerateComments, PermManageUsers, PermManageSettings, PermUploadMedia, PermManageMedia},
+	RoleEditor:      {PermCreatePosts, PermPublishPosts, PermEditOthersPosts, PermModerateComments, PermUploadMedia, PermManageMedia},
+	RoleAuthor:      {PermCreatePosts, PermPublishPosts, PermUploadMedia},
+	RoleContributor: {PermCreatePosts, PermUploadMedia},
+}
+
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can 判断用户是否拥有权限，未启用的用户没有任何权限；使用 API token 时还需在 token 的范围内
+func (user *User) Can(perm Permission) bool {
+	if user == nil || !user.Active {
+		return false
+	}
+	if user.scopes != nil && !hasPermission(user.scopes, perm) {
+		return false
+	}
+	return hasPermission(rolePermissions[user.Role], perm)
+}
+
+func hasPermission(perms []Permission, perm Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanEditPost 可以编辑任意文章，或者文章属于自己
+func (user *User) CanEditPost(post *Post) bool {
+	if !user.Can(PermCreatePosts) {
+		return false
+	}
+	return user.Can(PermEditOthersPosts) || uint64(post.AuthorID) == user.ID
+}
+
+// CanPublishPost 可以编辑该文章且拥有发布权限
+func (user *User) CanPublishPost(post *Post) bool {
+	return user.Can(PermPublishPosts) && user.CanEditPost(post)
+}
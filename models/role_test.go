@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanWithScopes(t *testing.T) {
+	cases := []struct {
+		role   string
+		active bool
+		scopes []string
+		perm   Permission
+		want   bool
+	}{
+		{RoleAdmin, true, nil, PermManageUsers, true},
+		{RoleAdmin, false, nil, PermCreatePosts, false},
+		{RoleAdmin, true, []string{ScopePostsWrite}, PermPublishPosts, true},
+		{RoleAdmin, true, []string{ScopePostsWrite}, PermModerateComments, false},
+		{RoleAdmin, true, []string{ScopeCommentsModerate, ScopeUsersManage}, PermManageUsers, true},
+		// token 范围不能超出用户角色的权限
+		{RoleContributor, true, []string{ScopePostsWrite}, PermPublishPosts, false},
+		{RoleContributor, true, []string{ScopeUsersManage}, PermManageUsers, false},
+	}
+	for _, c := range cases {
+		user := &User{Role: c.role, Active: c.active}
+		if c.scopes != nil {
+			user.scopes = (&APIToken{Scopes: strings.Join(c.scopes, " ")}).Permissions()
+		}
+		if got := user.Can(c.perm); got != c.want {
+			t.Errorf("%s active=%v scopes=%v Can(%s) = %v, want %v", c.role, c.active, c.scopes, c.perm, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const schedulerLockKey = "lyanna/scheduler/posts"
+
+func pluckPostIDs(query string, args ...interface{}) ([]uint64, error) {
+	var ids []uint64
+	err := DB.Model(&Post{}).Where(query, args...).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ApplyPostSchedules 发布 PublishAt 已到期的文章、下线 UnpublishAt 已到期的文章，
+// 处理过的时间字段会被清空，避免之后覆盖手动修改的发布状态
+func ApplyPostSchedules(now time.Time) (published, unpublished []uint64, err error) {
+	published, err = pluckPostIDs("publish_at <= ?", now)
+	if err != nil {
+		return
+	}
+	if len(published) > 0 {
+		err = DB.Model(&Post{}).Where("id in (?)", published).Updates(map[string]interface{}{
+			"published":  true,
+			"publish_at": nil,
+		}).Error
+		if err != nil {
+			return
+		}
+	}
+	unpublished, err = pluckPostIDs("unpublish_at <= ?", now)
+	if err != nil {
+		return
+	}
+	if len(unpublished) > 0 {
+		err = DB.Model(&Post{}).Where("id in (?)", unpublished).Updates(map[string]interface{}{
+			"published":    false,
+			"unpublish_at": nil,
+		}).Error
+	}
+	return
+}
+
+// NormalizeSchedule 保存前整理定时发布/下线时间：未到发布时间的文章保持未发布；
+// 已经过去的时间直接清空，发布状态以保存时的选择为准，不会在下一次定时检查时被改变
+func (post *Post) NormalizeSchedule(now time.Time) {
+	if post.PublishAt != nil {
+		if post.PublishAt.After(now) {
+			post.Published = false
+		} else {
+			post.PublishAt = nil
+		}
+	}
+	if post.UnpublishAt != nil && !post.UnpublishAt.After(now) {
+		post.UnpublishAt = nil
+	}
+}
+
+func runPostSchedule(now time.Time, ttl time.Duration) {
+	host, _ := os.Hostname()
+	token := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), now.UnixNano())
+	// 多个实例共用 MySQL/Redis 时只允许一个实例执行
+	if !AcquireLock(schedulerLockKey, token, ttl) {
+		return
+	}
+	defer ReleaseLock(schedulerLockKey, token)
+	published, unpublished, err := ApplyPostSchedules(now)
+	if err != nil {
+		Logger.Error("Failed to apply post schedules", zap.Error(err))
+		return
+	}
+	if len(published) > 0 || len(unpublished) > 0 {
+		changed := append(published, unpublished...)
+		if err := IndexPostsByID(changed); err != nil {
+			Logger.Error("Failed to update search index", zap.Error(err))
+		}
+		for _, id := range changed {
+			DeleteContent(int(id))
+		}
+		Logger.Info("Post schedules applied",
+			zap.Any("published", published), zap.Any("unpublished", unpublished))
+	}
+}
+
+// StartPostScheduler 在后台按 interval 周期检查定时发布/下线的文章
+func StartPostScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		runPostSchedule(time.Now(), interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runPostSchedule(now, interval)
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeSchedule(t *testing.T) {
+	now := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	cases := []struct {
+		name                 string
+		published            bool
+		publishAt, unpublish *time.Time
+		wantPublished        bool
+		wantPublishAt        bool
+		wantUnpublishAt      bool
+	}{
+		{"future publish keeps draft", true, &future, nil, false, true, false},
+		{"past publish on a draft is dropped", false, &past, nil, false, false, false},
+		{"past publish on a published post is dropped", true, &past, nil, true, false, false},
+		{"past unpublish is dropped", true, nil, &past, true, false, false},
+		{"future unpublish is kept", true, nil, &future, true, false, true},
+	}
+	for _, c := range cases {
+		post := &Post{Published: c.published, PublishAt: c.publishAt, UnpublishAt: c.unpublish}
+		post.NormalizeSchedule(now)
+		if post.Published != c.wantPublished || (post.PublishAt != nil) != c.wantPublishAt || (post.UnpublishAt != nil) != c.wantUnpublishAt {
+			t.Errorf("%s: published %v, publish_at %v, unpublish_at %v", c.name, post.Published, post.PublishAt, post.UnpublishAt)
+		}
+	}
+}
+
+// TestScheduleIgnoresPastPublishAt 以草稿保存且发布时间已过去的文章不会被定时任务发布
+func TestScheduleIgnoresPastPublishAt(t *testing.T) {
+	defer openTestDB(t, true)()
+	now := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	post := &Post{Title: "draft", PublishAt: &past}
+	post.NormalizeSchedule(now)
+	if err := post.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	published, _, err := ApplyPostSchedules(now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := GetPostByID(post.ID)
+	if len(published) != 0 || saved.Published {
+		t.Errorf("draft with a past publish_at was published: %v", published)
+	}
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"lyanna/render"
+	"lyanna/search"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SearchIndex 已发布文章的全文索引，启动时由 RebuildSearchIndex 建立，本实例修改文章时随之更新，
+// 其他实例的修改由 StartSearchSync 定期同步
+var SearchIndex = search.NewIndex()
+
+// searchSyncSkew 同步时多检查的一段时间，容忍各实例之间的时钟误差
+const searchSyncSkew = time.Minute
+
+// SearchResult 一条搜索结果
+type SearchResult struct {
+	Post *Post
+	search.Hit
+}
+
+// postText 把文章的摘要和 Markdown 正文转换为纯文本
+func postText(post *Post) string {
+	return strings.Join(strings.Fields(post.Summary+" "+render.Text.Text(post.Content)), " ")
+}
+
+// IndexPost 更新文章在搜索索引中的内容，未发布的文章从索引中移除
+func IndexPost(post *Post) {
+	if !post.Published {
+		SearchIndex.Remove(post.ID)
+		return
+	}
+	SearchIndex.Add(search.Document{ID: post.ID, Title: post.Title, Body: postText(post)})
+}
+
+// IndexPostsByID 重新索引指定的文章，用于批量修改发布状态之后
+func IndexPostsByID(ids []uint64) error {
+	var posts []*Post
+	if err := DB.Where("id in (?)", ids).Find(&posts).Error; err != nil {
+		return err
+	}
+	found := make(map[uint64]bool, len(posts))
+	for _, post := range posts {
+		found[post.ID] = true
+		IndexPost(post)
+	}
+	for _, id := range ids {
+		if !found[id] {
+			SearchIndex.Remove(id)
+		}
+	}
+	return nil
+}
+
+// RebuildSearchIndex 索引全部已发布的文章
+func RebuildSearchIndex() error {
+	var posts []*Post
+	if err := DB.Where("published = ?", true).Find(&posts).Error; err != nil {
+		return err
+	}
+	for _, post := range posts {
+		IndexPost(post)
+	}
+	return nil
+}
+
+// SyncSearchIndex 让本实例的索引与数据库一致：重新索引 since 之后修改过的文章，
+// 补上索引中缺少的已发布文章（例如从回收站恢复的），移除已下线或删除的文章
+func SyncSearchIndex(since time.Time) error {
+	var published []uint64
+	if err := DB.Model(&Post{}).Where("published = ?", true).Pluck("id", &published).Error; err != nil {
+		return err
+	}
+	live := make(map[uint64]bool, len(published))
+	for _, id := range published {
+		live[id] = true
+	}
+	indexed := make(map[uint64]bool)
+	for _, id := range SearchIndex.IDs() {
+		indexed[id] = true
+		if !live[id] {
+			SearchIndex.Remove(id)
+		}
+	}
+	var missing []uint64
+	for _, id := range published {
+		if !indexed[id] {
+			missing = append(missing, id)
+		}
+	}
+	var posts []*Post
+	query := DB.Where("updated_at >= ?", since)
+	if len(missing) > 0 {
+		query = DB.Where("updated_at >= ? or id in (?)", since, missing)
+	}
+	if err := query.Find(&posts).Error; err != nil {
+		return err
+	}
+	for _, post := range posts {
+		IndexPost(post)
+	}
+	return nil
+}
+
+// StartSearchSync 在后台按 interval 周期同步搜索索引，多个实例部署时
+// 其他实例发布、修改、删除的文章和定时发布的文章也能搜索到
+func StartSearchSync(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		last := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if err := SyncSearchIndex(last.Add(-searchSyncSkew)); err != nil {
+				Logger.Error("Failed to sync search index", zap.Error(err))
+				continue
+			}
+			last = now
+		}
+	}()
+}
+
+// SearchPosts 搜索已发布的文章，返回第 offset 条起的 limit 条结果和结果总数
+func SearchPosts(query string, offset, limit int) ([]*SearchResult, int, error) {
+	hits, total := SearchIndex.Search(query, offset, limit)
+	if len(hits) == 0 {
+		return nil, total, nil
+	}
+	ids := make([]uint64, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	var posts []*Post
+	if err := DB.Where("id in (?) and published = ?", ids, true).Find(&posts).Error; err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uint64]*Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID] = post
+	}
+	results := make([]*SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		// 其他实例下线或删除的文章可能仍在本实例的索引中
+		if post, ok := byID[hit.ID]; ok {
+			results = append(results, &SearchResult{Post: post, Hit: hit})
+		}
+	}
+	return results, total, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"lyanna/search"
+	"testing"
+	"time"
+)
+
+// TestSyncSearchIndex 其他实例直接写入数据库的修改同步到本实例的索引
+func TestSyncSearchIndex(t *testing.T) {
+	defer openTestDB(t, true)()
+	defer func(old *search.Index) { SearchIndex = old }(SearchIndex)
+	SearchIndex = search.NewIndex()
+
+	edited := &Post{Title: "old gopher", Published: true}
+	unpublished := &Post{Title: "hidden gopher", Published: true}
+	deleted := &Post{Title: "deleted gopher", Published: true}
+	for _, post := range []*Post{edited, unpublished, deleted} {
+		if err := post.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		IndexPost(post)
+	}
+	since := time.Now()
+	// 以下修改发生在其他实例上，本实例的索引没有更新
+	created := &Post{Title: "new gopher", Published: true}
+	DB.Create(created)
+	DB.Model(edited).Update("title", "edited mole")
+	DB.Model(unpublished).Update("published", false)
+	DB.Delete(deleted)
+	if _, total, _ := SearchPosts("gopher", 0, 10); total != 3 {
+		t.Fatalf("before sync: %d results, want 3 stale ones", total)
+	}
+
+	if err := SyncSearchIndex(since.Add(-searchSyncSkew)); err != nil {
+		t.Fatal(err)
+	}
+	results, total, err := SearchPosts("gopher", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(results) != 1 || results[0].Post.ID != created.ID {
+		t.Errorf("after sync: total %d, results %v", total, results)
+	}
+	if _, total, _ := SearchPosts("mole", 0, 10); total != 1 {
+		t.Errorf("edited post found %d times, want 1", total)
+	}
+
+	// 从回收站恢复的文章没有修改 updated_at，也要补进索引
+	DB.Unscoped().Model(deleted).UpdateColumn("deleted_at", nil)
+	if err := SyncSearchIndex(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := SearchPosts("deleted", 0, 10); total != 1 {
+		t.Errorf("restored post found %d times, want 1", total)
+	}
+}
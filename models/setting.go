@@ -0,0 +1,101 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 站点设置项，保存在 settings 表中，可在后台修改
+const (
+	SettingRequire2FA = "security.require_2fa"
+
+	SettingSiteTitle       = "site.title"
+	SettingSiteDescription = "site.description"
+	SettingSiteURL         = "site.url" // 站点的绝对地址，为空时根据请求推断
+	SettingSiteLanguage    = "site.language"
+	SettingSiteAuthor      = "site.author"
+	SettingSiteEmail       = "site.author_email"
+
+	SettingFeedLimit       = "feed.limit"
+	SettingFeedFullContent = "feed.full_content"
+)
+
+// DefaultFeedLimit 订阅源默认输出的文章数
+const DefaultFeedLimit = 20
+
+type Setting struct {
+	BaseModel
+	Name  string `gorm:"size:64;unique_index"`
+	Value string `gorm:"type:text"`
+}
+
+// GetSetting 读取设置项，不存在时返回 def
+func GetSetting(name, def string) string {
+	var setting Setting
+	if err := DB.First(&setting, "name=?", name).Error; err != nil {
+		return def
+	}
+	return setting.Value
+}
+
+func GetIntSetting(name string, def int) int {
+	n, err := strconv.Atoi(GetSetting(name, strconv.Itoa(def)))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func GetBoolSetting(name string, def bool) bool {
+	b, err := strconv.ParseBool(GetSetting(name, strconv.FormatBool(def)))
+	if err != nil {
+		return def
+	}
+	return b
+}
+
+// SetSetting 保存设置项
+func SetSetting(name, value string) error {
+	setting := Setting{Name: name}
+	return DB.Where(Setting{Name: name}).Assign(Setting{Value: value}).FirstOrCreate(&setting).Error
+}
+
+// Require2FA 是否要求所有启用的后台用户开启两步验证
+func Require2FA() bool {
+	return GetBoolSetting(SettingRequire2FA, false)
+}
+
+// SiteSettings 站点信息，用于订阅源等需要站点元数据的地方
+type SiteSettings struct {
+	Title       string
+	Description string
+	URL         string
+	Language    string
+	Author      string
+	AuthorEmail string
+}
+
+func GetSiteSettings() SiteSettings {
+	return SiteSettings{
+		Title:       GetSetting(SettingSiteTitle, "My Blog"),
+		Description: GetSetting(SettingSiteDescription, "A modern, beautiful blog powered by GoLyanna"),
+		URL:         strings.TrimRight(GetSetting(SettingSiteURL, ""), "/"),
+		Language:    GetSetting(SettingSiteLanguage, "zh-CN"),
+		Author:      GetSetting(SettingSiteAuthor, ""),
+		AuthorEmail: GetSetting(SettingSiteEmail, ""),
+	}
+}
+
+// FeedLimit 订阅源输出的文章数
+func FeedLimit() int {
+	limit := GetIntSetting(SettingFeedLimit, DefaultFeedLimit)
+	if limit < 1 {
+		return DefaultFeedLimit
+	}
+	return limit
+}
+
+// FeedFullContent 订阅源是否输出全文
+func FeedFullContent() bool {
+	return GetBoolSetting(SettingFeedFullContent, false)
+}
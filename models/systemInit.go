@@ -3,7 +3,6 @@ package models
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
 	"time"
 
@@ -21,13 +20,22 @@ const (
 	CONTEXT_USER_KEY     = "User"
 	CONTEXT_GIT_USER_KEY = "GitUser"
 	SESSION_GITHUB_STATE = "GITHUB_STATE" // github state session key
+
+	SESSION_2FA_USER_KEY   = "2FAUserID"  // 密码已通过、等待两步验证的用户
+	SESSION_2FA_EXPIRES    = "2FAExpires" // 两步验证步骤的截止时间
+	SESSION_2FA_SECRET_KEY = "2FASecret"  // 绑定中尚未确认的 TOTP 密钥
+
+	SESSION_CSRF_KEY = "CSRFToken"
+	CONTEXT_CSRF_KEY = "CSRFToken"
+
+	CONTEXT_API_TOKEN_KEY = "APIToken" // 使用 Authorization: Bearer 认证时的 token
 )
 
 var (
 	DB        *gorm.DB
 	RedisPool *redis.Pool
 	Conf      = new(Config)
-	Logger    *zap.Logger
+	Logger    = zap.NewNop() // 由 Init 按配置替换
 )
 
 type Config struct {
@@ -46,6 +54,47 @@ type Config struct {
 		RedirectUrl  string
 		TokenUrl     string
 	}
+	Comment struct {
+		Moderation string // none / first / all
+	}
+	Spam struct {
+		Engine    string  // bayes / remote / none
+		Threshold float64 // 贝叶斯判定为垃圾评论的最低概率
+		MinDocs   int     // 每个类别至少需要的训练样本数
+		Endpoint  string  // remote: Akismet 风格接口地址
+		Key       string
+		Blog      string
+	}
+	Password struct {
+		Algorithm  string // bcrypt / argon2id
+		BcryptCost int
+	}
+	Scheduler struct {
+		Interval int // 定时发布检查间隔，单位秒
+	}
+	Permalink struct {
+		Pattern string // 文章链接格式：/post/:id、/post/:slug、/:year/:month/:slug 等
+	}
+	Trash struct {
+		RetentionDays int // 回收站中的记录保留天数，0 表示不自动清理
+	}
+	Media struct {
+		Storage   string // local / s3
+		MaxSize   int64  // 单个文件的最大字节数
+		Dir       string // local: 保存目录
+		URL       string // local: 访问路径前缀
+		Endpoint  string // s3: 服务地址
+		Bucket    string
+		Region    string
+		AccessKey string
+		SecretKey string
+		PublicURL string // s3: 文件的公开访问地址前缀，默认为 Endpoint/Bucket
+		CacheDir  string // 缩小后图片的缓存目录
+		Widths    []int  // 缩小图片的预设宽度
+		Quality   int    // 缩小图片的 JPEG 质量
+		Sizes     string // 文章中图片的 sizes 属性
+		SignKey   string // 缩小图片地址的签名密钥，默认使用 SessionSecret
+	}
 	Redis struct {
 		Host        string
 		Port        int
@@ -64,12 +113,6 @@ type Config struct {
 	}
 }
 
-func checkError(err error) {
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 func InitDB() (err error) {
 	db, err := gorm.Open("mysql", Conf.General.DSN)
 	if err != nil {
@@ -91,7 +134,7 @@ func InitDB() (err error) {
 	}
 
 	// 自动迁移数据库表
-	err = DB.AutoMigrate(&Comment{}, &Post{}, &PostTag{}, &ReactItem{}, &Tag{}, &User{}, &GitHubUser{}).Error
+	err = Migrate(DB)
 	if err != nil {
 		Logger.Error("Failed to migrate database", zap.Error(err))
 		return err
@@ -101,6 +144,24 @@ func InitDB() (err error) {
 	return nil
 }
 
+// Migrate 创建或更新所有数据表，并迁移旧版本的数据
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&Comment{}, &Post{}, &PostTag{}, &PostRevision{}, &PostSlug{}, &ReactItem{}, &Tag{}, &User{}, &UserRecoveryCode{}, &APIToken{}, &Media{}, &Setting{}, &GitHubUser{}).Error
+	if err != nil {
+		return err
+	}
+	return migrateLegacyPasswords(db)
+}
+
+// migrateLegacyPasswords 旧版本由 AutoMigrate 建的 users 表把密码保存在 pass_word 列，
+// 复制到 password 列，旧的 MD5 哈希在登录时照常升级；pass_word 列保留但不再使用
+func migrateLegacyPasswords(db *gorm.DB) error {
+	if !db.Dialect().HasColumn("users", "pass_word") {
+		return nil
+	}
+	return db.Exec("update users set password = pass_word where (password is null or password = '') and pass_word <> ''").Error
+}
+
 func initRedis() error {
 	redisAddr := fmt.Sprintf("%s:%d", Conf.Redis.Host, Conf.Redis.Port)
 
@@ -193,20 +254,26 @@ func initLog() {
 	Logger = zap.New(core, caller, development, filed)
 }
 
-func init() {
+// Init 读取 config/config.yaml，初始化日志并连接数据库和 Redis，由 main 在启动时调用
+func Init() error {
 	data, err := ioutil.ReadFile("config/config.yaml")
-	checkError(err)
-	err = yaml.Unmarshal(data, Conf)
-	checkError(err)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, Conf); err != nil {
+		return err
+	}
 
 	initLog()
 	Logger.Info("Configuration and logging initialized successfully")
 
-	err = InitDB()
-	checkError(err)
-
-	err = initRedis()
-	checkError(err)
+	if err := InitDB(); err != nil {
+		return err
+	}
+	if err := initRedis(); err != nil {
+		return err
+	}
 
 	Logger.Info("System initialization completed successfully")
+	return nil
 }
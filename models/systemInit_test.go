@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// openTestDB 用临时的 SQLite 数据库代替 MySQL，Redis 不可用，返回清理函数
+func openTestDB(t *testing.T, migrate bool) func() {
+	dir, err := ioutil.TempDir("", "lyanna")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrate {
+		if err := Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	DB = db
+	RedisPool = &redis.Pool{Dial: func() (redis.Conn, error) {
+		return nil, errors.New("redis is not available in tests")
+	}}
+	return func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// TestMigrateLegacyPasswords 旧表 pass_word 列中的密码迁移到 password 列
+func TestMigrateLegacyPasswords(t *testing.T) {
+	defer openTestDB(t, false)()
+	legacy := "e10adc3949ba59abbe56e057f20f883e"
+	if err := DB.Exec("create table users (id integer primary key, name varchar(255), pass_word varchar(255))").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Exec("insert into users (id, name, pass_word) values (1, 'admin', ?)", legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 启动两次，第二次不应改变已迁移的密码
+	for i := 0; i < 2; i++ {
+		if err := Migrate(DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err := GetUserByName("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PassWord != legacy {
+		t.Errorf("password = %q, want the legacy hash", user.PassWord)
+	}
+}
@@ -1,8 +1,11 @@
 package models
 
+import "time"
+
 type Tag struct {
 	BaseModel
 	Name string
+	DeletedAt *time.Time `sql:"index"` // 不为空时在回收站中
 	Total int `gorm:"-"`
 }
 
@@ -18,9 +21,14 @@ func GetTagIDByName(name string) int {
 	return int(tag.ID)
 }
 
+// GetTag 按名称读取或创建标签，同名标签在回收站中时将其恢复
 func GetTag(tag *Tag){
-	res := DB.FirstOrCreate(tag,"name=?",tag.Name).Row()
+	res := DB.Unscoped().FirstOrCreate(tag,"name=?",tag.Name).Row()
 	_ = res.Scan(tag)
+	if tag.DeletedAt != nil {
+		DB.Unscoped().Model(tag).Update("deleted_at", nil)
+		tag.DeletedAt = nil
+	}
 }
 
 func GetTagNameByID(tagID int)string {
@@ -31,7 +39,7 @@ func GetTagNameByID(tagID int)string {
 
 func ListTag()([]*Tag,error) {
 	var tags []*Tag
-	rows, err := DB.Raw("select t.*,count(*) total from tags t inner join post_tags pt on t.id=pt.tag_id inner join posts p on pt.post_id = p.id where p.published = ? group by pt.tag_id",true).Rows()
+	rows, err := DB.Raw("select t.*,count(*) total from tags t inner join post_tags pt on t.id=pt.tag_id inner join posts p on pt.post_id = p.id where p.published = ? and p.deleted_at is null and t.deleted_at is null group by pt.tag_id",true).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -42,3 +50,69 @@ func ListTag()([]*Tag,error) {
 	}
 	return tags, nil
 }
+
+// GetTagByID 读取标签并填充文章数
+func GetTagByID(id interface{}) (*Tag, error) {
+	var tag Tag
+	if err := DB.First(&tag, id).Error; err != nil {
+		return &tag, err
+	}
+	return &tag, countTagPosts([]*Tag{&tag})
+}
+
+// ListTagsPage 分页查询标签，同时返回标签总数，Total 为该标签下的文章数
+func ListTagsPage(offset, limit int) ([]*Tag, int, error) {
+	var (
+		tags  []*Tag
+		total int
+	)
+	if err := DB.Model(&Tag{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := DB.Order("id").Offset(offset).Limit(limit).Find(&tags).Error; err != nil {
+		return nil, 0, err
+	}
+	return tags, total, countTagPosts(tags)
+}
+
+// countTagPosts 填充标签的文章数
+func countTagPosts(tags []*Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	byID := make(map[uint64]*Tag, len(tags))
+	var ids []uint64
+	for _, tag := range tags {
+		byID[tag.ID] = tag
+		ids = append(ids, tag.ID)
+	}
+	rows, err := DB.Model(&PostTag{}).Select("tag_id, count(*)").
+		Joins("inner join posts p on p.id = post_tags.post_id and p.deleted_at is null").
+		Where("tag_id in (?)", ids).Group("tag_id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uint64
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		byID[id].Total = count
+	}
+	return rows.Err()
+}
+
+func (tag *Tag) Insert() error {
+	return DB.Create(tag).Error
+}
+
+func (tag *Tag) Update() error {
+	return DB.Model(tag).Update("name", tag.Name).Error
+}
+
+// Delete 把标签移到回收站，文章关联保留，恢复后原样显示
+func (tag *Tag) Delete() error {
+	return DB.Delete(tag).Error
+}
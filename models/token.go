@@ -0,0 +1,130 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix 个人 API token 明文的前缀，便于在日志和代码仓库中识别泄露的 token
+const APITokenPrefix = "lya_"
+
+// apiTokenTouchInterval 最近使用时间的最小更新间隔，避免每个请求都写数据库
+const apiTokenTouchInterval = time.Minute
+
+// token 的权限范围，每个范围对应一组权限；没有范围的 token 拥有用户角色的全部权限
+const (
+	ScopePostsWrite       = "posts:write"
+	ScopeCommentsModerate = "comments:moderate"
+	ScopeUsersManage      = "users:manage"
+)
+
+var TokenScopes = []string{ScopePostsWrite, ScopeCommentsModerate, ScopeUsersManage}
+
+var scopePermissions = map[string][]Permission{
+	ScopePostsWrite:       {PermCreatePosts, PermPublishPosts, PermEditOthersPosts, PermUploadMedia},
+	ScopeCommentsModerate: {PermModerateComments},
+	ScopeUsersManage:      {PermManageUsers},
+}
+
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+// APIToken 个人 API token，只保存明文的 SHA-256
+type APIToken struct {
+	BaseModel
+	UserID     uint64 `gorm:"index"`
+	Name       string `gorm:"size:64"`
+	TokenHash  string `gorm:"size:64;unique_index"`
+	Hint       string `gorm:"size:16"` // 明文的前几位，用于在列表中区分 token
+	Scopes     string // 空格分隔的权限范围
+	LastUsedAt *time.Time
+}
+
+func IsTokenScope(scope string) bool {
+	_, ok := scopePermissions[scope]
+	return ok
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 为用户生成新的 token，返回只显示一次的明文
+func CreateAPIToken(userID uint64, name string, scopes []string) (*APIToken, string, error) {
+	for _, scope := range scopes {
+		if !IsTokenScope(scope) {
+			return nil, "", errors.New("unknown scope " + scope)
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	plain := APITokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashAPIToken(plain),
+		Hint:      plain[:len(APITokenPrefix)+6],
+		Scopes:    strings.Join(scopes, " "),
+	}
+	if err := DB.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, plain, nil
+}
+
+func ListAPITokensByUserID(userID uint64) ([]*APIToken, error) {
+	var tokens []*APIToken
+	err := DB.Where("user_id = ?", userID).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken 删除用户自己的 token
+func RevokeAPIToken(userID uint64, id interface{}) error {
+	return DB.Delete(&APIToken{}, "id = ? and user_id = ?", id, userID).Error
+}
+
+// AuthenticateAPIToken 校验 token 明文，返回权限被限制在 token 范围内的用户，并记录最近使用时间
+func AuthenticateAPIToken(plain string, now time.Time) (*User, *APIToken, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	var token APIToken
+	if err := DB.First(&token, "token_hash = ?", hashAPIToken(plain)).Error; err != nil {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	user, err := GetUserByID(token.UserID)
+	if err != nil || !user.Active {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	user.scopes = token.Permissions()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		token.LastUsedAt = &now
+		DB.Model(&token).UpdateColumn("last_used_at", now)
+	}
+	return user, &token, nil
+}
+
+// ScopeList token 的权限范围
+func (token *APIToken) ScopeList() []string {
+	return strings.Fields(token.Scopes)
+}
+
+// Permissions token 范围内的权限，没有范围时返回 nil 表示不限制
+func (token *APIToken) Permissions() []Permission {
+	scopes := token.ScopeList()
+	if len(scopes) == 0 {
+		return nil
+	}
+	perms := []Permission{}
+	for _, scope := range scopes {
+		perms = append(perms, scopePermissions[scope]...)
+	}
+	return perms
+}
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+)
+
+const trashLockKey = "lyanna/scheduler/trash"
+
+// 回收站中的记录类型
+const (
+	TrashPosts    = "posts"
+	TrashComments = "comments"
+	TrashUsers    = "users"
+	TrashTags     = "tags"
+)
+
+var TrashKinds = []string{TrashPosts, TrashComments, TrashUsers, TrashTags}
+
+// trashPermissions 查看、恢复和彻底删除各类记录需要的权限，与删除时需要的权限一致
+var trashPermissions = map[string]Permission{
+	TrashPosts:    PermEditOthersPosts,
+	TrashComments: PermModerateComments,
+	TrashUsers:    PermManageUsers,
+	TrashTags:     PermEditOthersPosts,
+}
+
+// TrashPermission 管理某类回收站记录需要的权限，类型不存在时 ok 为 false
+func TrashPermission(kind string) (Permission, bool) {
+	perm, ok := trashPermissions[kind]
+	return perm, ok
+}
+
+// TrashItem 回收站中的一条记录
+type TrashItem struct {
+	Kind      string
+	ID        uint64
+	Title     string // 文章标题、评论内容开头、用户名或标签名
+	DeletedAt time.Time
+}
+
+func trashModel(kind string) interface{} {
+	switch kind {
+	case TrashPosts:
+		return &Post{}
+	case TrashComments:
+		return &Comment{}
+	case TrashUsers:
+		return &User{}
+	case TrashTags:
+		return &Tag{}
+	}
+	return nil
+}
+
+// trashed 回收站中某类记录的查询
+func trashed(kind string) *gorm.DB {
+	return DB.Unscoped().Model(trashModel(kind)).Where("deleted_at is not null")
+}
+
+// CountTrash 各类记录在回收站中的数量
+func CountTrash() (map[string]int, error) {
+	counts := make(map[string]int, len(TrashKinds))
+	for _, kind := range TrashKinds {
+		var count int
+		if err := trashed(kind).Count(&count).Error; err != nil {
+			return counts, err
+		}
+		counts[kind] = count
+	}
+	return counts, nil
+}
+
+// NameInTrash 回收站中是否有同名的用户或标签，名称的唯一约束包含回收站中的记录
+func NameInTrash(kind, name string, exceptID uint64) bool {
+	var count int
+	trashed(kind).Where("name = ? and id <> ?", name, exceptID).Count(&count)
+	return count > 0
+}
+
+// ListTrash 按删除时间倒序分页列出回收站中的一类记录
+func ListTrash(kind string, offset, limit int) ([]*TrashItem, error) {
+	query := trashed(kind).Order("deleted_at desc").Offset(offset).Limit(limit)
+	var items []*TrashItem
+	switch kind {
+	case TrashPosts:
+		var posts []*Post
+		if err := query.Find(&posts).Error; err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			items = append(items, &TrashItem{Kind: kind, ID: post.ID, Title: post.Title, DeletedAt: *post.DeletedAt})
+		}
+	case TrashComments:
+		var comments []*Comment
+		if err := query.Find(&comments).Error; err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			items = append(items, &TrashItem{Kind: kind, ID: comment.ID, Title: trashTitle(comment.Content), DeletedAt: *comment.DeletedAt})
+		}
+	case TrashUsers:
+		var users []*User
+		if err := query.Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			items = append(items, &TrashItem{Kind: kind, ID: user.ID, Title: user.Name, DeletedAt: *user.DeletedAt})
+		}
+	case TrashTags:
+		var tags []*Tag
+		if err := query.Find(&tags).Error; err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			items = append(items, &TrashItem{Kind: kind, ID: tag.ID, Title: tag.Name, DeletedAt: *tag.DeletedAt})
+		}
+	}
+	return items, nil
+}
+
+// trashTitle 评论内容的前 80 个字
+func trashTitle(content string) string {
+	if utf8.RuneCountInString(content) <= 80 {
+		return content
+	}
+	return string([]rune(content)[:80]) + "..."
+}
+
+// RestoreTrash 从回收站恢复记录，恢复的文章重新加入搜索索引
+func RestoreTrash(kind string, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := trashed(kind).Where("id in (?)", ids).UpdateColumn("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	if kind == TrashPosts {
+		for _, id := range ids {
+			DeleteContent(int(id))
+		}
+		return IndexPostsByID(ids)
+	}
+	return nil
+}
+
+// PurgeTrash 彻底删除回收站中的记录：文章连同标签关联、历史版本、评论、反应和旧 slug，
+// 用户连同恢复码和 API token（文章保留），标签连同文章关联
+func PurgeTrash(kind string, ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// 只删除确实在回收站中的记录
+	var found []uint64
+	if err := trashed(kind).Where("id in (?)", ids).Pluck("id", &found).Error; err != nil || len(found) == 0 {
+		return err
+	}
+	ids = found
+	tx := DB.Begin().Unscoped()
+	var related []func() error
+	switch kind {
+	case TrashPosts:
+		related = []func() error{
+			func() error { return tx.Delete(&PostTag{}, "post_id in (?)", ids).Error },
+			func() error { return tx.Delete(&PostRevision{}, "post_id in (?)", ids).Error },
+			func() error { return tx.Delete(&Comment{}, "post_id in (?)", ids).Error },
+			func() error { return tx.Delete(&ReactItem{}, "post_id in (?)", ids).Error },
+			func() error { return tx.Delete(&PostSlug{}, "post_id in (?)", ids).Error },
+		}
+	case TrashUsers:
+		related = []func() error{
+			func() error { return tx.Delete(&UserRecoveryCode{}, "user_id in (?)", ids).Error },
+			func() error { return tx.Delete(&APIToken{}, "user_id in (?)", ids).Error },
+		}
+	case TrashTags:
+		related = []func() error{
+			func() error { return tx.Delete(&PostTag{}, "tag_id in (?)", ids).Error },
+		}
+	}
+	related = append(related, func() error { return tx.Delete(trashModel(kind), "id in (?)", ids).Error })
+	for _, del := range related {
+		if err := del(); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// EmptyTrash 彻底删除在回收站中超过保留期的记录，返回各类删除的数量
+func EmptyTrash(before time.Time) (map[string]int, error) {
+	purged := make(map[string]int)
+	for _, kind := range TrashKinds {
+		var ids []uint64
+		if err := trashed(kind).Where("deleted_at < ?", before).Pluck("id", &ids).Error; err != nil {
+			return purged, err
+		}
+		if err := PurgeTrash(kind, ids); err != nil {
+			return purged, err
+		}
+		if len(ids) > 0 {
+			purged[kind] = len(ids)
+		}
+	}
+	return purged, nil
+}
+
+func runTrashCleaner(now time.Time, retention, ttl time.Duration) {
+	host, _ := os.Hostname()
+	token := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), now.UnixNano())
+	if !AcquireLock(trashLockKey, token, ttl) {
+		return
+	}
+	defer ReleaseLock(trashLockKey, token)
+	purged, err := EmptyTrash(now.Add(-retention))
+	if err != nil {
+		Logger.Error("Failed to empty trash", zap.Error(err))
+		return
+	}
+	if len(purged) > 0 {
+		Logger.Info("Trash emptied", zap.Any("purged", purged))
+	}
+}
+
+// StartTrashCleaner 在后台每小时清理一次回收站中超过 retention 的记录，retention 为 0 时不自动清理
+func StartTrashCleaner(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	interval := time.Hour
+	go func() {
+		runTrashCleaner(time.Now(), retention, interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runTrashCleaner(now, retention, interval)
+		}
+	}()
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"lyanna/search"
+	"testing"
+	"time"
+)
+
+// newTrashedPost 创建带有标签关联、历史版本、评论、反应和旧 slug 的文章
+func newTrashedPost(t *testing.T, title string, trash bool) *Post {
+	post := &Post{Title: title, Slug: title, Published: true}
+	if err := DB.Create(post).Error; err != nil {
+		t.Fatal(err)
+	}
+	related := []interface{}{
+		&PostTag{PostID: int64(post.ID), TagID: 1},
+		&PostRevision{PostID: post.ID, Title: title},
+		&Comment{PostID: int64(post.ID), Content: "hi"},
+		&ReactItem{PostID: int64(post.ID), GitHubID: 1, ReactionType: 1},
+		&PostSlug{PostID: post.ID, Slug: "old-" + title},
+	}
+	for _, v := range related {
+		if err := DB.Create(v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if trash {
+		if err := post.Delete(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return post
+}
+
+// countRelated 文章在各关联表中的记录数
+func countRelated(t *testing.T, postID uint64) map[string]int {
+	counts := make(map[string]int)
+	for name, model := range map[string]interface{}{
+		"post_tags": &PostTag{}, "post_revisions": &PostRevision{}, "comments": &Comment{},
+		"react_items": &ReactItem{}, "post_slugs": &PostSlug{},
+	} {
+		var n int
+		if err := DB.Unscoped().Model(model).Where("post_id = ?", postID).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		counts[name] = n
+	}
+	var n int
+	DB.Unscoped().Model(&Post{}).Where("id = ?", postID).Count(&n)
+	counts["posts"] = n
+	return counts
+}
+
+func TestRestoreTrash(t *testing.T) {
+	defer openTestDB(t, true)()
+	defer func(old *search.Index) { SearchIndex = old }(SearchIndex)
+	SearchIndex = search.NewIndex()
+	post := newTrashedPost(t, "gopher", true)
+	if _, err := GetPostByID(post.ID); err == nil {
+		t.Fatal("trashed post is still visible")
+	}
+	if err := RestoreTrash(TrashPosts, []uint64{post.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetPostByID(post.ID); err != nil {
+		t.Errorf("restored post not found: %v", err)
+	}
+	if _, total, _ := SearchPosts("gopher", 0, 10); total != 1 {
+		t.Errorf("restored post found %d times in search, want 1", total)
+	}
+	if counts, _ := CountTrash(); counts[TrashPosts] != 0 {
+		t.Errorf("%d posts left in the trash", counts[TrashPosts])
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	defer openTestDB(t, true)()
+	trashedPost := newTrashedPost(t, "trashed", true)
+	livePost := newTrashedPost(t, "live", false)
+
+	// 不在回收站中的记录不会被彻底删除
+	if err := PurgeTrash(TrashPosts, []uint64{trashedPost.ID, livePost.ID}); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range countRelated(t, trashedPost.ID) {
+		if n != 0 {
+			t.Errorf("purged post left %d rows in %s", n, name)
+		}
+	}
+	for name, n := range countRelated(t, livePost.ID) {
+		if n != 1 {
+			t.Errorf("live post has %d rows in %s, want 1", n, name)
+		}
+	}
+
+	user := &User{Name: "bob"}
+	DB.Create(user)
+	post := &Post{Title: "by bob", AuthorID: int(user.ID)}
+	DB.Create(post)
+	DB.Create(&UserRecoveryCode{UserID: user.ID, CodeHash: "x"})
+	if _, _, err := CreateAPIToken(user.ID, "ci", nil); err != nil {
+		t.Fatal(err)
+	}
+	user.Delete()
+	if err := PurgeTrash(TrashUsers, []uint64{user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	var codes, tokens, users int
+	DB.Model(&UserRecoveryCode{}).Where("user_id = ?", user.ID).Count(&codes)
+	DB.Model(&APIToken{}).Where("user_id = ?", user.ID).Count(&tokens)
+	DB.Unscoped().Model(&User{}).Where("id = ?", user.ID).Count(&users)
+	if codes != 0 || tokens != 0 || users != 0 {
+		t.Errorf("purged user left %d recovery codes, %d tokens, %d users", codes, tokens, users)
+	}
+	if _, err := GetPostByID(post.ID); err != nil {
+		t.Errorf("post of a purged user was removed: %v", err)
+	}
+}
+
+// TestPurgeTrashRollback 关联记录删除失败时整个操作回滚
+func TestPurgeTrashRollback(t *testing.T) {
+	defer openTestDB(t, true)()
+	post := newTrashedPost(t, "trashed", true)
+	// 最后删除的关联表不存在，之前的删除应全部撤销
+	if err := DB.DropTable(&PostSlug{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	DB.LogMode(false)
+	if err := PurgeTrash(TrashPosts, []uint64{post.ID}); err == nil {
+		t.Fatal("purge should fail without the post_slugs table")
+	}
+	DB.AutoMigrate(&PostSlug{})
+	for name, n := range countRelated(t, post.ID) {
+		if name != "post_slugs" && n != 1 {
+			t.Errorf("%s has %d rows after a failed purge, want 1", name, n)
+		}
+	}
+	if counts, _ := CountTrash(); counts[TrashPosts] != 1 {
+		t.Errorf("%d posts in the trash after a failed purge, want 1", counts[TrashPosts])
+	}
+}
+
+// TestEmptyTrash 只清理删除时间早于保留期的记录
+func TestEmptyTrash(t *testing.T) {
+	defer openTestDB(t, true)()
+	now := time.Date(2019, 8, 3, 12, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+	oldPost := newTrashedPost(t, "old", true)
+	recentPost := newTrashedPost(t, "recent", true)
+	oldTag := &Tag{Name: "old"}
+	DB.Create(oldTag)
+	oldTag.Delete()
+	for model, deletedAt := range map[interface{}]time.Time{
+		oldPost:    now.Add(-retention - time.Hour),
+		recentPost: now.Add(-retention + time.Hour),
+		oldTag:     now.Add(-retention - time.Minute),
+	} {
+		if err := DB.Unscoped().Model(model).UpdateColumn("deleted_at", deletedAt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := EmptyTrash(now.Add(-retention))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 2 || purged[TrashPosts] != 1 || purged[TrashTags] != 1 {
+		t.Errorf("purged %v, want one post and one tag", purged)
+	}
+	if counts := countRelated(t, oldPost.ID); counts["posts"] != 0 {
+		t.Error("post past the retention period was kept")
+	}
+	if counts := countRelated(t, recentPost.ID); counts["posts"] != 1 || counts["comments"] != 1 {
+		t.Errorf("post within the retention period was purged: %v", counts)
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"lyanna/utils/totp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RecoveryCodeCount 每次生成的恢复码数量
+const RecoveryCodeCount = 10
+
+// UserRecoveryCode 两步验证的一次性恢复码，只保存哈希
+type UserRecoveryCode struct {
+	BaseModel
+	UserID   uint64 `gorm:"index"`
+	CodeHash string `gorm:"size:64;index"`
+	UsedAt   *time.Time
+}
+
+// EnableTOTP 启用两步验证，step 为确认时使用的时间步，返回新生成的恢复码明文
+func (user *User) EnableTOTP(secret string, step int64) ([]string, error) {
+	tx := DB.Begin()
+	err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_enabled":   true,
+		"totp_last_step": step,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep = secret, true, step
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证并删除恢复码
+func (user *User) DisableTOTP() error {
+	tx := DB.Begin()
+	err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error
+	if err == nil {
+		err = tx.Delete(UserRecoveryCode{}, "user_id=?", user.ID).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return err
+	}
+	user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep = "", false, 0
+	return nil
+}
+
+// RegenerateRecoveryCodes 作废旧的恢复码并生成新的一组
+func (user *User) RegenerateRecoveryCodes() ([]string, error) {
+	tx := DB.Begin()
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return codes, tx.Commit().Error
+}
+
+// VerifySecondFactor 校验 TOTP 验证码或恢复码，成功后验证码/恢复码不能再次使用
+func (user *User) VerifySecondFactor(code string, now time.Time) error {
+	code = strings.TrimSpace(code)
+	if !user.TOTPEnabled {
+		return totp.ErrInvalidCode
+	}
+	if len(strings.Replace(code, " ", "", -1)) == totp.Digits {
+		return user.verifyTOTP(code, now)
+	}
+	return user.useRecoveryCode(code, now)
+}
+
+func (user *User) verifyTOTP(code string, now time.Time) error {
+	step, err := totp.Validate(user.TOTPSecret, code, now)
+	if err != nil {
+		return err
+	}
+	// 同一时间步内的验证码只能使用一次
+	db := DB.Model(&User{}).Where("id=? AND totp_last_step<?", user.ID, step).UpdateColumn("totp_last_step", step)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return totp.ErrInvalidCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+func (user *User) useRecoveryCode(code string, now time.Time) error {
+	db := DB.Model(&UserRecoveryCode{}).
+		Where("user_id=? AND code_hash=? AND used_at IS NULL", user.ID, totp.HashRecoveryCode(code)).
+		UpdateColumn("used_at", now)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return totp.ErrInvalidCode
+	}
+	return nil
+}
+
+// CountUnusedRecoveryCodes 剩余可用的恢复码数量
+func CountUnusedRecoveryCodes(userID uint64) (count int, err error) {
+	err = DB.Model(&UserRecoveryCode{}).Where("user_id=? AND used_at IS NULL", userID).Count(&count).Error
+	return
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint64) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Delete(UserRecoveryCode{}, "user_id=?", userID).Error; err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		rc := &UserRecoveryCode{UserID: userID, CodeHash: totp.HashRecoveryCode(code)}
+		if err = tx.Create(rc).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
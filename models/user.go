@@ -1,30 +1,70 @@
 package models
 
+import (
+	"lyanna/utils/password"
+	"time"
+)
+
 type User struct {
 	BaseModel
 	Intro string
 	Email string
 	Name string `gorm:"unique_index"`
-	PassWord string
+	PassWord string `gorm:"column:password"`
 	GitHubUrl string
 	Active bool `gorm:"default:'1'"`
+	Role string `gorm:"size:16;default:'admin'"`
+	TOTPSecret string `gorm:"column:totp_secret"`
+	TOTPEnabled bool `gorm:"column:totp_enabled"`
+	TOTPLastStep int64 `gorm:"column:totp_last_step"`
+	DeletedAt *time.Time `sql:"index"` // 不为空时在回收站中
+	scopes []Permission // 使用 API token 认证时 token 范围内的权限，nil 表示不限制
 }
 
 func(user *User) Insert() error {
 	return 	DB.Create(user).Error
 }
 
+// Update 更新用户信息，PassWord 为空时保留原密码
 func(user *User) Update() error {
-	return DB.Model(user).Updates(map[string]interface{}{
+	attrs := map[string]interface{}{
 		"name": user.Name,
 		"email":user.Email,
-		"password": user.PassWord,
 		"active":user.Active,
-	}).Error
+	}
+	if user.Role != "" {
+		attrs["role"] = user.Role
+	}
+	if user.PassWord != "" {
+		attrs["password"] = user.PassWord
+	}
+	return DB.Model(user).Updates(attrs).Error
+}
+
+// SetPassword 使用当前配置的算法哈希明文密码，不会写入数据库
+func (user *User) SetPassword(plain string) error {
+	hash, err := password.Hash(plain)
+	if err != nil {
+		return err
+	}
+	user.PassWord = hash
+	return nil
+}
+
+// CheckPassword 校验明文密码，旧格式的哈希校验通过后会被重新哈希并保存
+func (user *User) CheckPassword(plain string) error {
+	rehash, err := password.Verify(user.PassWord, user.Name, plain)
+	if err != nil || !rehash {
+		return err
+	}
+	if err = user.SetPassword(plain); err != nil {
+		return err
+	}
+	return DB.Model(user).UpdateColumn("password", user.PassWord).Error
 }
 
 func (user *User) GetUserName(userID int) (string,error){
-	err := DB.First(&user,userID).Error
+	err := DB.Unscoped().First(&user,userID).Error
 	return user.Name,err
 }
 
@@ -48,7 +88,7 @@ func ListUsers()([]*User, error) {
 
 func GetUserNameByID(userID int)(name string,err error) {
 	var user User
-	err = DB.First(&user,"id=?",userID).Error
+	err = DB.Unscoped().First(&user,"id=?",userID).Error
 	return user.Name,err
 }
 
@@ -78,3 +118,22 @@ func GetGitUserByGid(gid interface{})(*GitHubUser,error) {
 	err := DB.First(&gitUser,"g_id=?",gid).Error
 	return &gitUser, err
 }
+
+// ListUsersPage 分页查询用户，同时返回用户总数
+func ListUsersPage(offset, limit int) ([]*User, int, error) {
+	var (
+		users []*User
+		total int
+	)
+	if err := DB.Model(&User{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := DB.Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+// Delete 把用户移到回收站，用户无法再登录，API token 随之失效；恢复码和 token 在彻底删除时才删除，
+// 用户的文章保留
+func (user *User) Delete() error {
+	return DB.Delete(user).Error
+}
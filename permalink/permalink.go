@@ -0,0 +1,140 @@
+// Package permalink 按配置的格式生成和解析文章链接
+package permalink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 常用的文章链接格式
+const (
+	PostID   = "/post/:id"
+	PostSlug = "/post/:slug"
+	DateSlug = "/:year/:month/:slug"
+)
+
+// 链接格式中可以使用的占位符
+var placeholders = map[string]bool{
+	":id":    true,
+	":slug":  true,
+	":year":  true,
+	":month": true,
+	":day":   true,
+}
+
+// Fields 生成链接需要的文章信息
+type Fields struct {
+	ID   uint64
+	Slug string
+	Time time.Time
+}
+
+// Pattern 解析后的链接格式
+type Pattern struct {
+	raw      string
+	segments []string
+}
+
+// Parse 解析链接格式，格式中必须包含 :id 或 :slug 以确定唯一的文章
+func Parse(pattern string) (*Pattern, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("permalink %q must start with /", pattern)
+	}
+	p := &Pattern{raw: pattern, segments: strings.Split(strings.Trim(pattern, "/"), "/")}
+	unique := false
+	for _, seg := range p.segments {
+		if seg == "" {
+			return nil, fmt.Errorf("permalink %q has an empty segment", pattern)
+		}
+		if strings.HasPrefix(seg, ":") {
+			if !placeholders[seg] {
+				return nil, fmt.Errorf("permalink %q has unknown placeholder %s", pattern, seg)
+			}
+			unique = unique || seg == ":id" || seg == ":slug"
+		}
+	}
+	if !unique {
+		return nil, fmt.Errorf("permalink %q must contain :id or :slug", pattern)
+	}
+	return p, nil
+}
+
+// MustParse 与 Parse 相同，格式错误时 panic
+func MustParse(pattern string) *Pattern {
+	p, err := Parse(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *Pattern) String() string {
+	return p.raw
+}
+
+// UsesSlug 链接中是否包含 slug
+func (p *Pattern) UsesSlug() bool {
+	for _, seg := range p.segments {
+		if seg == ":slug" {
+			return true
+		}
+	}
+	return false
+}
+
+// Build 生成文章的链接
+func (p *Pattern) Build(f Fields) string {
+	parts := make([]string, len(p.segments))
+	for i, seg := range p.segments {
+		switch seg {
+		case ":id":
+			parts[i] = strconv.FormatUint(f.ID, 10)
+		case ":slug":
+			parts[i] = f.Slug
+		case ":year":
+			parts[i] = f.Time.Format("2006")
+		case ":month":
+			parts[i] = f.Time.Format("01")
+		case ":day":
+			parts[i] = f.Time.Format("02")
+		default:
+			parts[i] = seg
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// Match 解析符合格式的路径，返回占位符（不含冒号）对应的值
+func (p *Pattern) Match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != len(p.segments) {
+		return nil, false
+	}
+	params := make(map[string]string, len(parts))
+	for i, seg := range p.segments {
+		part := parts[i]
+		if !strings.HasPrefix(seg, ":") {
+			if part != seg {
+				return nil, false
+			}
+			continue
+		}
+		if part == "" {
+			return nil, false
+		}
+		switch seg {
+		case ":id":
+			if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+				return nil, false
+			}
+		case ":year", ":month", ":day":
+			if _, err := strconv.Atoi(part); err != nil {
+				return nil, false
+			}
+		}
+		params[seg[1:]] = part
+	}
+	return params, true
+}
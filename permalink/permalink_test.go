@@ -0,0 +1,64 @@
+package permalink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPattern(t *testing.T) {
+	f := Fields{ID: 42, Slug: "hello-world", Time: time.Date(2019, 8, 3, 0, 0, 0, 0, time.Local)}
+	cases := []struct {
+		pattern, url string
+		params       map[string]string
+	}{
+		{PostID, "/post/42", map[string]string{"id": "42"}},
+		{PostSlug, "/post/hello-world", map[string]string{"slug": "hello-world"}},
+		{DateSlug, "/2019/08/hello-world", map[string]string{"year": "2019", "month": "08", "slug": "hello-world"}},
+	}
+	for _, c := range cases {
+		p := MustParse(c.pattern)
+		if got := p.Build(f); got != c.url {
+			t.Errorf("%s: Build = %s, want %s", c.pattern, got, c.url)
+		}
+		params, ok := p.Match(c.url)
+		if !ok {
+			t.Errorf("%s: %s not matched", c.pattern, c.url)
+			continue
+		}
+		for k, v := range c.params {
+			if params[k] != v {
+				t.Errorf("%s: param %s = %q, want %q", c.pattern, k, params[k], v)
+			}
+		}
+	}
+	if _, ok := MustParse(PostID).Match("/post/hello"); ok {
+		t.Error("non-numeric id should not match")
+	}
+	if _, ok := MustParse(DateSlug).Match("/tags"); ok {
+		t.Error("short path should not match")
+	}
+	for _, bad := range []string{"post/:id", "/:year/:month", "/post/:name"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Hello, World!":  "hello-world",
+		"  Go 1.12 发布了 ": "go-1-12-fa-bu-le",
+		"用 Gin 写博客":      "yong-gin-xie-bo-ke",
+		"2019":           "post-2019",
+		"!!!":            "",
+	}
+	for title, want := range cases {
+		if got := Slugify(title); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+	long := Slugify("word word word word word word word word word word word word word word word word word")
+	if len(long) > MaxSlugLength || long[len(long)-1] == '-' {
+		t.Errorf("long slug not truncated at a word boundary: %q", long)
+	}
+}
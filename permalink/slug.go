@@ -0,0 +1,59 @@
+package permalink
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+// MaxSlugLength slug 的最大长度，超出时在单词边界截断
+const MaxSlugLength = 80
+
+var pinyinArgs = pinyin.NewArgs()
+
+// Slugify 把标题转换为只包含小写字母、数字和连字符的 slug，汉字转换为不带声调的拼音；
+// 全是数字的 slug 会加上 post- 前缀，避免和文章 ID 混淆
+func Slugify(title string) string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word.WriteRune(r)
+		case unicode.Is(unicode.Han, r):
+			flush()
+			if py := pinyin.SinglePinyin(r, pinyinArgs); len(py) > 0 {
+				words = append(words, py[0])
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	var slug string
+	for _, w := range words {
+		next := w
+		if slug != "" {
+			next = slug + "-" + w
+		}
+		if len(next) > MaxSlugLength {
+			if slug == "" {
+				slug = w[:MaxSlugLength]
+			}
+			break
+		}
+		slug = next
+	}
+	if slug != "" && strings.Trim(slug, "0123456789") == "" {
+		slug = "post-" + slug
+	}
+	return slug
+}
@@ -0,0 +1,53 @@
+package render
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v2"
+)
+
+const frontMatterKey = "front_matter"
+
+var frontMatterDelimiter = []byte("---")
+
+// FrontMatter 去掉文档开头两行 --- 之间的 YAML 设置，解析结果通过 Document.FrontMatter 读取；
+// 不是合法的 YAML 映射时按普通 Markdown 处理
+func FrontMatter() Hook {
+	return Hook{
+		Name:  "front_matter",
+		Stage: BeforeMarkdown,
+		Apply: func(doc *Document) {
+			settings, body, ok := splitFrontMatter(doc.Source)
+			if ok {
+				doc.Meta[frontMatterKey] = settings
+				doc.Source = body
+			}
+		},
+	}
+}
+
+func splitFrontMatter(source []byte) (map[string]interface{}, []byte, bool) {
+	source = bytes.Replace(source, []byte("\r\n"), []byte("\n"), -1)
+	lines := bytes.SplitAfter(source, []byte("\n"))
+	if len(lines) < 2 || !bytes.Equal(bytes.TrimSpace(lines[0]), frontMatterDelimiter) {
+		return nil, source, false
+	}
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		if bytes.Equal(bytes.TrimSpace(line), frontMatterDelimiter) {
+			settings := make(map[string]interface{})
+			if err := yaml.Unmarshal(source[len(lines[0]):offset], &settings); err != nil {
+				return nil, source, false
+			}
+			return settings, source[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+	return nil, source, false
+}
+
+// FrontMatter 文档开头的 YAML 设置，没有时返回 nil
+func (doc *Document) FrontMatter() map[string]interface{} {
+	settings, _ := doc.Meta[frontMatterKey].(map[string]interface{})
+	return settings
+}
@@ -0,0 +1,110 @@
+package render
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+// HighlightStyle 代码高亮使用的 chroma 配色，static/css/highlight.css 由它生成
+const HighlightStyle = "github"
+
+//go:generate go run ../cmd/highlightcss -o ../static/css/highlight.css
+
+// highlightClass chroma 输出的 class 只包含小写字母、数字和空格
+var highlightClass = regexp.MustCompile(`^[a-z0-9 ]+$`)
+
+// Highlight 在服务端高亮代码块并显示行号，```go {3-5} 中的行号范围会被标记出来；
+// 输出只使用 class，由 static/css/highlight.css 提供样式
+func Highlight() Hook {
+	return Hook{
+		Name: "highlight",
+		Renderer: func(r blackfriday.Renderer, doc *Document) blackfriday.Renderer {
+			return &highlightRenderer{Renderer: r}
+		},
+		Policy: func(policy *bluemonday.Policy) {
+			policy.AllowAttrs("class").Matching(highlightClass).OnElements("pre", "code", "span")
+		},
+	}
+}
+
+type highlightRenderer struct {
+	blackfriday.Renderer
+}
+
+func (r *highlightRenderer) BlockCode(out *bytes.Buffer, text []byte, info string) {
+	lang, ranges := parseCodeInfo(info)
+	var buf bytes.Buffer
+	if err := highlightCode(&buf, string(text), lang, ranges); err != nil {
+		r.Renderer.BlockCode(out, text, info)
+		return
+	}
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	out.Write(buf.Bytes())
+	out.WriteByte('\n')
+}
+
+// parseCodeInfo 解析代码块的语言和需要标记的行号范围，例如 "go {3-5,8}"
+func parseCodeInfo(info string) (lang string, ranges [][2]int) {
+	fields := strings.Fields(info)
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "{") {
+			if i == 0 {
+				lang = field
+			}
+			continue
+		}
+		spec := strings.Trim(strings.Join(fields[i:], ""), "{}")
+		for _, part := range strings.Split(spec, ",") {
+			bounds := strings.SplitN(part, "-", 2)
+			start, err := strconv.Atoi(bounds[0])
+			if err != nil || start < 1 {
+				continue
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+					continue
+				}
+			}
+			ranges = append(ranges, [2]int{start, end})
+		}
+		break
+	}
+	return lang, ranges
+}
+
+func highlightCode(w io.Writer, code, lang string, ranges [][2]int) error {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return err
+	}
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(true),
+		chromahtml.HighlightLines(ranges),
+		chromahtml.TabWidth(4),
+	)
+	return formatter.Format(w, styles.Get(HighlightStyle), iterator)
+}
+
+// WriteHighlightCSS 输出代码高亮的样式表
+func WriteHighlightCSS(w io.Writer) error {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(true))
+	return formatter.WriteCSS(w, styles.Get(HighlightStyle))
+}
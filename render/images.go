@@ -0,0 +1,50 @@
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+)
+
+var (
+	imgTagPattern  = regexp.MustCompile(`<img\s[^>]*>`)
+	imgSrcPattern  = regexp.MustCompile(`\ssrc="([^"]*)"`)
+	imgAttrPattern = regexp.MustCompile(`\s(loading|srcset)=`)
+)
+
+// ImageSrcset 返回图片地址对应的 srcset，不能生成缩小版本的图片返回空字符串
+type ImageSrcset func(src string) string
+
+// ResponsiveImages 为过滤后的图片加上 loading="lazy"，srcset 不为空时同时加上 srcset 和 sizes；
+// 属性值由服务端生成并转义，不经过过滤策略
+func ResponsiveImages(srcset ImageSrcset, sizes string) Hook {
+	return Hook{
+		Name:  "responsive-images",
+		Stage: AfterSanitize,
+		Apply: func(doc *Document) {
+			doc.HTML = imgTagPattern.ReplaceAllFunc(doc.HTML, func(tag []byte) []byte {
+				existing := map[string]bool{}
+				for _, m := range imgAttrPattern.FindAllSubmatch(tag, -1) {
+					existing[string(m[1])] = true
+				}
+				var attrs bytes.Buffer
+				if !existing["loading"] {
+					attrs.WriteString(` loading="lazy"`)
+				}
+				if m := imgSrcPattern.FindSubmatch(tag); m != nil && !existing["srcset"] {
+					if set := srcset(html.UnescapeString(string(m[1]))); set != "" {
+						attrs.WriteString(` srcset="` + html.EscapeString(set) + `" sizes="` + html.EscapeString(sizes) + `"`)
+					}
+				}
+				end := len(tag) - 1
+				if tag[end-1] == '/' {
+					end--
+				}
+				out := make([]byte, 0, len(tag)+attrs.Len())
+				out = append(out, bytes.TrimRight(tag[:end], " ")...)
+				out = append(out, attrs.Bytes()...)
+				return append(out, tag[end:]...)
+			})
+		},
+	}
+}
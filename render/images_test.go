@@ -0,0 +1,26 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponsiveImages(t *testing.T) {
+	p := newProfile("images", Post.NewPolicy)
+	p.Use(ResponsiveImages(func(src string) string {
+		if strings.HasPrefix(src, "/uploads/") {
+			return src + "?w=320 320w"
+		}
+		return ""
+	}, "100vw"))
+	out := string(p.HTML("![a](/uploads/ab/c.png)\n\n![b](http://example.com/x.png)"))
+	if !strings.Contains(out, `src="/uploads/ab/c.png" alt="a" loading="lazy" srcset="/uploads/ab/c.png?w=320 320w" sizes="100vw"`) {
+		t.Errorf("media image not rewritten: %s", out)
+	}
+	if !strings.Contains(out, `src="http://example.com/x.png" alt="b" loading="lazy"/>`) {
+		t.Errorf("external image should only be lazy: %s", out)
+	}
+	if strings.Count(out, "srcset=") != 1 {
+		t.Errorf("unexpected srcset: %s", out)
+	}
+}
@@ -0,0 +1,74 @@
+package render
+
+import (
+	"html"
+	"unicode/utf8"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+// blackfriday 配置，所有场景共用，保证同一段 Markdown 在各处的渲染结果一致
+const (
+	commonHtmlFlags = 0 |
+		blackfriday.HTML_USE_XHTML |
+		blackfriday.HTML_USE_SMARTYPANTS |
+		blackfriday.HTML_SMARTYPANTS_FRACTIONS |
+		blackfriday.HTML_SMARTYPANTS_DASHES |
+		blackfriday.HTML_SMARTYPANTS_LATEX_DASHES |
+		blackfriday.HTML_NOFOLLOW_LINKS
+
+	commonExtensions = 0 |
+		blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
+		blackfriday.EXTENSION_TABLES |
+		blackfriday.EXTENSION_FENCED_CODE |
+		blackfriday.EXTENSION_AUTOLINK |
+		blackfriday.EXTENSION_STRIKETHROUGH |
+		blackfriday.EXTENSION_SPACE_HEADERS |
+		blackfriday.EXTENSION_HEADER_IDS |
+		blackfriday.EXTENSION_BACKSLASH_LINE_BREAK |
+		blackfriday.EXTENSION_DEFINITION_LISTS
+)
+
+// ExcerptLength 文章摘要保留的字数
+const ExcerptLength = 300
+
+// 各场景的 Profile
+var (
+	// Post 文章正文
+	Post = newProfile("post", bluemonday.UGCPolicy, FrontMatter(), Highlight(), TOC())
+	// Comment 评论及评论预览
+	Comment = newProfile("comment", bluemonday.UGCPolicy, Highlight())
+	// Excerpt 文章列表中的摘要，去掉全部标签后截取前 ExcerptLength 个字
+	Excerpt = newProfile("excerpt", bluemonday.StrictPolicy, FrontMatter(), Truncate(ExcerptLength))
+	// Feed 订阅源中的文章全文
+	Feed = newProfile("feed", bluemonday.UGCPolicy, FrontMatter(), Highlight())
+	// Text 纯文本，用于建立搜索索引
+	Text = newProfile("text", bluemonday.StrictPolicy, FrontMatter())
+)
+
+func newProfile(name string, policy func() *bluemonday.Policy, hooks ...Hook) *Profile {
+	return &Profile{
+		Name:       name,
+		HTMLFlags:  commonHtmlFlags,
+		Extensions: commonExtensions,
+		NewPolicy:  policy,
+		hooks:      hooks,
+	}
+}
+
+// Truncate 把已去掉标签的文本截取为前 n 个字并加上省略号，
+// 先还原转义字符再截取，避免把 &amp; 之类的实体截断
+func Truncate(n int) Hook {
+	return Hook{
+		Name:  "truncate",
+		Stage: AfterSanitize,
+		Apply: func(doc *Document) {
+			text := plainText(doc.HTML)
+			if utf8.RuneCountInString(text) > n {
+				text = string([]rune(text)[:n])
+			}
+			doc.HTML = []byte(html.EscapeString(text) + "...")
+		},
+	}
+}
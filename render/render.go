@@ -0,0 +1,110 @@
+// Package render 统一的 Markdown 渲染：每种场景对应一个 Profile，
+// 各自有过滤策略和扩展钩子，文章、评论、摘要和订阅源都经由这里渲染
+package render
+
+import (
+	"html"
+	"html/template"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+// Stage 钩子执行的阶段
+type Stage int
+
+const (
+	// BeforeMarkdown 转换前处理 Markdown 源文本
+	BeforeMarkdown Stage = iota
+	// BeforeSanitize 转换后、过滤前处理 HTML，生成的标签和属性需要在 Hook.Policy 中放行
+	BeforeSanitize
+	// AfterSanitize 过滤后处理 HTML，钩子自己负责输出的安全
+	AfterSanitize
+)
+
+// Document 一次渲染的中间结果，钩子修改 Source 或 HTML，附加数据记录在 Meta 中
+type Document struct {
+	Source []byte
+	HTML   []byte
+	Meta   map[string]interface{}
+}
+
+// Hook 扩展钩子：Apply 在 Stage 阶段处理文档，Renderer 包装 blackfriday 的渲染器，
+// Policy 调整过滤策略，不需要的项留空即可
+type Hook struct {
+	Name     string
+	Stage    Stage
+	Apply    func(doc *Document)
+	Renderer func(r blackfriday.Renderer, doc *Document) blackfriday.Renderer
+	Policy   func(policy *bluemonday.Policy)
+}
+
+// Profile 一种渲染场景
+type Profile struct {
+	Name       string
+	HTMLFlags  int
+	Extensions int
+	NewPolicy  func() *bluemonday.Policy
+	hooks      []Hook
+}
+
+// Use 追加扩展钩子，同一阶段按添加顺序执行；只应在启动时调用
+func (p *Profile) Use(hooks ...Hook) {
+	p.hooks = append(p.hooks, hooks...)
+}
+
+// Hooks 已添加的扩展钩子
+func (p *Profile) Hooks() []Hook {
+	return p.hooks
+}
+
+func (p *Profile) policy() *bluemonday.Policy {
+	policy := p.NewPolicy()
+	for _, hook := range p.hooks {
+		if hook.Policy != nil {
+			hook.Policy(policy)
+		}
+	}
+	return policy
+}
+
+func (p *Profile) run(stage Stage, doc *Document) {
+	for _, hook := range p.hooks {
+		if hook.Apply != nil && hook.Stage == stage {
+			hook.Apply(doc)
+		}
+	}
+}
+
+// Render 按 Profile 渲染 Markdown
+func (p *Profile) Render(source string) *Document {
+	doc := &Document{Source: []byte(source), Meta: make(map[string]interface{})}
+	p.run(BeforeMarkdown, doc)
+	renderer := blackfriday.HtmlRenderer(p.HTMLFlags, "", "")
+	for _, hook := range p.hooks {
+		if hook.Renderer != nil {
+			renderer = hook.Renderer(renderer, doc)
+		}
+	}
+	doc.HTML = blackfriday.Markdown(doc.Source, renderer, p.Extensions)
+	p.run(BeforeSanitize, doc)
+	doc.HTML = p.policy().SanitizeBytes(doc.HTML)
+	p.run(AfterSanitize, doc)
+	return doc
+}
+
+// HTML 渲染 Markdown 并返回可以直接输出到模板的 HTML
+func (p *Profile) HTML(source string) template.HTML {
+	return template.HTML(p.Render(source).HTML)
+}
+
+// Text 渲染 Markdown 并转换为纯文本，连续的空白合并为一个空格；用于过滤全部标签的 Profile
+func (p *Profile) Text(source string) string {
+	return plainText(p.Render(source).HTML)
+}
+
+func plainText(sanitized []byte) string {
+	text := html.UnescapeString(string(sanitized))
+	return strings.Join(strings.Fields(text), " ")
+}
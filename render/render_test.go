@@ -0,0 +1,170 @@
+package render
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+func TestProfilesSanitize(t *testing.T) {
+	source := "# Title\n\nhello <script>alert(1)</script> [link](http://example.com)"
+	for _, p := range []*Profile{Post, Comment, Feed} {
+		out := string(p.HTML(source))
+		if strings.Contains(out, "<script") {
+			t.Errorf("%s: script not removed: %s", p.Name, out)
+		}
+		if !strings.Contains(out, "<h1") || !strings.Contains(out, `rel="nofollow"`) {
+			t.Errorf("%s: unexpected output: %s", p.Name, out)
+		}
+	}
+	// 除标题锚点外，文章和评论的渲染结果相同
+	body := "hello *world*\n\n```go\nfunc main() {}\n```\n"
+	if Post.HTML(body) != Comment.HTML(body) {
+		t.Error("posts and comments should render the same way")
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := string(Excerpt.HTML("**a & b**\n\n<i>c</i>")); got != "a &amp; b c..." {
+		t.Errorf("Excerpt = %q", got)
+	}
+	// 截取按字计算，不会截断转义字符
+	got := string(Excerpt.HTML(strings.Repeat("中", ExcerptLength-1) + "&&"))
+	if want := strings.Repeat("中", ExcerptLength-1) + "&amp;..."; got != want {
+		t.Errorf("Excerpt = %q, want %q", got, want)
+	}
+	if got := Text.Text("Go & *Gin*\n\n- 中间件"); got != "Go & Gin 中间件" {
+		t.Errorf("Text = %q", got)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var stages []string
+	record := func(name string, stage Stage) Hook {
+		return Hook{Name: name, Stage: stage, Apply: func(doc *Document) { stages = append(stages, name) }}
+	}
+	p := newProfile("test", bluemonday.UGCPolicy,
+		record("after", AfterSanitize), record("before", BeforeMarkdown), record("markup", BeforeSanitize))
+	p.Use(Hook{
+		Name:  "mark",
+		Stage: BeforeSanitize,
+		Apply: func(doc *Document) {
+			doc.HTML = bytes.Replace(doc.HTML, []byte("<p>"), []byte(`<p class="lead" style="x">`), 1)
+			doc.Meta["marked"] = true
+		},
+		Policy: func(policy *bluemonday.Policy) {
+			policy.AllowAttrs("class").OnElements("p")
+		},
+	})
+	doc := p.Render("text")
+	if want := []string{"before", "markup", "after"}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+	if got := string(doc.HTML); got != "<p class=\"lead\">text</p>\n" {
+		t.Errorf("HTML = %q", got)
+	}
+	if doc.Meta["marked"] != true {
+		t.Error("hook meta lost")
+	}
+	// 钩子只影响所属的 Profile
+	if out := string(Post.HTML("text")); out != "<p>text</p>\n" {
+		t.Errorf("Post = %q", out)
+	}
+}
+
+func TestParseCodeInfo(t *testing.T) {
+	cases := map[string]struct {
+		lang   string
+		ranges [][2]int
+	}{
+		"":              {"", nil},
+		"go":            {"go", nil},
+		"go {3-5}":      {"go", [][2]int{{3, 5}}},
+		"go { 1, 4-6 }": {"go", [][2]int{{1, 1}, {4, 6}}},
+		"{2}":           {"", [][2]int{{2, 2}}},
+		"go {5-3,x,0}":  {"go", nil},
+	}
+	for info, want := range cases {
+		lang, ranges := parseCodeInfo(info)
+		if lang != want.lang || !reflect.DeepEqual(ranges, want.ranges) {
+			t.Errorf("parseCodeInfo(%q) = %q, %v", info, lang, ranges)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	out := string(Post.HTML("```go {2}\npackage main\nfunc main() {}\n```\n"))
+	for _, want := range []string{
+		`<pre class="chroma">`,
+		`<span class="line"><span class="ln">1</span><span class="cl"><span class="kn">package</span>`,
+		`<span class="line hl"><span class="ln">2</span>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("highlighted code should contain %q:\n%s", want, out)
+		}
+	}
+	// 代码中的 HTML 被转义，手写的 class 只能使用高亮样式允许的字符
+	out = string(Comment.HTML("```\n<script>x</script>\n```\n\n<span class=\"a;b\" style=\"x\">y</span>"))
+	if strings.Contains(out, "<script") || strings.Contains(out, "a;b") || strings.Contains(out, "style") {
+		t.Errorf("unsafe output: %s", out)
+	}
+	if !strings.Contains(out, "&lt;script&gt;") {
+		t.Errorf("code should be escaped: %s", out)
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	source := "---\ntoc: false\ntags: [go]\n---\n## Intro\n\nbody"
+	doc := Post.Render(source)
+	if doc.FrontMatter()["toc"] != false || strings.Contains(string(doc.HTML), "toc:") {
+		t.Errorf("front matter not parsed: %v %s", doc.FrontMatter(), doc.HTML)
+	}
+	if doc.TOC() != nil {
+		t.Errorf("toc: false should disable the TOC: %v", doc.TOC())
+	}
+	if !strings.Contains(string(doc.HTML), `<h2 id="intro">`) {
+		t.Errorf("anchors should be kept without a TOC: %s", doc.HTML)
+	}
+	if got := string(Excerpt.HTML(source)); got != "Intro body..." {
+		t.Errorf("Excerpt = %q", got)
+	}
+	// 不是 YAML 映射时按普通 Markdown 处理
+	for _, source := range []string{"---\nnot: [yaml\n---\ntext", "---\n\ntext"} {
+		if doc := Post.Render(source); doc.FrontMatter() != nil {
+			t.Errorf("%q parsed as front matter: %v", source, doc.FrontMatter())
+		}
+	}
+}
+
+func TestTOC(t *testing.T) {
+	doc := Post.Render("# 安装 Go\n\n## Step *one*\n\n#### Deep\n\n## Step one\n\n# Usage {#custom}\n\n## ???\n")
+	out := string(doc.HTML)
+	for _, want := range []string{
+		`<h1 id="安装-go">安装 Go<a class="anchor" href="#%E5%AE%89%E8%A3%85-go"`,
+		`<h2 id="step-one">Step <em>one</em><a class="anchor" href="#step-one"`,
+		`<h2 id="step-one-1">`,
+		`<h1 id="custom">`,
+		`<h2 id="section">`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output should contain %q:\n%s", want, out)
+		}
+	}
+	want := []*Heading{
+		{Level: 1, ID: "安装-go", Title: "安装 Go", Children: []*Heading{
+			{Level: 2, ID: "step-one", Title: "Step one", Children: []*Heading{
+				{Level: 4, ID: "deep", Title: "Deep"},
+			}},
+			{Level: 2, ID: "step-one-1", Title: "Step one"},
+		}},
+		{Level: 1, ID: "custom", Title: "Usage", Children: []*Heading{
+			{Level: 2, ID: "section", Title: "???"},
+		}},
+	}
+	if !reflect.DeepEqual(doc.TOC(), want) {
+		t.Errorf("TOC mismatch:\n%s", out)
+	}
+}
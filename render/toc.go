@@ -0,0 +1,140 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+const tocKey = "toc"
+
+// anchorPattern 标题 ID 只包含字母、数字、下划线和连字符，中文标题保留原文
+var anchorPattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// Heading 目录中的一个标题，Children 为其下更低级别的标题
+type Heading struct {
+	Level    int        `json:"level"`
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Children []*Heading `json:"children,omitempty"`
+}
+
+// TOC 为标题生成唯一的 ID 和锚点链接，并按标题层级建立目录，通过 Document.TOC 读取；
+// front matter 中设置 toc: false 时不生成目录，锚点照常保留
+func TOC() Hook {
+	return Hook{
+		Name: "toc",
+		Renderer: func(r blackfriday.Renderer, doc *Document) blackfriday.Renderer {
+			return &tocRenderer{
+				Renderer: r,
+				doc:      doc,
+				enabled:  doc.FrontMatter()["toc"] != false,
+				ids:      make(map[string]bool),
+			}
+		},
+		Policy: func(policy *bluemonday.Policy) {
+			policy.AllowAttrs("id").Matching(anchorPattern).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+			policy.AllowAttrs("class").Matching(regexp.MustCompile(`^anchor$`)).OnElements("a")
+		},
+	}
+}
+
+type tocRenderer struct {
+	blackfriday.Renderer
+	doc     *Document
+	enabled bool
+	ids     map[string]bool
+	stack   []*Heading
+	roots   []*Heading
+}
+
+func (r *tocRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	// 先渲染标题内容，再根据内容生成 ID
+	marker := out.Len()
+	if !text() {
+		out.Truncate(marker)
+		return
+	}
+	content := append([]byte(nil), out.Bytes()[marker:]...)
+	out.Truncate(marker)
+
+	title := headingText(content)
+	if id == "" || !anchorPattern.MatchString(id) {
+		id = anchorName(title)
+	}
+	id = r.uniqueID(id)
+
+	if out.Len() > 0 {
+		out.WriteByte('\n')
+	}
+	anchor := html.EscapeString(id)
+	fmt.Fprintf(out, `<h%d id="%s">`, level, anchor)
+	out.Write(content)
+	fmt.Fprintf(out, `<a class="anchor" href="#%s">#</a></h%d>`+"\n", anchor, level)
+
+	if r.enabled {
+		r.add(&Heading{Level: level, ID: id, Title: title})
+	}
+}
+
+func (r *tocRenderer) uniqueID(id string) string {
+	unique := id
+	for i := 1; r.ids[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	r.ids[unique] = true
+	return unique
+}
+
+// add 把标题挂到最近的更高级别标题下
+func (r *tocRenderer) add(heading *Heading) {
+	for len(r.stack) > 0 && r.stack[len(r.stack)-1].Level >= heading.Level {
+		r.stack = r.stack[:len(r.stack)-1]
+	}
+	if len(r.stack) == 0 {
+		r.roots = append(r.roots, heading)
+	} else {
+		parent := r.stack[len(r.stack)-1]
+		parent.Children = append(parent.Children, heading)
+	}
+	r.stack = append(r.stack, heading)
+	r.doc.Meta[tocKey] = r.roots
+}
+
+// headingText 去掉标题中的标签，得到目录显示的纯文本
+func headingText(content []byte) string {
+	return plainText(bluemonday.StrictPolicy().SanitizeBytes(content))
+}
+
+// anchorName 把标题转换为 ID：字母转为小写，其余字符合并为一个连字符
+func anchorName(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// TOC 文档的目录，没有标题或关闭目录时返回 nil
+func (doc *Document) TOC() []*Heading {
+	headings, _ := doc.Meta[tocKey].([]*Heading)
+	return headings
+}
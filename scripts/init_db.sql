@@ -7,10 +7,16 @@ USE lyanna;
 -- 删除已存在的表（如果存在）
 DROP TABLE IF EXISTS react_items;
 DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS post_slugs;
+DROP TABLE IF EXISTS post_revisions;
 DROP TABLE IF EXISTS post_tags;
 DROP TABLE IF EXISTS posts;
 DROP TABLE IF EXISTS tags;
 DROP TABLE IF EXISTS github_users;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS media;
 DROP TABLE IF EXISTS users;
 
 -- 创建用户表
@@ -23,7 +29,67 @@ CREATE TABLE users (
     name VARCHAR(255) NOT NULL UNIQUE,
     password VARCHAR(255) NOT NULL,
     github_url VARCHAR(255),
-    active BOOLEAN DEFAULT TRUE
+    active BOOLEAN DEFAULT TRUE,
+    role VARCHAR(16) DEFAULT 'admin',
+    totp_secret VARCHAR(64) DEFAULT '',
+    totp_enabled BOOLEAN DEFAULT FALSE,
+    totp_last_step BIGINT DEFAULT 0,
+    deleted_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_deleted_at (deleted_at)
+);
+
+-- 创建两步验证恢复码表
+CREATE TABLE user_recovery_codes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_user_id (user_id),
+    INDEX idx_code_hash (code_hash)
+);
+
+-- 创建个人 API token 表
+CREATE TABLE api_tokens (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    hint VARCHAR(16) NOT NULL,
+    scopes VARCHAR(255) NOT NULL DEFAULT '',
+    last_used_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_user_id (user_id),
+    UNIQUE KEY idx_token_hash (token_hash)
+);
+
+-- 创建媒体库表
+CREATE TABLE media (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    hash CHAR(64) NOT NULL,
+    storage_key VARCHAR(128) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    content_type VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    width INT NOT NULL DEFAULT 0,
+    height INT NOT NULL DEFAULT 0,
+    uploader_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    INDEX idx_uploader_id (uploader_id),
+    INDEX idx_storage_key (storage_key),
+    UNIQUE KEY idx_hash (hash)
+);
+
+-- 创建站点设置表
+CREATE TABLE settings (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    value TEXT
 );
 
 -- 创建GitHub用户表
@@ -44,7 +110,9 @@ CREATE TABLE tags (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    name VARCHAR(255) NOT NULL UNIQUE
+    name VARCHAR(255) NOT NULL UNIQUE,
+    deleted_at TIMESTAMP NULL DEFAULT NULL,
+    INDEX idx_deleted_at (deleted_at)
 );
 
 -- 创建文章表
@@ -59,8 +127,14 @@ CREATE TABLE posts (
     content LONGTEXT,
     can_comment BOOLEAN DEFAULT TRUE,
     published BOOLEAN DEFAULT FALSE,
+    publish_at DATETIME NULL,
+    unpublish_at DATETIME NULL,
+    deleted_at TIMESTAMP NULL DEFAULT NULL,
     INDEX idx_author_id (author_id),
     INDEX idx_published (published),
+    INDEX idx_publish_at (publish_at),
+    INDEX idx_unpublish_at (unpublish_at),
+    INDEX idx_deleted_at (deleted_at),
     INDEX idx_slug (slug),
     INDEX idx_created_at (created_at)
 );
@@ -77,6 +151,30 @@ CREATE TABLE post_tags (
     INDEX idx_tag_id (tag_id)
 );
 
+-- 创建文章历史版本表
+CREATE TABLE post_revisions (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    post_id BIGINT UNSIGNED NOT NULL,
+    editor_id BIGINT UNSIGNED DEFAULT 0,
+    title VARCHAR(255),
+    slug VARCHAR(255),
+    summary TEXT,
+    content LONGTEXT,
+    INDEX idx_post_id (post_id)
+);
+
+-- 创建文章旧 slug 表
+CREATE TABLE post_slugs (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    post_id BIGINT UNSIGNED NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    INDEX idx_post_id (post_id)
+);
+
 -- 创建评论表
 CREATE TABLE comments (
     id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
@@ -86,8 +184,15 @@ CREATE TABLE comments (
     post_id BIGINT NOT NULL,
     content LONGTEXT,
     ref_id BIGINT DEFAULT 0,
+    status VARCHAR(16) DEFAULT 'approved',
+    trained VARCHAR(8) DEFAULT '',
+    trained_sample TEXT,
+    deleted_at TIMESTAMP NULL DEFAULT NULL,
     INDEX idx_post_id (post_id),
-    INDEX idx_github_id (github_id)
+    INDEX idx_github_id (github_id),
+    INDEX idx_ref_id (ref_id),
+    INDEX idx_status (status),
+    INDEX idx_deleted_at (deleted_at)
 );
 
 -- 创建反应表
@@ -96,15 +201,17 @@ CREATE TABLE react_items (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     post_id BIGINT NOT NULL,
+    git_hub_id BIGINT NOT NULL,
     reaction_type BIGINT NOT NULL,
+    UNIQUE KEY idx_post_user_reaction (post_id, git_hub_id, reaction_type),
     INDEX idx_post_id (post_id)
 );
 
 -- 插入初始数据
 
 -- 插入默认管理员用户
-INSERT INTO users (name, email, password, intro, active) VALUES 
-('admin', 'admin@lyanna.com', '$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi', '系统管理员', TRUE);
+INSERT INTO users (name, email, password, intro, active, role) VALUES 
+('admin', 'admin@lyanna.com', '$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi', '系统管理员', TRUE, 'admin');
 
 -- 插入示例标签
 INSERT INTO tags (name) VALUES 
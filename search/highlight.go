@@ -0,0 +1,97 @@
+package search
+
+import (
+	"html/template"
+	"strings"
+)
+
+type span struct {
+	start, end int
+}
+
+// matches 找出 text 中属于 terms 的词，相互重叠或相邻的位置合并为一段
+func matches(text string, terms []string) []span {
+	want := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		want[term] = true
+	}
+	var spans []span
+	for _, token := range Tokenize(text) {
+		if !want[token.Term] {
+			continue
+		}
+		if last := len(spans) - 1; last >= 0 && token.Start <= spans[last].end {
+			if token.End > spans[last].end {
+				spans[last].end = token.End
+			}
+			continue
+		}
+		spans = append(spans, span{token.Start, token.End})
+	}
+	return spans
+}
+
+// window 选出 maxRunes 字内包含关键字最多的片段
+func window(length int, spans []span, maxRunes int) (start, end int) {
+	if maxRunes <= 0 || length <= maxRunes {
+		return 0, length
+	}
+	best, bestCount := 0, 0
+	for i := range spans {
+		count := 0
+		for _, s := range spans[i:] {
+			if s.end > spans[i].start+maxRunes {
+				break
+			}
+			count++
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+	if len(spans) > 0 {
+		// 关键字前保留一小段上下文
+		start = spans[best].start - maxRunes/5
+	}
+	if start+maxRunes > length {
+		start = length - maxRunes
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start, start + maxRunes
+}
+
+// Highlight 转义 text 并用 <em class="search-keyword"> 标出 terms，
+// maxRunes 大于 0 时只截取关键字最集中的一段，截断处用省略号表示
+func Highlight(text string, terms []string, maxRunes int) template.HTML {
+	runes := []rune(text)
+	spans := matches(text, terms)
+	start, end := window(len(runes), spans, maxRunes)
+	var buf strings.Builder
+	if start > 0 {
+		buf.WriteString("…")
+	}
+	pos := start
+	for _, s := range spans {
+		if s.end <= start || s.start >= end {
+			continue
+		}
+		if s.start < pos {
+			s.start = pos
+		}
+		if s.end > end {
+			s.end = end
+		}
+		buf.WriteString(template.HTMLEscapeString(string(runes[pos:s.start])))
+		buf.WriteString(`<em class="search-keyword">`)
+		buf.WriteString(template.HTMLEscapeString(string(runes[s.start:s.end])))
+		buf.WriteString(`</em>`)
+		pos = s.end
+	}
+	buf.WriteString(template.HTMLEscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		buf.WriteString("…")
+	}
+	return template.HTML(buf.String())
+}
@@ -0,0 +1,191 @@
+// Package search 文章全文检索：内存中的倒排索引，支持中日韩文字的二元切分、BM25 排序和关键字高亮
+package search
+
+import (
+	"html/template"
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 参数
+const (
+	k1 = 1.2
+	b  = 0.75
+	// titleWeight 标题中的词按出现 titleWeight 次计算
+	titleWeight = 3
+	// SnippetLength 摘要片段的最大字数
+	SnippetLength = 120
+)
+
+// Document 被索引的文章
+type Document struct {
+	ID    uint64
+	Title string
+	Body  string // 纯文本正文
+}
+
+// Hit 一条搜索结果，Title 和 Snippet 中的关键字已高亮
+type Hit struct {
+	ID      uint64        `json:"id"`
+	Score   float64       `json:"score"`
+	Title   template.HTML `json:"title"`
+	Snippet template.HTML `json:"snippet"`
+}
+
+type entry struct {
+	doc    Document
+	terms  map[string]int
+	length int
+}
+
+// Index 倒排索引，可以并发使用
+type Index struct {
+	mu          sync.RWMutex
+	docs        map[uint64]*entry
+	postings    map[string]map[uint64]int
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[uint64]*entry),
+		postings: make(map[string]map[uint64]int),
+	}
+}
+
+// Len 已索引的文章数
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// IDs 已索引的文章 ID
+func (idx *Index) IDs() []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	ids := make([]uint64, 0, len(idx.docs))
+	for id := range idx.docs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Add 索引文章，已存在时替换
+func (idx *Index) Add(doc Document) {
+	e := &entry{doc: doc, terms: make(map[string]int)}
+	for _, token := range Tokenize(doc.Title) {
+		e.terms[token.Term] += titleWeight
+		e.length += titleWeight
+	}
+	for _, token := range Tokenize(doc.Body) {
+		e.terms[token.Term]++
+		e.length++
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(doc.ID)
+	idx.docs[doc.ID] = e
+	idx.totalLength += e.length
+	for term, tf := range e.terms {
+		posting, ok := idx.postings[term]
+		if !ok {
+			posting = make(map[uint64]int)
+			idx.postings[term] = posting
+		}
+		posting[doc.ID] = tf
+	}
+}
+
+// Remove 从索引中删除文章
+func (idx *Index) Remove(id uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id uint64) {
+	e, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range e.terms {
+		posting := idx.postings[term]
+		delete(posting, id)
+		if len(posting) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLength -= e.length
+	delete(idx.docs, id)
+}
+
+type scored struct {
+	entry *entry
+	score float64
+}
+
+// Search 返回包含全部查询词的文章，按 BM25 得分从高到低排列，
+// 同分时较新的文章（ID 较大）在前；total 为符合条件的文章总数
+func (idx *Index) Search(query string, offset, limit int) (hits []Hit, total int) {
+	terms := QueryTerms(query)
+	if len(terms) == 0 {
+		return nil, 0
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	postings := make([]map[uint64]int, len(terms))
+	for i, term := range terms {
+		postings[i] = idx.postings[term]
+		if len(postings[i]) == 0 {
+			return nil, 0
+		}
+	}
+	// 从最短的倒排表开始求交集
+	sort.Slice(postings, func(i, j int) bool { return len(postings[i]) < len(postings[j]) })
+	n := float64(len(idx.docs))
+	avgLength := float64(idx.totalLength) / n
+	var results []scored
+	for id := range postings[0] {
+		e := idx.docs[id]
+		var score float64
+		for _, posting := range postings {
+			tf, ok := posting[id]
+			if !ok {
+				score = -1
+				break
+			}
+			df := float64(len(posting))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := k1 * (1 - b + b*float64(e.length)/avgLength)
+			score += idf * float64(tf) * (k1 + 1) / (float64(tf) + norm)
+		}
+		if score >= 0 {
+			results = append(results, scored{e, score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].entry.doc.ID > results[j].entry.doc.ID
+	})
+	total = len(results)
+	if offset >= total {
+		return nil, total
+	}
+	end := offset + limit
+	if limit < 0 || end > total {
+		end = total
+	}
+	for _, r := range results[offset:end] {
+		hits = append(hits, Hit{
+			ID:      r.entry.doc.ID,
+			Score:   r.score,
+			Title:   Highlight(r.entry.doc.Title, terms, 0),
+			Snippet: Highlight(r.entry.doc.Body, terms, SnippetLength),
+		})
+	}
+	return hits, total
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var got []string
+	for _, token := range Tokenize("Go 全文搜索") {
+		got = append(got, token.Term)
+	}
+	want := []string{"go", "全", "全文", "文", "文搜", "搜", "搜索", "索"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+	if tokens := Tokenize("Go 全文"); tokens[2] != (Token{Term: "全文", Start: 3, End: 5}) {
+		t.Errorf("token offsets should be rune indexes: %v", tokens)
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	cases := map[string][]string{
+		"Gin 中间件":       {"gin", "中间", "间件"},
+		"博":             {"博"},
+		"redis 博 redis": {"redis", "博"},
+		"  !! ":         nil,
+	}
+	for query, want := range cases {
+		if got := QueryTerms(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryTerms(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func testIndex() *Index {
+	idx := NewIndex()
+	idx.Add(Document{ID: 1, Title: "Gin 中间件", Body: "介绍 gin 的中间件机制，以及如何编写自己的中间件。"})
+	idx.Add(Document{ID: 2, Title: "Redis 分布式锁", Body: "用 redis 实现分布式锁，顺便提到 gin 的中间件。"})
+	idx.Add(Document{ID: 3, Title: "读书笔记", Body: "最近读了几本书。"})
+	return idx
+}
+
+func ids(hits []Hit) []uint64 {
+	var out []uint64
+	for _, hit := range hits {
+		out = append(out, hit.ID)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	idx := testIndex()
+	hits, total := idx.Search("中间件", 0, 10)
+	if total != 2 || !reflect.DeepEqual(ids(hits), []uint64{1, 2}) {
+		t.Fatalf("Search(中间件) = %v, total %d; title match should rank first", ids(hits), total)
+	}
+	if hits, total := idx.Search("gin 分布式", 0, 10); total != 1 || hits[0].ID != 2 {
+		t.Errorf("all query terms should be required: %v", ids(hits))
+	}
+	if _, total := idx.Search("间中", 0, 10); total != 0 {
+		t.Errorf("bigrams must appear in order, total = %d", total)
+	}
+	if hits, total := idx.Search("书", 0, 10); total != 1 || hits[0].ID != 3 {
+		t.Errorf("single CJK character should match unigrams: %v", ids(hits))
+	}
+	if hits, total := idx.Search("中间件", 1, 1); total != 2 || !reflect.DeepEqual(ids(hits), []uint64{2}) {
+		t.Errorf("paging = %v, total %d", ids(hits), total)
+	}
+
+	idx.Add(Document{ID: 1, Title: "改名了", Body: "没有关键字"})
+	if hits, _ := idx.Search("中间件", 0, 10); !reflect.DeepEqual(ids(hits), []uint64{2}) {
+		t.Errorf("re-adding a document should replace it: %v", ids(hits))
+	}
+	idx.Remove(2)
+	if _, total := idx.Search("中间件", 0, 10); total != 0 || idx.Len() != 2 {
+		t.Errorf("removed document still found, len = %d", idx.Len())
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := string(Highlight("<b>Gin</b> 的中间件", QueryTerms("gin 中间件"), 0))
+	want := `&lt;b&gt;<em class="search-keyword">Gin</em>&lt;/b&gt; 的<em class="search-keyword">中间件</em>`
+	if got != want {
+		t.Errorf("Highlight = %s, want %s", got, want)
+	}
+
+	body := strings.Repeat("无关内容。", 40) + "这里讲 redis 锁。" + strings.Repeat("其他内容。", 40)
+	snippet := string(Highlight(body, QueryTerms("redis"), 30))
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") ||
+		!strings.Contains(snippet, `<em class="search-keyword">redis</em>`) {
+		t.Errorf("snippet should be cut around the keyword: %s", snippet)
+	}
+	if n := len([]rune(strings.NewReplacer(`<em class="search-keyword">`, "", "</em>", "", "…", "").Replace(snippet))); n != 30 {
+		t.Errorf("snippet length = %d, want 30", n)
+	}
+	if got := string(Highlight("短文", []string{"redis"}, 30)); got != "短文" {
+		t.Errorf("Highlight without match = %s", got)
+	}
+}
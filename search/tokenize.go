@@ -0,0 +1,25 @@
+package search
+
+import "lyanna/utils/tokenize"
+
+// Token 切分出的词及其在原文中的位置，Start 和 End 为 rune 下标
+type Token = tokenize.Token
+
+// Tokenize 切分索引文本：英文和数字按单词切分并转为小写，
+// 中日韩文字同时记录单字和相邻两个字，单字用于只输入一个字的查询
+func Tokenize(text string) []Token {
+	return tokenize.Split(text, true)
+}
+
+// QueryTerms 切分查询语句并去重：中日韩文字只有一个字时按单字查询，否则按相邻两个字查询
+func QueryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, token := range tokenize.Split(query, false) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,205 @@
+package spam
+
+import (
+	"lyanna/utils/tokenize"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Class 训练样本的类别
+type Class int
+
+const (
+	Ham Class = iota
+	Spam
+)
+
+// Stats 分类所需的统计数据，数组下标为 Class
+type Stats struct {
+	Docs   [2]int
+	Totals [2]int
+	Vocab  int
+	Counts map[string][2]int
+}
+
+// Store 保存分类器的词频统计
+type Store interface {
+	Add(class Class, tokens map[string]int) error
+	// Remove 撤销一次 Add
+	Remove(class Class, tokens map[string]int) error
+	Stats(tokens []string) (*Stats, error)
+}
+
+// Bayes 多项式朴素贝叶斯分类器
+type Bayes struct {
+	Store Store
+	// Threshold 判定为垃圾评论的最低概率
+	Threshold float64
+	// MinDocs 每个类别至少需要的训练样本数，不足时一律判定为正常评论
+	MinDocs int
+}
+
+func NewBayes(store Store, threshold float64, minDocs int) *Bayes {
+	if threshold <= 0 || threshold >= 1 {
+		threshold = 0.9
+	}
+	return &Bayes{Store: store, Threshold: threshold, MinDocs: minDocs}
+}
+
+func (b *Bayes) IsSpam(comment *Comment) (bool, error) {
+	p, err := b.Score(comment)
+	if err != nil {
+		return false, err
+	}
+	return p >= b.Threshold, nil
+}
+
+func (b *Bayes) Learn(comment *Comment, spam bool) error {
+	return b.Store.Add(classOf(spam), countTokens(Tokenize(commentText(comment))))
+}
+
+func (b *Bayes) Unlearn(comment *Comment, spam bool) error {
+	return b.Store.Remove(classOf(spam), countTokens(Tokenize(commentText(comment))))
+}
+
+func classOf(spam bool) Class {
+	if spam {
+		return Spam
+	}
+	return Ham
+}
+
+// Score 返回评论为垃圾评论的概率，样本不足时返回 0
+func (b *Bayes) Score(comment *Comment) (float64, error) {
+	counts := countTokens(Tokenize(commentText(comment)))
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	tokens := make([]string, 0, len(counts))
+	for token := range counts {
+		tokens = append(tokens, token)
+	}
+	stats, err := b.Store.Stats(tokens)
+	if err != nil {
+		return 0, err
+	}
+	minDocs := b.MinDocs
+	if minDocs < 1 {
+		minDocs = 1
+	}
+	if stats.Docs[Spam] < minDocs || stats.Docs[Ham] < minDocs {
+		return 0, nil
+	}
+	docs := float64(stats.Docs[Spam] + stats.Docs[Ham])
+	vocab := float64(stats.Vocab)
+	var logp [2]float64
+	for _, class := range []Class{Ham, Spam} {
+		logp[class] = math.Log(float64(stats.Docs[class]) / docs)
+		denominator := float64(stats.Totals[class]) + vocab
+		for token, n := range counts {
+			// 拉普拉斯平滑
+			count := float64(stats.Counts[token][class]) + 1
+			logp[class] += float64(n) * math.Log(count/denominator)
+		}
+	}
+	return 1 / (1 + math.Exp(logp[Ham]-logp[Spam])), nil
+}
+
+func commentText(comment *Comment) string {
+	text := comment.Content
+	if comment.AuthorURL != "" {
+		text += " " + comment.AuthorURL
+	}
+	if comment.Author != "" {
+		text += " author:" + comment.Author
+	}
+	return text
+}
+
+func countTokens(tokens []string) map[string]int {
+	counts := make(map[string]int, len(tokens))
+	for _, token := range tokens {
+		counts[token]++
+	}
+	return counts
+}
+
+// Tokenize 切分文本：英文和数字按单词切分并转为小写，中日韩文字按相邻两个字切分，
+// 链接额外记为 "__link__"
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		lower := strings.ToLower(field)
+		if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "www.") {
+			tokens = append(tokens, "__link__")
+		}
+	}
+	for _, token := range tokenize.Split(text, false) {
+		tokens = append(tokens, token.Term)
+	}
+	return tokens
+}
+
+// MemoryStore 保存在内存中的统计，用于测试和本地替身服务
+type MemoryStore struct {
+	mu     sync.Mutex
+	docs   [2]int
+	totals [2]int
+	counts map[string][2]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counts: make(map[string][2]int)}
+}
+
+func (s *MemoryStore) Add(class Class, tokens map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[class]++
+	for token, n := range tokens {
+		c := s.counts[token]
+		c[class] += n
+		s.counts[token] = c
+		s.totals[class] += n
+	}
+	return nil
+}
+
+func (s *MemoryStore) Remove(class Class, tokens map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[class] > 0 {
+		s.docs[class]--
+	}
+	// 计数不会减到 0 以下，两个类别都为 0 的词移出词表，与 RedisStore 一致
+	for token, n := range tokens {
+		c := s.counts[token]
+		if n > c[class] {
+			n = c[class]
+		}
+		c[class] -= n
+		s.totals[class] -= n
+		if c == [2]int{} {
+			delete(s.counts, token)
+		} else {
+			s.counts[token] = c
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Stats(tokens []string) (*Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &Stats{
+		Docs:   s.docs,
+		Totals: s.totals,
+		Vocab:  len(s.counts),
+		Counts: make(map[string][2]int, len(tokens)),
+	}
+	for _, token := range tokens {
+		stats.Counts[token] = s.counts[token]
+	}
+	return stats, nil
+}
@@ -0,0 +1,116 @@
+package spam
+
+import (
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedisStore 把词频统计保存在 Redis 中，多个实例共享同一份训练结果
+type RedisStore struct {
+	Pool   *redis.Pool
+	Prefix string
+}
+
+func NewRedisStore(pool *redis.Pool) *RedisStore {
+	return &RedisStore{Pool: pool, Prefix: "spam/bayes"}
+}
+
+var classNames = [2]string{"ham", "spam"}
+
+func (s *RedisStore) countsKey(class Class) string {
+	return s.Prefix + "/tokens/" + classNames[class]
+}
+
+func (s *RedisStore) metaKey() string {
+	return s.Prefix + "/meta"
+}
+
+func (s *RedisStore) vocabKey() string {
+	return s.Prefix + "/vocab"
+}
+
+func (s *RedisStore) Add(class Class, tokens map[string]int) error {
+	conn := s.Pool.Get()
+	defer conn.Close()
+	var total int
+	_ = conn.Send("MULTI")
+	for token, n := range tokens {
+		_ = conn.Send("HINCRBY", s.countsKey(class), token, n)
+		_ = conn.Send("SADD", s.vocabKey(), token)
+		total += n
+	}
+	_ = conn.Send("HINCRBY", s.metaKey(), "docs:"+classNames[class], 1)
+	_ = conn.Send("HINCRBY", s.metaKey(), "total:"+classNames[class], total)
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// removeScript 与 MemoryStore.Remove 相同：计数不会减到 0 以下，两个类别都为 0 的词移出词表；
+// KEYS 为本类别计数、另一类别计数、meta、词表，ARGV 为 docs 字段、total 字段和成对的词与次数
+var removeScript = redis.NewScript(4, `
+local removed = 0
+for i = 3, #ARGV, 2 do
+	local token = ARGV[i]
+	local count = tonumber(redis.call('HGET', KEYS[1], token) or '0')
+	local n = math.min(tonumber(ARGV[i + 1]), count)
+	if count - n <= 0 then
+		redis.call('HDEL', KEYS[1], token)
+		if tonumber(redis.call('HGET', KEYS[2], token) or '0') <= 0 then
+			redis.call('SREM', KEYS[4], token)
+		end
+	else
+		redis.call('HINCRBY', KEYS[1], token, -n)
+	end
+	removed = removed + n
+end
+if tonumber(redis.call('HGET', KEYS[3], ARGV[1]) or '0') > 0 then
+	redis.call('HINCRBY', KEYS[3], ARGV[1], -1)
+end
+redis.call('HINCRBY', KEYS[3], ARGV[2], -removed)
+return removed
+`)
+
+// Remove 撤销一次 Add，在 Redis 中原子地执行
+func (s *RedisStore) Remove(class Class, tokens map[string]int) error {
+	conn := s.Pool.Get()
+	defer conn.Close()
+	args := redis.Args{}.Add(s.countsKey(class), s.countsKey(1-class), s.metaKey(), s.vocabKey()).
+		Add("docs:"+classNames[class], "total:"+classNames[class])
+	for token, n := range tokens {
+		args = args.Add(token, n)
+	}
+	_, err := removeScript.Do(conn, args...)
+	return err
+}
+
+func (s *RedisStore) Stats(tokens []string) (*Stats, error) {
+	conn := s.Pool.Get()
+	defer conn.Close()
+	stats := &Stats{Counts: make(map[string][2]int, len(tokens))}
+	meta, err := redis.IntMap(conn.Do("HGETALL", s.metaKey()))
+	if err != nil {
+		return nil, err
+	}
+	for class, name := range classNames {
+		stats.Docs[class] = meta["docs:"+name]
+		stats.Totals[class] = meta["total:"+name]
+	}
+	if stats.Vocab, err = redis.Int(conn.Do("SCARD", s.vocabKey())); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return stats, nil
+	}
+	for class := range classNames {
+		args := redis.Args{}.Add(s.countsKey(Class(class))).AddFlat(tokens)
+		values, err := redis.Ints(conn.Do("HMGET", args...))
+		if err != nil {
+			return nil, err
+		}
+		for i, token := range tokens {
+			c := stats.Counts[token]
+			c[class] = values[i]
+			stats.Counts[token] = c
+		}
+	}
+	return stats, nil
+}
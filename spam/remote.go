@@ -0,0 +1,86 @@
+package spam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPChecker 调用兼容 Akismet 接口的远程服务，Endpoint 形如 https://KEY.rest.akismet.com/1.1
+type HTTPChecker struct {
+	Endpoint string
+	Key      string
+	Blog     string
+	Client   *http.Client
+}
+
+func NewHTTPChecker(endpoint, key, blog string) *HTTPChecker {
+	return &HTTPChecker{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Key:      key,
+		Blog:     blog,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (h *HTTPChecker) form(comment *Comment) url.Values {
+	return url.Values{
+		"api_key":              {h.Key},
+		"blog":                 {h.Blog},
+		"user_ip":              {comment.IP},
+		"user_agent":           {comment.UserAgent},
+		"permalink":            {comment.Permalink},
+		"comment_type":         {"comment"},
+		"comment_author":       {comment.Author},
+		"comment_author_email": {comment.Email},
+		"comment_author_url":   {comment.AuthorURL},
+		"comment_content":      {comment.Content},
+	}
+}
+
+func (h *HTTPChecker) post(method string, comment *Comment) (string, error) {
+	resp, err := h.Client.PostForm(h.Endpoint+"/"+method, h.form(comment))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("spam: %s returned %s", method, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (h *HTTPChecker) IsSpam(comment *Comment) (bool, error) {
+	body, err := h.post("comment-check", comment)
+	if err != nil {
+		return false, err
+	}
+	switch body {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("spam: unexpected comment-check response %q", body)
+}
+
+func (h *HTTPChecker) Learn(comment *Comment, spam bool) error {
+	method := "submit-ham"
+	if spam {
+		method = "submit-spam"
+	}
+	_, err := h.post(method, comment)
+	return err
+}
+
+// Unlearn Akismet 风格接口没有撤销提交的方法，改判时提交相反的类别即可
+func (h *HTTPChecker) Unlearn(*Comment, bool) error {
+	return nil
+}
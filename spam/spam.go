@@ -0,0 +1,30 @@
+// Package spam 提供评论垃圾检测：内置朴素贝叶斯分类器，以及兼容 Akismet 接口的远程检测
+package spam
+
+// Comment 提交给检测器的评论信息
+type Comment struct {
+	Author    string
+	Email     string
+	AuthorURL string
+	Content   string
+	IP        string
+	UserAgent string
+	Permalink string
+}
+
+// SpamChecker 在评论保存前判断是否为垃圾评论，并从管理员的审核结果中学习；
+// 管理员改判时先用 Unlearn 撤销之前的训练，再按新的类别 Learn
+type SpamChecker interface {
+	IsSpam(comment *Comment) (bool, error)
+	Learn(comment *Comment, spam bool) error
+	Unlearn(comment *Comment, spam bool) error
+}
+
+// Nop 不做任何检测
+type Nop struct{}
+
+func (Nop) IsSpam(*Comment) (bool, error) { return false, nil }
+
+func (Nop) Learn(*Comment, bool) error { return nil }
+
+func (Nop) Unlearn(*Comment, bool) error { return nil }
@@ -0,0 +1,121 @@
+package spam
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var (
+	spamSamples = []string{
+		"Buy cheap viagra now http://pills.example.com best price",
+		"Cheap replica watches, buy now at http://watches.example.com",
+		"Casino bonus! win money now http://casino.example.com",
+		"代开发票 优惠 加微信 http://fapiao.example.com",
+	}
+	hamSamples = []string{
+		"Thanks for the detailed write-up on gin middleware, very helpful.",
+		"I think the redis lock should also handle expiry, nice post though.",
+		"这篇文章对 gorm 的分析很清楚，感谢分享",
+		"Could you explain how the template rendering works in more detail?",
+	}
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Hello, World 你好世界 http://x.io")
+	want := []string{"__link__", "hello", "world", "你好", "好世", "世界", "http", "x", "io"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func train(t *testing.T, checker SpamChecker) {
+	for _, s := range spamSamples {
+		if err := checker.Learn(&Comment{Content: s}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range hamSamples {
+		if err := checker.Learn(&Comment{Content: s}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func assertClassify(t *testing.T, checker SpamChecker, content string, want bool) {
+	got, err := checker.IsSpam(&Comment{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("IsSpam(%q) = %v, want %v", content, got, want)
+	}
+}
+
+func TestBayes(t *testing.T) {
+	bayes := NewBayes(NewMemoryStore(), 0.9, 2)
+	// 样本不足时不拦截
+	assertClassify(t, bayes, "buy cheap viagra now", false)
+	train(t, bayes)
+	assertClassify(t, bayes, "buy cheap pills now http://spam.example.com", true)
+	assertClassify(t, bayes, "加微信 代开发票", true)
+	assertClassify(t, bayes, "Thanks, the gorm template explanation was helpful", false)
+	assertClassify(t, bayes, "感谢分享，文章很清楚", false)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	server := httptest.NewServer(NewStandInHandler(NewBayes(NewMemoryStore(), 0.9, 2)))
+	defer server.Close()
+	checker := NewHTTPChecker(server.URL+"/", "key", "http://blog.example.com")
+	train(t, checker)
+	assertClassify(t, checker, "win casino money now http://casino.example.com", true)
+	assertClassify(t, checker, "Nice post about gin middleware", false)
+
+	bad := NewHTTPChecker(server.URL+"/missing", "", "")
+	if _, err := bad.IsSpam(&Comment{Content: "x"}); err == nil {
+		t.Error("expected error from unknown endpoint")
+	}
+}
+
+func TestBayesUnlearn(t *testing.T) {
+	store := NewMemoryStore()
+	bayes := NewBayes(store, 0.9, 1)
+	comment := &Comment{Content: spamSamples[0]}
+	// 反复改判同一条评论，统计中只保留最后一次的类别
+	for _, spam := range []bool{true, false, true} {
+		if err := bayes.Learn(comment, spam); err != nil {
+			t.Fatal(err)
+		}
+		if err := bayes.Unlearn(comment, spam); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bayes.Learn(comment, true); err != nil {
+		t.Fatal(err)
+	}
+	stats, _ := store.Stats([]string{"viagra"})
+	if stats.Docs != [2]int{0, 1} || stats.Counts["viagra"] != [2]int{0, 1} {
+		t.Errorf("stats after relearning: docs %v, viagra %v", stats.Docs, stats.Counts["viagra"])
+	}
+	if stats.Totals[Ham] != 0 {
+		t.Errorf("ham total = %d, want 0", stats.Totals[Ham])
+	}
+}
+
+// TestMemoryStoreRemoveClamps 撤销没有学过的内容时计数不会变为负数，清空的词移出词表
+func TestMemoryStoreRemoveClamps(t *testing.T) {
+	store := NewMemoryStore()
+	store.Add(Spam, map[string]int{"pills": 2, "cheap": 1})
+	store.Add(Ham, map[string]int{"cheap": 1})
+	if err := store.Remove(Spam, map[string]int{"pills": 5, "cheap": 1, "never": 3}); err != nil {
+		t.Fatal(err)
+	}
+	store.Remove(Spam, map[string]int{"pills": 1})
+	stats, _ := store.Stats([]string{"pills", "cheap", "never"})
+	if stats.Docs != [2]int{1, 0} || stats.Totals != [2]int{1, 0} || stats.Vocab != 1 {
+		t.Errorf("docs %v, totals %v, vocab %d", stats.Docs, stats.Totals, stats.Vocab)
+	}
+	if stats.Counts["pills"] != [2]int{} || stats.Counts["never"] != [2]int{} || stats.Counts["cheap"] != [2]int{1, 0} {
+		t.Errorf("counts %v", stats.Counts)
+	}
+}
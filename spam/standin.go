@@ -0,0 +1,47 @@
+package spam
+
+import (
+	"net/http"
+)
+
+// NewStandInHandler 用任意 SpamChecker 实现 Akismet 风格的 comment-check、
+// submit-spam、submit-ham 接口，便于在本地调试和测试 HTTPChecker
+func NewStandInHandler(checker SpamChecker) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/comment-check", func(w http.ResponseWriter, r *http.Request) {
+		isSpam, err := checker.IsSpam(formComment(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if isSpam {
+			_, _ = w.Write([]byte("true"))
+		} else {
+			_, _ = w.Write([]byte("false"))
+		}
+	})
+	learn := func(spam bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if err := checker.Learn(formComment(r), spam); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte("Thanks for making the web a better place."))
+		}
+	}
+	mux.HandleFunc("/submit-spam", learn(true))
+	mux.HandleFunc("/submit-ham", learn(false))
+	return mux
+}
+
+func formComment(r *http.Request) *Comment {
+	return &Comment{
+		Author:    r.PostFormValue("comment_author"),
+		Email:     r.PostFormValue("comment_author_email"),
+		AuthorURL: r.PostFormValue("comment_author_url"),
+		Content:   r.PostFormValue("comment_content"),
+		IP:        r.PostFormValue("user_ip"),
+		UserAgent: r.PostFormValue("user_agent"),
+		Permalink: r.PostFormValue("permalink"),
+	}
+}
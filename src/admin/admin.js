@@ -1,5 +1,10 @@
 import UIkit from "./base"
 
+// 所有 AJAX 请求带上 CSRF token，服务端对 POST/DELETE 等请求校验
+$.ajaxSetup({
+    headers: {'X-CSRF-Token': $('meta[name=csrf-token]').attr('content')}
+});
+
 let $error = $('meta[name=errors]').attr('content');
 
 if ($error) {
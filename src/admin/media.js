@@ -0,0 +1,10 @@
+import './admin';
+import UIkit from './base';
+
+// 复制文件的 Markdown 片段，粘贴到文章中使用
+$('.media-copy').on('click', (event) => {
+    let $input = $(event.currentTarget).closest('.uk-card-body').find('.media-markdown');
+    $input.select();
+    document.execCommand('copy');
+    UIkit.notification({message: 'Copied', status: 'success', timeout: 1000});
+});
@@ -62,4 +62,46 @@ $(document).ready(() => {
     $("select").select2({
         tags: true
     });
-});
\ No newline at end of file
+});
+// 上传图片等文件，成功后把返回的 Markdown 插入到光标处；也可以直接粘贴或拖入编辑器
+let uploadFiles = (files) => {
+    Array.from(files).forEach((file) => {
+        let data = new FormData();
+        data.append('file', file);
+        $.ajax({
+            url: '/admin/media/upload',
+            type: 'POST',
+            data: data,
+            processData: false,
+            contentType: false
+        }).done((rs) => {
+            simplemde.codemirror.replaceSelection(rs.markdown + '\n');
+        }).fail((xhr) => {
+            let msg = xhr.responseJSON ? xhr.responseJSON.msg : xhr.statusText;
+            UIkit.notification({message: `${file.name}: ${msg}`, status: 'danger'});
+        });
+    });
+};
+
+let $mediaInput = $('#media-upload');
+if ($mediaInput.length) {
+    $('#media-upload-button').on('click', () => $mediaInput.click());
+    $mediaInput.on('change', () => {
+        uploadFiles($mediaInput[0].files);
+        $mediaInput.val('');
+    });
+    simplemde.codemirror.on('paste', (cm, event) => {
+        let files = event.clipboardData && event.clipboardData.files;
+        if (files && files.length) {
+            event.preventDefault();
+            uploadFiles(files);
+        }
+    });
+    simplemde.codemirror.on('drop', (cm, event) => {
+        let files = event.dataTransfer && event.dataTransfer.files;
+        if (files && files.length) {
+            event.preventDefault();
+            uploadFiles(files);
+        }
+    });
+}
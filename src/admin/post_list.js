@@ -20,6 +20,14 @@ $switcher.on('click', (event)  => {
                     timeout: 1000
                 });
             }
+        },
+        error: function(xhr) {
+            $this.checked = !checked;
+            UIkit.notification({
+                message: (xhr.responseJSON && xhr.responseJSON.msg) || 'Ops!',
+                status: 'danger',
+                timeout: 1000
+            });
         }
     });
 });
@@ -29,7 +37,7 @@ $delBtn.on('click', (event)  => {
     let $url = $($this).data('url');
     let id = $($this).data('id');
 
-    UIkit.modal.confirm(`Post(${id}) Will delete, Plz confirm!`).then(() => {
+    UIkit.modal.confirm(`Post(${id}) will be moved to the trash, please confirm!`).then(() => {
         $.ajax({
             url: $url,
             type: 'DELETE',
@@ -9,9 +9,12 @@ let $loginBtn = $('.gitment-editor-login-link');
 let $submitBtn = $('.gitment-editor-submit');
 let $isEmptyDiv = $('.gitment-comments-empty');
 let $pageItemBtn = $('.gitment-comments-page-item')
+let $replyTip = $('.gitment-editor-reply-tip');
+let replyTo = 0;
 
 
 const target_id = $('meta[name=post_id]').attr('content');
+const csrfToken = $('meta[name=csrf-token]').attr('content');
 
 
 $editorTab.click((e)=> {
@@ -31,6 +34,7 @@ $editorTab.click((e)=> {
             $.ajax({
                 url: '/comment/markdown',
                 type: 'post',
+                headers: {'X-CSRF-Token': csrfToken},
                 data: {'text': text},
                 dataType: 'json',
                 success: function (rs) {
@@ -44,6 +48,22 @@ $editorTab.click((e)=> {
     }
 });
 
+let resetReply = () => {
+    replyTo = 0;
+    $replyTip.addClass('gitment-hidden');
+}
+
+// 回复按钮在翻页后会重新渲染，这里使用事件委托
+$commentContainer.on('click', '.gitment-comment-reply-btn', (e)=> {
+    let self = $(e.currentTarget);
+    replyTo = self.data('id');
+    $replyTip.find('span').text(`回复 @${self.data('name')}`);
+    $replyTip.removeClass('gitment-hidden');
+    $writeTextarea.focus();
+});
+
+$replyTip.find('a').click(resetReply);
+
 $submitBtn.click((e)=> {
     let content = $writeTextarea.val();
     if (!content) {
@@ -53,16 +73,22 @@ $submitBtn.click((e)=> {
     self.html('提交...')
     self.attr('disabled', true)
     $.ajax({
-        url: `/comment/post/${target_id}`,
+        url: replyTo ? `/comment/post/${target_id}/reply` : `/comment/post/${target_id}`,
         type: 'post',
-        data: {'content': content},
+        headers: {'X-CSRF-Token': csrfToken},
+        data: {'content': content, 'ref_id': replyTo},
         dataType: 'json',
         success: function (rs) {
+            self.removeAttr('disabled')
+            self.html('评论')
             if (!rs.r) {
                 $writeTextarea.val('')
-                self.removeAttr('disabled')
-                self.html('评论')
-                $commentContainer.prepend(rs.html)
+                if (rs.ref_id) {
+                    $(`.gitment-comment-replies[data-id=${rs.ref_id}]`).append(rs.html)
+                } else {
+                    $commentContainer.prepend(rs.html)
+                }
+                resetReply()
                 console.log('评论成功')
                 $isEmptyDiv.remove()
             } else {
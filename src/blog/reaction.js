@@ -0,0 +1,37 @@
+let $reactions = $('#reactions');
+let $items = $reactions.find('.reaction-items');
+const postID = $reactions.data('post-id');
+const csrfToken = $('meta[name=csrf-token]').attr('content');
+
+$items.on('click', '.reaction-item', (e)=> {
+    if (!$reactions.data('login')) {
+        window.location.href = `/oauth2/auth/post/${postID}`;
+        return
+    }
+    if ($items.hasClass('is-submitting')) {
+        return
+    }
+    let self = $(e.currentTarget);
+    let type = self.data('type');
+    $items.addClass('is-submitting');
+    $.ajax({
+        url: `/api/post/${postID}/reactions?type=${type}`,
+        type: self.hasClass('reaction-item__selected') ? 'DELETE' : 'POST',
+        headers: {'X-CSRF-Token': csrfToken},
+        dataType: 'json',
+        success: function (rs) {
+            if (rs.r) {
+                console.log(rs.msg);
+                return
+            }
+            rs.reactions.forEach((reaction) => {
+                let $item = $items.find(`.reaction-item[data-type=${reaction.type}]`);
+                $item.toggleClass('reaction-item__selected', reaction.reacted);
+                $item.find('.reaction-item__votes').text(reaction.count);
+            });
+        },
+        complete: function () {
+            $items.removeClass('is-submitting');
+        }
+    });
+});
@@ -3,6 +3,7 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"lyanna/utils/password"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -62,7 +63,7 @@ func (dm *DatabaseManager) GetTableInfo() (map[string]int64, error) {
 	}
 	defer db.Close()
 
-	tables := []string{"users", "github_users", "tags", "posts", "post_tags", "comments", "react_items"}
+	tables := []string{"users", "github_users", "tags", "posts", "post_tags", "post_revisions", "post_slugs", "comments", "react_items", "user_recovery_codes", "api_tokens", "media", "settings"}
 	tableInfo := make(map[string]int64)
 
 	for _, table := range tables {
@@ -236,7 +237,7 @@ func (dm *DatabaseManager) OptimizeTables() error {
 	}
 	defer db.Close()
 
-	tables := []string{"users", "github_users", "tags", "posts", "post_tags", "comments", "react_items"}
+	tables := []string{"users", "github_users", "tags", "posts", "post_tags", "post_revisions", "post_slugs", "comments", "react_items", "user_recovery_codes", "api_tokens", "media", "settings"}
 
 	for _, table := range tables {
 		query := fmt.Sprintf("OPTIMIZE TABLE %s", table)
@@ -249,6 +250,55 @@ func (dm *DatabaseManager) OptimizeTables() error {
 	return nil
 }
 
+// ExpireLegacyPasswords 将仍为 MD5 格式的用户密码标记为过期，返回受影响的用户名
+// 过期后该用户无法登录，需要管理员在后台重新设置密码
+func (dm *DatabaseManager) ExpireLegacyPasswords() ([]string, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		dm.User, dm.Password, dm.Host, dm.Port, dm.Database)
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, name, password FROM users")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+	type legacyUser struct {
+		id   uint64
+		name string
+		hash string
+	}
+	var legacy []legacyUser
+	for rows.Next() {
+		var u legacyUser
+		if err := rows.Scan(&u.id, &u.name, &u.hash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		if password.Format(u.hash) == password.Legacy {
+			legacy = append(legacy, u)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+
+	var names []string
+	for _, u := range legacy {
+		_, err := db.Exec("UPDATE users SET password = ? WHERE id = ? AND password = ?", password.Expire(u.hash), u.id, u.hash)
+		if err != nil {
+			return names, fmt.Errorf("failed to expire password of %s: %v", u.name, err)
+		}
+		names = append(names, u.name)
+	}
+
+	return names, nil
+}
+
 // CheckDatabaseHealth 检查数据库健康状态
 func (dm *DatabaseManager) CheckDatabaseHealth() (map[string]interface{}, error) {
 	health := make(map[string]interface{})
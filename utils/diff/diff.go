@@ -0,0 +1,247 @@
+// Package diff 提供基于 Myers 算法的按行文本对比
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+func (op Op) String() string {
+	switch op {
+	case Insert:
+		return "insert"
+	case Delete:
+		return "delete"
+	default:
+		return "equal"
+	}
+}
+
+// Line 对比结果中的一行，OldNum/NewNum 为 0 表示该侧不存在此行
+type Line struct {
+	Op     Op
+	Text   string
+	OldNum int
+	NewNum int
+}
+
+// Stat 统计新增和删除的行数
+type Stat struct {
+	Added   int
+	Removed int
+}
+
+func splitLines(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// Lines 对比 a 和 b，返回从 a 变为 b 的逐行结果
+func Lines(a, b string) []Line {
+	return diffLines(splitLines(a), splitLines(b))
+}
+
+// Summary 统计对比结果
+func Summary(lines []Line) Stat {
+	var s Stat
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			s.Added++
+		case Delete:
+			s.Removed++
+		}
+	}
+	return s
+}
+
+// MaxLines 参与对比的行数上限（去掉相同的开头和结尾后两边合计），超过时整段显示为删除后插入，
+// 避免两个差别很大的长版本对比耗费过多时间
+const MaxLines = 10000
+
+// differ 线性空间的 Myers 算法：每次找到最短编辑路径的中间点，把问题分成两半递归对比
+type differ struct {
+	a, b   []int // 行内容编号，相同的行编号相同
+	ta, tb []string
+	lines  []Line
+}
+
+func diffLines(a, b []string) []Line {
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{a: intern(a), b: intern(b), ta: a, tb: b}
+	d.compare(0, len(a), 0, len(b))
+	return deletesFirst(d.lines)
+}
+
+// compare 对比 a[aLo:aHi] 和 b[bLo:bHi]，按顺序追加结果
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.equal(aLo, bLo)
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi || bLo == bHi:
+		d.replace(aLo, aHi, bLo, bHi)
+	case aHi-aLo+bHi-bLo > MaxLines:
+		d.replace(aLo, aHi, bLo, bHi)
+	default:
+		if x, y, ok := d.bisect(aLo, aHi, bLo, bHi); ok {
+			d.compare(aLo, x, bLo, y)
+			d.compare(x, aHi, y, bHi)
+		} else {
+			d.replace(aLo, aHi, bLo, bHi)
+		}
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.equal(aHi+i, bHi+i)
+	}
+}
+
+// bisect 同时从两端搜索最短编辑路径，返回两条路径重合处的分割点；
+// v1、v2 只保存当前各条对角线到达的最远位置，内存与行数成正比
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	a, b := d.a[aLo:aHi], d.b[bLo:bHi]
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	off := maxD
+	size := 2*maxD + 2
+	v1 := make([]int, size)
+	v2 := make([]int, size)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[off+1] = 0
+	v2[off+1] = 0
+	delta := n - m
+	// 总差值为奇数时在正向搜索中检查重合，否则在反向搜索中检查
+	front := delta%2 != 0
+	var k1start, k1end, k2start, k2end int
+	for step := 0; step < maxD; step++ {
+		for k1 := -step + k1start; k1 <= step-k1end; k1 += 2 {
+			k1off := off + k1
+			var x1 int
+			if k1 == -step || (k1 != step && v1[k1off-1] < v1[k1off+1]) {
+				x1 = v1[k1off+1]
+			} else {
+				x1 = v1[k1off-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && a[x1] == b[y1] {
+				x1++
+				y1++
+			}
+			v1[k1off] = x1
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				k2off := off + delta - k1
+				if k2off >= 0 && k2off < size && v2[k2off] != -1 && x1 >= n-v2[k2off] {
+					return aLo + x1, bLo + y1, true
+				}
+			}
+		}
+		for k2 := -step + k2start; k2 <= step-k2end; k2 += 2 {
+			k2off := off + k2
+			var x2 int
+			if k2 == -step || (k2 != step && v2[k2off-1] < v2[k2off+1]) {
+				x2 = v2[k2off+1]
+			} else {
+				x2 = v2[k2off-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && a[n-x2-1] == b[m-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2off] = x2
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				k1off := off + delta - k2
+				if k1off >= 0 && k1off < size && v1[k1off] != -1 {
+					x1 := v1[k1off]
+					y1 := off + x1 - k1off
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func (d *differ) equal(x, y int) {
+	d.lines = append(d.lines, Line{Op: Equal, Text: d.ta[x], OldNum: x + 1, NewNum: y + 1})
+}
+
+// replace 把 a[aLo:aHi] 全部删除，再插入 b[bLo:bHi]
+func (d *differ) replace(aLo, aHi, bLo, bHi int) {
+	for x := aLo; x < aHi; x++ {
+		d.lines = append(d.lines, Line{Op: Delete, Text: d.ta[x], OldNum: x + 1})
+	}
+	for y := bLo; y < bHi; y++ {
+		d.lines = append(d.lines, Line{Op: Insert, Text: d.tb[y], NewNum: y + 1})
+	}
+}
+
+// deletesFirst 连续的修改中先列出删除的行，再列出插入的行
+func deletesFirst(lines []Line) []Line {
+	for start := 0; start < len(lines); {
+		if lines[start].Op == Equal {
+			start++
+			continue
+		}
+		end := start
+		for end < len(lines) && lines[end].Op != Equal {
+			end++
+		}
+		run := make([]Line, 0, end-start)
+		for _, op := range []Op{Delete, Insert} {
+			for _, l := range lines[start:end] {
+				if l.Op == op {
+					run = append(run, l)
+				}
+			}
+		}
+		copy(lines[start:end], run)
+		start = end
+	}
+	return lines
+}
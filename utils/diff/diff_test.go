@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func render(lines []Line) string {
+	var s string
+	for _, l := range lines {
+		switch l.Op {
+		case Insert:
+			s += "+" + l.Text + "\n"
+		case Delete:
+			s += "-" + l.Text + "\n"
+		default:
+			s += " " + l.Text + "\n"
+		}
+	}
+	return s
+}
+
+func TestLines(t *testing.T) {
+	cases := []struct {
+		a, b, want string
+	}{
+		{"", "", ""},
+		{"a\nb\nc", "a\nb\nc\n", " a\n b\n c\n"},
+		{"", "a\nb", "+a\n+b\n"},
+		{"a\nb", "", "-a\n-b\n"},
+		{"a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"a\nb\nc\nd", "a\nx\nc\nd\ne", " a\n-b\n+x\n c\n d\n+e\n"},
+	}
+	for _, c := range cases {
+		got := render(Lines(c.a, c.b))
+		if got != c.want {
+			t.Errorf("Lines(%q, %q) =\n%s\nwant\n%s", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestLineNumbers(t *testing.T) {
+	lines := Lines("a\nb\nc", "a\nx\nc")
+	want := []Line{
+		{Equal, "a", 1, 1},
+		{Delete, "b", 2, 0},
+		{Insert, "x", 0, 2},
+		{Equal, "c", 3, 3},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, lines[i], want[i])
+		}
+	}
+	if s := Summary(lines); s.Added != 1 || s.Removed != 1 {
+		t.Errorf("Summary = %+v", s)
+	}
+}
+
+// apply 检查结果能从 a 得到 b，返回修改的行数
+func apply(t *testing.T, a, b []string, lines []Line) int {
+	var oldLines, newLines []string
+	edits := 0
+	for _, l := range lines {
+		if l.Op != Insert {
+			if l.OldNum != len(oldLines)+1 {
+				t.Fatalf("line %+v: OldNum want %d", l, len(oldLines)+1)
+			}
+			oldLines = append(oldLines, l.Text)
+		}
+		if l.Op != Delete {
+			if l.NewNum != len(newLines)+1 {
+				t.Fatalf("line %+v: NewNum want %d", l, len(newLines)+1)
+			}
+			newLines = append(newLines, l.Text)
+		}
+		if l.Op != Equal {
+			edits++
+		}
+	}
+	if strings.Join(oldLines, "\n") != strings.Join(a, "\n") || strings.Join(newLines, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("diff of %q and %q does not reproduce them", a, b)
+	}
+	return edits
+}
+
+// lcs 最长公共子序列的长度，用来验证编辑次数最少
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else if prev[j+1] > cur[j] {
+				cur[j+1] = prev[j+1]
+			} else {
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestLinesMinimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rnd.Intn(30))
+		for i := range lines {
+			lines[i] = string('a' + rune(rnd.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		edits := apply(t, a, b, diffLines(a, b))
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("diff of %q and %q has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// TestLinesLarge 两个完全不同的长版本：低于上限时正常对比，超过上限时整段替换
+func TestLinesLarge(t *testing.T) {
+	numbered := func(prefix string, n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = prefix + strconv.Itoa(i)
+		}
+		return lines
+	}
+	a, b := numbered("a", MaxLines/2-1), numbered("b", MaxLines/2-1)
+	b[len(b)/2] = a[len(a)/3]
+	if edits := apply(t, a, b, diffLines(a, b)); edits != len(a)+len(b)-2 {
+		t.Errorf("%d edits, want %d", edits, len(a)+len(b)-2)
+	}
+
+	a, b = numbered("a", 20000), numbered("b", 20000)
+	a[0], b[0] = "same", "same"
+	lines := diffLines(a, b)
+	apply(t, a, b, lines)
+	if lines[0].Op != Equal || lines[1].Op != Delete || lines[len(a)].Op != Insert {
+		t.Errorf("input over MaxLines was not replaced as a whole")
+	}
+}
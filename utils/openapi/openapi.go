@@ -0,0 +1,368 @@
+// Package openapi 根据接口描述生成 OpenAPI 3 文档，并检查文档与已注册的路由是否一致
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Param 查询参数或路径参数，路径参数会从 Path 中自动识别
+type Param struct {
+	Name        string
+	In          string // query / path / header
+	Type        string // string / integer / boolean
+	Description string
+	Required    bool
+}
+
+// Operation 一个接口的描述
+type Operation struct {
+	Method      string
+	Path        string // gin 风格路径，如 /posts/:id
+	Tag         string
+	Summary     string
+	Params      []Param
+	Body        interface{} // 请求体示例类型，nil 表示没有请求体
+	Response    interface{} // data 字段的类型，nil 表示没有 data
+	List        bool        // data 为 Response 的数组并带分页信息
+	Status      int         // 成功时的状态码，默认 200
+	Permission  string      // 需要的权限，空表示公开
+	Description string
+}
+
+// Info 文档基本信息
+type Info struct {
+	Title   string
+	Version string
+	BaseURL string
+	// SecuritySchemes 认证方式，需要权限的接口可以使用其中任意一种
+	SecuritySchemes map[string]interface{}
+}
+
+// Document 生成 OpenAPI 3.0 文档
+// 所有响应都使用统一的信封：成功为 {"r":0,"data":...,"meta":...}，失败为 {"r":1,"code":...,"msg":...}
+func Document(info Info, ops []Operation) map[string]interface{} {
+	g := &generator{schemas: map[string]interface{}{}}
+	var schemes []string
+	for name := range info.SecuritySchemes {
+		schemes = append(schemes, name)
+	}
+	sort.Strings(schemes)
+	for _, name := range schemes {
+		g.security = append(g.security, map[string][]string{name: {}})
+	}
+	g.schemas["Error"] = obj(map[string]interface{}{
+		"r":    map[string]interface{}{"type": "integer", "enum": []int{1}},
+		"code": map[string]interface{}{"type": "string", "example": "not_found"},
+		"msg":  map[string]interface{}{"type": "string"},
+	}, "r", "code", "msg")
+	g.schemas["Meta"] = obj(map[string]interface{}{
+		"page":        map[string]interface{}{"type": "integer"},
+		"per_page":    map[string]interface{}{"type": "integer"},
+		"total":       map[string]interface{}{"type": "integer"},
+		"total_pages": map[string]interface{}{"type": "integer"},
+	}, "page", "per_page", "total", "total_pages")
+
+	paths := map[string]interface{}{}
+	for _, op := range ops {
+		path := OpenAPIPath(op.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   info.Title,
+			"version": info.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+		},
+	}
+	if len(info.SecuritySchemes) > 0 {
+		doc["components"].(map[string]interface{})["securitySchemes"] = info.SecuritySchemes
+	}
+	if info.BaseURL != "" {
+		doc["servers"] = []interface{}{map[string]interface{}{"url": info.BaseURL}}
+	}
+	return doc
+}
+
+// OpenAPIPath 把 gin 路径参数 :id 转换为 {id}
+func OpenAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// Route 已注册的路由
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Check 检查 routes 中以 prefix 开头的路由都有文档，且文档中的接口都已注册；ignore 中的完整路径不参与检查
+func Check(prefix string, ops []Operation, routes []Route, ignore ...string) error {
+	documented := map[string]bool{}
+	for _, op := range ops {
+		documented[op.Method+" "+prefix+op.Path] = true
+	}
+	skip := map[string]bool{}
+	for _, path := range ignore {
+		skip[path] = true
+	}
+	registered := map[string]bool{}
+	var problems []string
+	for _, r := range routes {
+		if !strings.HasPrefix(r.Path, prefix) || skip[r.Path] {
+			continue
+		}
+		key := r.Method + " " + r.Path
+		registered[key] = true
+		if !documented[key] {
+			problems = append(problems, "undocumented route "+key)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			problems = append(problems, "documented route is not registered "+key)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+type generator struct {
+	schemas  map[string]interface{}
+	security []map[string][]string
+}
+
+func (g *generator) operation(op Operation) map[string]interface{} {
+	o := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+	if op.Tag != "" {
+		o["tags"] = []string{op.Tag}
+	}
+	desc := op.Description
+	if op.Permission != "" {
+		desc = strings.TrimSpace(desc + "\n\nRequires permission `" + op.Permission + "`.")
+	}
+	if desc != "" {
+		o["description"] = desc
+	}
+	if op.Permission != "" && len(g.security) > 0 {
+		o["security"] = g.security
+	}
+
+	var params []interface{}
+	for _, part := range strings.Split(op.Path, "/") {
+		if strings.HasPrefix(part, ":") {
+			params = append(params, map[string]interface{}{
+				"name": part[1:], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "integer"},
+			})
+		}
+	}
+	if op.List {
+		params = append(params,
+			map[string]interface{}{"name": "page", "in": "query", "schema": map[string]interface{}{"type": "integer", "minimum": 1, "default": 1}},
+			map[string]interface{}{"name": "per_page", "in": "query", "schema": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 100}},
+		)
+	}
+	for _, p := range op.Params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		param := map[string]interface{}{
+			"name": p.Name, "in": p.In, "schema": map[string]interface{}{"type": typ},
+		}
+		if p.Required || p.In == "path" {
+			param["required"] = true
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	if op.Body != nil {
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.Body))},
+			},
+		}
+	}
+
+	envelope := map[string]interface{}{"r": map[string]interface{}{"type": "integer", "enum": []int{0}}}
+	required := []string{"r"}
+	if op.Response != nil {
+		data := g.schema(reflect.TypeOf(op.Response))
+		if op.List {
+			data = map[string]interface{}{"type": "array", "items": data}
+			envelope["meta"] = ref("Meta")
+			required = append(required, "meta")
+		}
+		envelope["data"] = data
+		required = append(required, "data")
+	}
+	status := op.Status
+	if status == 0 {
+		status = 200
+	}
+	o["responses"] = map[string]interface{}{
+		fmt.Sprint(status): map[string]interface{}{
+			"description": "OK",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": obj(envelope, required...)},
+			},
+		},
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref("Error")},
+			},
+		},
+	}
+	return o
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		if t.Elem() == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+		}
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // 先占位，防止递归类型死循环
+			g.schemas[name] = g.structSchema(t)
+		}
+		return ref(name)
+	}
+	return map[string]interface{}{}
+}
+
+func (g *generator) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, opts := f.Name, ""
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				name, opts = tag[:idx], tag[idx:]
+			} else {
+				name = tag
+			}
+			if name == "" {
+				name = f.Name
+			}
+		}
+		s := g.schema(f.Type)
+		if desc := f.Tag.Get("doc"); desc != "" {
+			s = withDescription(s, desc)
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	return obj(props, required...)
+}
+
+func withDescription(s map[string]interface{}, desc string) map[string]interface{} {
+	if _, isRef := s["$ref"]; isRef {
+		return map[string]interface{}{"allOf": []interface{}{s}, "description": desc}
+	}
+	c := map[string]interface{}{}
+	for k, v := range s {
+		c[k] = v
+	}
+	c["description"] = desc
+	return c
+}
+
+func obj(props map[string]interface{}, required ...string) map[string]interface{} {
+	o := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		o["required"] = required
+	}
+	return o
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// operationID 例如 GET /posts/:id -> getPostsById
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(op.Path, "/") {
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, ":") {
+			part = "by_" + part[1:]
+		}
+		for _, word := range strings.Split(part, "_") {
+			if word != "" {
+				id += strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+	}
+	return id
+}
@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTag struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name" doc:"tag name"`
+}
+
+type testPost struct {
+	ID        uint64     `json:"id"`
+	Title     string     `json:"title"`
+	Secret    string     `json:"-"`
+	PublishAt *time.Time `json:"publish_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	Tags      []testTag  `json:"tags,omitempty"`
+	hidden    int
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	cases := map[string]string{
+		"/posts":              "/posts",
+		"/posts/:id":          "/posts/{id}",
+		"/posts/:id/comments": "/posts/{id}/comments",
+	}
+	for in, want := range cases {
+		if got := OpenAPIPath(in); got != want {
+			t.Errorf("OpenAPIPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDocument(t *testing.T) {
+	doc := Document(Info{Title: "test", Version: "1", SecuritySchemes: map[string]interface{}{
+		"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+	}}, []Operation{
+		{Method: "GET", Path: "/posts", Summary: "list", Response: testPost{}, List: true,
+			Params: []Param{{Name: "tag", In: "query", Type: "integer"}}},
+		{Method: "GET", Path: "/posts/:id", Summary: "get", Response: testPost{}},
+		{Method: "DELETE", Path: "/posts/:id", Summary: "delete", Permission: "posts:create", Status: 204},
+	})
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{}
+				Required   []string
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.Paths["/posts/{id}"]["delete"]; !ok {
+		t.Fatalf("missing DELETE /posts/{id}: %s", b)
+	}
+	list := string(out.Paths["/posts"]["get"])
+	for _, want := range []string{`"name":"page"`, `"name":"per_page"`, `"name":"tag"`, `#/components/schemas/Meta`} {
+		if !strings.Contains(list, want) {
+			t.Errorf("list operation missing %s: %s", want, list)
+		}
+	}
+	del := string(out.Paths["/posts/{id}"]["delete"])
+	if !strings.Contains(del, `"204"`) {
+		t.Errorf("delete operation should use status 204")
+	}
+	if !strings.Contains(del, `"security":[{"bearerAuth":[]}]`) {
+		t.Errorf("operation with permission should list security schemes: %s", del)
+	}
+	if strings.Contains(list, `"security"`) {
+		t.Errorf("public operation should not require security: %s", list)
+	}
+
+	post, ok := out.Components.Schemas["testPost"]
+	if !ok {
+		t.Fatalf("missing testPost schema")
+	}
+	if _, ok := post.Properties["Secret"]; ok {
+		t.Errorf("json:\"-\" field should be skipped")
+	}
+	if _, ok := post.Properties["hidden"]; ok {
+		t.Errorf("unexported field should be skipped")
+	}
+	if post.Properties["created_at"]["format"] != "date-time" {
+		t.Errorf("created_at = %v, want date-time", post.Properties["created_at"])
+	}
+	if post.Properties["publish_at"]["nullable"] != true {
+		t.Errorf("publish_at should be nullable")
+	}
+	if strings.Join(post.Required, ",") != "created_at,id,title" {
+		t.Errorf("required = %v", post.Required)
+	}
+	if out.Components.Schemas["testTag"].Properties["name"]["description"] != "tag name" {
+		t.Errorf("doc tag should become description")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ops := []Operation{
+		{Method: "GET", Path: "/posts"},
+		{Method: "GET", Path: "/posts/:id"},
+	}
+	routes := []Route{
+		{"GET", "/api/v1/posts"},
+		{"GET", "/api/v1/posts/:id"},
+		{"GET", "/api/v1/openapi.json"},
+		{"GET", "/"},
+	}
+	if err := Check("/api/v1", ops, routes, "/api/v1/openapi.json"); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	err := Check("/api/v1", ops, append(routes[1:], Route{"POST", "/api/v1/tags"}), "/api/v1/openapi.json")
+	if err == nil {
+		t.Fatal("Check should fail")
+	}
+	for _, want := range []string{"undocumented route POST /api/v1/tags", "not registered GET /api/v1/posts"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+}
@@ -59,14 +59,12 @@ func (p *Pagination) PageRet()[]int {
 	return res
 }
 
+// Offset 当前页第一条记录的偏移量
+func (p *Pagination) Offset() int {
+	return (p.CurrentPage - 1) * p.PerPage
+}
 
-
-
-
-
-
-
-
-
-
-
+// OutOfRange 页码是否超出范围，没有任何记录时第 1 页仍然有效
+func (p *Pagination) OutOfRange() bool {
+	return p.CurrentPage < 1 || (p.CurrentPage > 1 && p.CurrentPage > p.AllPages())
+}
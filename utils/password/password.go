@@ -0,0 +1,198 @@
+// Package password 负责后台用户密码的哈希与校验
+//
+// 支持的存储格式：
+//   - bcrypt:   $2a$<cost>$...
+//   - argon2id: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+//   - legacy:   md5(username+password) 的 32 位十六进制，仅用于校验，登录成功后应重新哈希
+//   - expired:  以 "!" 开头，任何密码都无法通过校验，需要管理员重新设置
+package password
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+	Legacy   = "md5"
+	Expired  = "expired"
+	Unknown  = "unknown"
+
+	// ExpiredPrefix 被强制过期的哈希以此开头
+	ExpiredPrefix = "!"
+)
+
+var (
+	ErrEmptyPassword = errors.New("password is empty")
+	ErrMismatch      = errors.New("password mismatch")
+	ErrExpired       = errors.New("password hash is expired")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+// Argon2Params argon2id 参数
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Time: 1, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// Hasher 生成新哈希时使用的算法与参数
+type Hasher struct {
+	Algorithm  string // bcrypt / argon2id
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// Default 全局使用的 Hasher，可在启动时按配置替换
+var Default = &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.DefaultCost, Argon2: DefaultArgon2Params}
+
+// NewHasher 按算法名创建 Hasher，cost 仅对 bcrypt 生效，非法值使用默认值
+func NewHasher(algorithm string, cost int) *Hasher {
+	h := &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.DefaultCost, Argon2: DefaultArgon2Params}
+	if algorithm == Argon2id {
+		h.Algorithm = Argon2id
+	}
+	if cost >= bcrypt.MinCost && cost <= bcrypt.MaxCost {
+		h.BcryptCost = cost
+	}
+	return h
+}
+
+// Hash 生成密码哈希
+func (h *Hasher) Hash(password string) (string, error) {
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	if h.Algorithm == Argon2id {
+		return hashArgon2(password, h.Argon2)
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	return string(b), err
+}
+
+// Verify 校验密码，username 仅用于旧的 MD5 格式
+// 校验通过时 rehash 表示哈希格式或参数已过时，调用方应使用 Hash 重新保存
+func (h *Hasher) Verify(encoded, username, password string) (rehash bool, err error) {
+	switch Format(encoded) {
+	case Bcrypt:
+		if err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)); err != nil {
+			return false, ErrMismatch
+		}
+		if h.Algorithm != Bcrypt {
+			return true, nil
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.BcryptCost, nil
+	case Argon2id:
+		params, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrMismatch
+		}
+		return h.Algorithm != Argon2id || params != h.Argon2.withLens(uint32(len(salt)), uint32(len(key))), nil
+	case Legacy:
+		sum := md5.Sum([]byte(username + password))
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(encoded)), []byte(hex.EncodeToString(sum[:]))) != 1 {
+			return false, ErrMismatch
+		}
+		return true, nil
+	case Expired:
+		return false, ErrExpired
+	}
+	return false, ErrUnknownFormat
+}
+
+// Hash 使用 Default 生成密码哈希
+func Hash(password string) (string, error) {
+	return Default.Hash(password)
+}
+
+// Verify 使用 Default 校验密码
+func Verify(encoded, username, password string) (rehash bool, err error) {
+	return Default.Verify(encoded, username, password)
+}
+
+// Format 识别哈希的存储格式
+func Format(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, ExpiredPrefix):
+		return Expired
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id
+	case isLegacy(encoded):
+		return Legacy
+	}
+	return Unknown
+}
+
+// Expire 将哈希标记为过期，已过期的哈希原样返回
+func Expire(encoded string) string {
+	if strings.HasPrefix(encoded, ExpiredPrefix) {
+		return encoded
+	}
+	return ExpiredPrefix + encoded
+}
+
+func isLegacy(encoded string) bool {
+	if len(encoded) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (p Argon2Params) withLens(saltLen, keyLen uint32) Argon2Params {
+	p.SaltLen, p.KeyLen = saltLen, keyLen
+	return p
+}
+
+func hashArgon2(password string, p Argon2Params) (string, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func decodeArgon2(encoded string) (p Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, ErrUnknownFormat
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
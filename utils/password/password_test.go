@@ -0,0 +1,66 @@
+package password
+
+import "testing"
+
+func TestHashAndVerify(t *testing.T) {
+	for _, h := range []*Hasher{
+		NewHasher(Bcrypt, 4),
+		{Algorithm: Argon2id, Argon2: Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}},
+	} {
+		encoded, err := h.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Format(encoded) != h.Algorithm {
+			t.Errorf("format of %q = %s, want %s", encoded, Format(encoded), h.Algorithm)
+		}
+		rehash, err := h.Verify(encoded, "admin", "secret")
+		if err != nil || rehash {
+			t.Errorf("%s verify = %v, %v", h.Algorithm, rehash, err)
+		}
+		if _, err := h.Verify(encoded, "admin", "wrong"); err != ErrMismatch {
+			t.Errorf("%s verify wrong password err = %v", h.Algorithm, err)
+		}
+	}
+	if _, err := Default.Hash(""); err != ErrEmptyPassword {
+		t.Errorf("empty password err = %v", err)
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	legacy := "e3274be5c857fb42ab72d786e281b4b8" // md5("admin" + "password")
+	if Format(legacy) != Legacy {
+		t.Fatalf("format of %q = %s", legacy, Format(legacy))
+	}
+	if _, err := Verify(legacy, "admin", "wrong"); err != ErrMismatch {
+		t.Errorf("legacy mismatch err = %v", err)
+	}
+	rehash, err := Verify(legacy, "admin", "password")
+	if err != nil || !rehash {
+		t.Errorf("legacy verify = %v, %v; want rehash", rehash, err)
+	}
+
+	cheap, _ := NewHasher(Bcrypt, 4).Hash("secret")
+	if rehash, err := NewHasher(Bcrypt, 5).Verify(cheap, "", "secret"); err != nil || !rehash {
+		t.Errorf("bcrypt cost change = %v, %v; want rehash", rehash, err)
+	}
+	if rehash, err := NewHasher(Argon2id, 0).Verify(cheap, "", "secret"); err != nil || !rehash {
+		t.Errorf("algorithm change = %v, %v; want rehash", rehash, err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	expired := Expire("e3274be5c857fb42ab72d786e281b4b8")
+	if Expire(expired) != expired {
+		t.Errorf("Expire is not idempotent: %q", Expire(expired))
+	}
+	if Format(expired) != Expired {
+		t.Errorf("format of %q = %s", expired, Format(expired))
+	}
+	if _, err := Verify(expired, "admin", "password"); err != ErrExpired {
+		t.Errorf("expired verify err = %v", err)
+	}
+	if _, err := Verify("plain", "admin", "plain"); err != ErrUnknownFormat {
+		t.Errorf("unknown format err = %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Package tokenize 把文本切分为词，供全文搜索和垃圾评论检测共用
+package tokenize
+
+import "unicode"
+
+// MaxTokenLen 超过这个长度的英文单词不计入结果
+const MaxTokenLen = 32
+
+// Token 切分出的词及其在原文中的位置，Start 和 End 为 rune 下标
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// IsCJK 是否为中日韩文字
+func IsCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// Split 英文和数字按单词切分并转为小写，中日韩文字按相邻两个字切分；
+// unigrams 为 true 时同时记录每个单字，否则只有一个字时才记录单字
+func Split(text string, unigrams bool) []Token {
+	var (
+		tokens    []Token
+		word      []rune
+		cjk       []rune
+		wordStart int
+		cjkStart  int
+	)
+	flushWord := func() {
+		if len(word) > 0 && len(word) <= MaxTokenLen {
+			tokens = append(tokens, Token{string(word), wordStart, wordStart + len(word)})
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		for i := range cjk {
+			if unigrams || len(cjk) == 1 {
+				tokens = append(tokens, Token{string(cjk[i]), cjkStart + i, cjkStart + i + 1})
+			}
+			if i+1 < len(cjk) {
+				tokens = append(tokens, Token{string(cjk[i : i+2]), cjkStart + i, cjkStart + i + 2})
+			}
+		}
+		cjk = cjk[:0]
+	}
+	i := 0
+	for _, r := range text {
+		switch {
+		case IsCJK(r):
+			flushWord()
+			if len(cjk) == 0 {
+				cjkStart = i
+			}
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			if len(word) == 0 {
+				wordStart = i
+			}
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+		i++
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
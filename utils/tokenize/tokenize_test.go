@@ -0,0 +1,41 @@
+package tokenize
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	terms := func(tokens []Token) []string {
+		var out []string
+		for _, token := range tokens {
+			out = append(out, token.Term)
+		}
+		return out
+	}
+	long := "abcdefghijklmnopqrstuvwxyzabcdefg"
+	cases := []struct {
+		text     string
+		unigrams bool
+		want     []string
+	}{
+		{"Hello, Go 1.12!", false, []string{"hello", "go", "1", "12"}},
+		{"全文搜索", false, []string{"全文", "文搜", "搜索"}},
+		{"全文", true, []string{"全", "全文", "文"}},
+		{"字 a", false, []string{"字", "a"}},
+		{long + " ok", false, []string{"ok"}},
+	}
+	for _, c := range cases {
+		got := terms(Split(c.text, c.unigrams))
+		if len(got) != len(c.want) {
+			t.Errorf("Split(%q, %v) = %q, want %q", c.text, c.unigrams, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("Split(%q, %v) = %q, want %q", c.text, c.unigrams, got, c.want)
+				break
+			}
+		}
+	}
+	if tokens := Split("Go 全文", false); tokens[1] != (Token{Term: "全文", Start: 3, End: 5}) {
+		t.Errorf("CJK token position = %+v", tokens[1])
+	}
+}
@@ -0,0 +1,68 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量，密钥为 "12345678901234567890"
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	} {
+		if got := hotp(key, uint64(unix/Period), 8); got != want {
+			t.Errorf("hotp at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "005924" {
+		t.Errorf("code = %s, want 005924", code)
+	}
+	step, err := Validate(secret, "005 924", now.Add(Period*time.Second))
+	if err != nil || step != Step(now) {
+		t.Errorf("validate within skew = %d, %v", step, err)
+	}
+	if _, err := Validate(secret, code, now.Add(2*Period*time.Second)); err != ErrInvalidCode {
+		t.Errorf("validate outside skew err = %v", err)
+	}
+	if _, err := Validate("not base32!", code, now); err != ErrInvalidSecret {
+		t.Errorf("invalid secret err = %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Errorf("generated secret %q: %v", secret, err)
+	}
+	uri := ProvisioningURI(secret, "lyanna", "admin")
+	if !strings.HasPrefix(uri, "otpauth://totp/lyanna:admin?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("uri = %s", uri)
+	}
+
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("codes = %v, %v", codes, err)
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))) {
+		t.Errorf("recovery code hash should ignore case, spaces and dashes")
+	}
+}